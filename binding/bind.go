@@ -6,6 +6,8 @@
 package binding
 
 import (
+	"fmt"
+
 	"github.com/tsavola/wag/compile"
 	"github.com/tsavola/wag/wa"
 )
@@ -19,11 +21,15 @@ const (
 	VectorIndexTrapHandler   = -1
 )
 
+// Unreachable may be returned by ResolveFunc instead of a vector index.
+// Calling such an import function raises the Unreachable trap.
+const Unreachable = 0
+
 // ImportResolver maps symbols to vector indexes and constant values.
 //
 // ResolveFunc returns a negative index; the vector is addressed from the end.
 // VectorIndexLastImport is the largest valid index which ResolveFunc can
-// return.
+// return.  Alternatively, Unreachable may be returned.
 //
 // ResolveGlobal returns a bit pattern the interpretation of which depends on
 // the scalar type.
@@ -32,8 +38,97 @@ type ImportResolver interface {
 	ResolveGlobal(module, field string, t wa.Type) (init uint64, err error)
 }
 
+// VariadicImportResolver may be implemented by an ImportResolver in order to
+// declare some import functions variadic.  ResolveVariadicFunc is called
+// instead of ResolveFunc.  The signature is the one declared by the importing
+// module; wa.FuncType.EqualVariadic can be used to check it against the fixed
+// parameters of the host function.
+//
+// A variadic function is invoked with the actual argument count and the
+// module's signature index in a register: the argument count in the high 32
+// bits and the signature index in the low 32 bits of RBP (x86-64) or X2
+// (ARM64).
+type VariadicImportResolver interface {
+	ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, vectorIndex int, err error)
+}
+
+// NativeAddr is the location of a host function which can be called directly
+// from generated code.  The function must follow the same calling convention
+// as functions invoked via the import vector (apart from the scratch register
+// contents).
+type NativeAddr struct {
+	Addr     uint64 // Absolute address, or offset from start of text.
+	Relative bool   // Addr is a signed offset from start of text.
+}
+
+// NativeImportResolver may be implemented by an ImportResolver in order to
+// bypass the import vector for some functions.  ResolveNativeFunc is called
+// before ResolveFunc; if found is false, ResolveFunc is called next.
+//
+// Absolute addresses cause relocations to be recorded in the object map; see
+// object.Relocate.  Text-relative addresses don't need relocation, but the
+// offset must fit in a signed 32-bit integer.
+type NativeImportResolver interface {
+	ResolveNativeFunc(module, field string, sig wa.FuncType) (addr NativeAddr, found bool, err error)
+}
+
+// BindImports resolves the module's import functions and globals.  The
+// optional IntrinsicResolver and NativeImportResolver interfaces are tried
+// first; VariadicImportResolver is used instead of ResolveFunc if implemented.
+// IntrinsicResolver is ignored if the target architecture doesn't support
+// intrinsics (see compile.IntrinsicsSupported).
 func BindImports(mod *compile.Module, reso ImportResolver) (err error) {
+	intrinsics, _ := reso.(IntrinsicResolver)
+	if !compile.IntrinsicsSupported {
+		intrinsics = nil
+	}
+	native, _ := reso.(NativeImportResolver)
+	variadic, _ := reso.(VariadicImportResolver)
+
 	for i := 0; i < mod.NumImportFuncs(); i++ {
+		if intrinsics != nil {
+			x, found, err := intrinsics.ResolveIntrinsicFunc(mod.ImportFunc(i))
+			if err != nil {
+				return err
+			}
+
+			if found {
+				mod.SetImportFuncIntrinsic(i, x)
+				continue
+			}
+		}
+
+		if native != nil {
+			addr, found, err := native.ResolveNativeFunc(mod.ImportFunc(i))
+			if err != nil {
+				return err
+			}
+
+			if found {
+				if addr.Relative && uint64(int64(int32(addr.Addr))) != addr.Addr {
+					module, field, _ := mod.ImportFunc(i)
+					return fmt.Errorf("native address of import function %s.%s is out of range: 0x%x", module, field, addr.Addr)
+				}
+
+				mod.SetImportFuncNative(i, addr.Addr, !addr.Relative)
+				continue
+			}
+		}
+
+		if variadic != nil {
+			isVariadic, index, err := variadic.ResolveVariadicFunc(mod.ImportFunc(i))
+			if err != nil {
+				return err
+			}
+
+			if isVariadic {
+				mod.SetImportFuncVariadic(i, index)
+			} else {
+				mod.SetImportFunc(i, index)
+			}
+			continue
+		}
+
 		index, err := reso.ResolveFunc(mod.ImportFunc(i))
 		if err != nil {
 			return err
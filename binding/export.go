@@ -5,27 +5,170 @@
 package binding
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/tsavola/wag/compile"
-	"github.com/tsavola/wag/internal/module"
 	"github.com/tsavola/wag/wa"
 )
 
+// EntryPolicy validates an entry function's signature while looking it up from
+// a module's exported functions.
+type EntryPolicy func(mod *compile.Module, name string) (funcIndex uint32, sig wa.FuncType, err error)
+
+// DefaultEntryNames are the conventional entry function names, in order of
+// preference.
+var DefaultEntryNames = []string{"_start", "main", "__main_argc_argv"}
+
+// EntryError describes why an entry function was not found or is unsuitable.
+// It is a module error.
+type EntryError struct {
+	Names   []string    // Export name, or candidate names if not found.
+	Found   bool        // The function is exported, but is unsuitable.
+	Sig     wa.FuncType // Actual signature if found.
+	Params  []wa.Type   // Expected parameter types, or nil if not checked.
+	Results []wa.Type   // Acceptable result types.
+	Args    []uint64    // Arguments if their count doesn't match parameters.
+}
+
+func (e *EntryError) Error() string {
+	if !e.Found {
+		if len(e.Names) == 1 {
+			return fmt.Sprintf("export function %q not found", e.Names[0])
+		}
+
+		quoted := make([]string, len(e.Names))
+		for i, name := range e.Names {
+			quoted[i] = fmt.Sprintf("%q", name)
+		}
+		return fmt.Sprintf("none of export functions %s found", strings.Join(quoted, ", "))
+	}
+
+	if e.Args != nil {
+		return fmt.Sprintf("export function %q has %d parameters (%d arguments provided)", e.Names[0], len(e.Sig.Params), len(e.Args))
+	}
+
+	if e.Params != nil && !equalTypes(e.Params, e.Sig.Params) {
+		return fmt.Sprintf("export function %q has wrong signature %s (expected parameters %s)", e.Names[0], e.Sig, wa.FuncType{Params: e.Params})
+	}
+
+	return fmt.Sprintf("export function %q has wrong result type %s", e.Names[0], e.Sig.Result)
+}
+
+func (e *EntryError) ModuleError() string { return e.Error() }
+
 // GetMainFunc, the result type of which is void or i32.  Parameter count or
 // types are not checked.
 func GetMainFunc(mod *compile.Module, name string) (funcIndex uint32, sig wa.FuncType, err error) {
+	return getEntryFunc(mod, name, nil, []wa.Type{wa.Void, wa.I32})
+}
+
+// GetExactFunc returns a policy which requires the entry function to have
+// exactly the specified parameter types, and one of the specified result
+// types.  Void and i32 results are accepted if none are specified.
+func GetExactFunc(params []wa.Type, results ...wa.Type) EntryPolicy {
+	if params == nil {
+		params = []wa.Type{}
+	}
+	if len(results) == 0 {
+		results = []wa.Type{wa.Void, wa.I32}
+	}
+
+	return func(mod *compile.Module, name string) (uint32, wa.FuncType, error) {
+		return getEntryFunc(mod, name, params, results)
+	}
+}
+
+// TypedArg is an entry function argument.
+type TypedArg struct {
+	Type  wa.Type
+	Value uint64
+}
+
+// GetTypedFunc returns a policy which requires the entry function's parameter
+// types to match the arguments exactly.  See GetExactFunc for result types.
+// The argument values can be passed to the compiler using TypedArgValues.
+func GetTypedFunc(args []TypedArg, results ...wa.Type) EntryPolicy {
+	params := make([]wa.Type, len(args))
+	for i, arg := range args {
+		params[i] = arg.Type
+	}
+
+	return GetExactFunc(params, results...)
+}
+
+// TypedArgValues converts arguments to the wag.Config.EntryArgs format.
+func TypedArgValues(args []TypedArg) []uint64 {
+	values := make([]uint64, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
+
+// GetFirstFunc returns a policy which looks up the first exported function
+// out of the candidate names, and validates it using the other policy.  The
+// name passed to the returned policy is ignored.  If candidates are not
+// specified, DefaultEntryNames are used.  If policy is nil, GetMainFunc is
+// used.
+func GetFirstFunc(policy EntryPolicy, candidates ...string) EntryPolicy {
+	if len(candidates) == 0 {
+		candidates = DefaultEntryNames
+	}
+	if policy == nil {
+		policy = GetMainFunc
+	}
+
+	return func(mod *compile.Module, _ string) (funcIndex uint32, sig wa.FuncType, err error) {
+		for _, name := range candidates {
+			if _, _, found := mod.ExportFunc(name); found {
+				return policy(mod, name)
+			}
+		}
+
+		err = &EntryError{Names: candidates}
+		return
+	}
+}
+
+func getEntryFunc(mod *compile.Module, name string, params, results []wa.Type) (funcIndex uint32, sig wa.FuncType, err error) {
 	funcIndex, sig, found := mod.ExportFunc(name)
 	if !found {
-		err = module.Errorf("export function %q not found", name)
+		err = &EntryError{Names: []string{name}}
 		return
 	}
 
-	switch sig.Result {
-	case wa.Void, wa.I32:
-		// ok
+	if (params == nil || equalTypes(params, sig.Params)) && hasType(results, sig.Result) {
 		return
+	}
 
-	default:
-		err = module.Errorf("export function %q has wrong result type %s", name, sig.Result)
-		return
+	err = &EntryError{
+		Names:   []string{name},
+		Found:   true,
+		Sig:     sig,
+		Params:  params,
+		Results: results,
+	}
+	return
+}
+
+func equalTypes(a, b []wa.Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func hasType(types []wa.Type, t wa.Type) bool {
+	for _, x := range types {
+		if x == t {
+			return true
+		}
 	}
+	return false
 }
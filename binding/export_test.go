@@ -0,0 +1,79 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binding
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/wa"
+)
+
+// Exports main(i32, i32) i32 and run() i64.
+const testEntryModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0e\x03\x60\x00\x00\x60\x02\x7f\x7f\x01\x7f\x60\x00\x01\x7e\x03\x03\x02\x01\x02\x07\x0e\x02\x04\x6d\x61\x69\x6e\x00\x00\x03\x72\x75\x6e\x00\x01\x0a\x0b\x02\x04\x00\x41\x00\x0b\x04\x00\x42\x00\x0b"
+
+func loadEntryModule(t *testing.T) *compile.Module {
+	t.Helper()
+
+	mod, err := compile.LoadInitialSections(nil, strings.NewReader(testEntryModule))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mod
+}
+
+func checkEntryError(t *testing.T, err error, found bool) {
+	t.Helper()
+
+	e, ok := err.(*EntryError)
+	if !ok || e.Found != found {
+		t.Errorf("%#v", err)
+	} else {
+		t.Log(e.ModuleError())
+	}
+}
+
+func TestEntryPolicies(t *testing.T) {
+	mod := loadEntryModule(t)
+
+	if index, _, err := GetMainFunc(mod, "main"); err != nil || index != 0 {
+		t.Error(index, err)
+	}
+	_, _, err := GetMainFunc(mod, "run")
+	checkEntryError(t, err, true)
+	_, _, err = GetMainFunc(mod, "start")
+	checkEntryError(t, err, false)
+
+	args := []TypedArg{{wa.I32, 1}, {wa.I32, 2}}
+
+	if _, sig, err := GetTypedFunc(args)(mod, "main"); err != nil || sig.Result != wa.I32 {
+		t.Error(sig, err)
+	}
+	_, _, err = GetTypedFunc(args[:1])(mod, "main")
+	checkEntryError(t, err, true)
+	_, _, err = GetExactFunc([]wa.Type{wa.I32, wa.I64})(mod, "main")
+	checkEntryError(t, err, true)
+	if vals := TypedArgValues(args); len(vals) != 2 || vals[1] != 2 {
+		t.Error(vals)
+	}
+
+	if index, _, err := GetExactFunc(nil, wa.I64)(mod, "run"); err != nil || index != 1 {
+		t.Error(index, err)
+	}
+	_, _, err = GetExactFunc(nil, wa.F64)(mod, "run")
+	checkEntryError(t, err, true)
+
+	if index, _, err := GetFirstFunc(nil, "_start", "main", "run")(mod, ""); err != nil || index != 0 {
+		t.Error(index, err)
+	}
+	if index, _, err := GetFirstFunc(GetExactFunc(nil, wa.I64), "_start", "run")(mod, ""); err != nil || index != 1 {
+		t.Error(index, err)
+	}
+	_, _, err = GetFirstFunc(GetExactFunc(nil))(mod, "")
+	checkEntryError(t, err, true)
+	_, _, err = GetFirstFunc(nil, "_start", "start")(mod, "main")
+	checkEntryError(t, err, false)
+}
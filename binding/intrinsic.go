@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binding
+
+import (
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/wa"
+)
+
+// IntrinsicResolver may be implemented by an ImportResolver in order to have
+// some import functions generated inline.  ResolveIntrinsicFunc is called
+// before the other resolver methods; if found is false, they are called next.
+type IntrinsicResolver interface {
+	ResolveIntrinsicFunc(module, field string, sig wa.FuncType) (x compile.Intrinsic, found bool, err error)
+}
+
+// Intrinsics is a registry of import functions which are generated inline.
+// It maps module and field names to intrinsics.  It implements
+// IntrinsicResolver, so it can be embedded in an ImportResolver
+// implementation.
+type Intrinsics map[string]map[string]compile.Intrinsic
+
+// LibcIntrinsics returns a new registry with memcpy, memset, sqrt and sqrtf in
+// the "env" module.
+func LibcIntrinsics() Intrinsics {
+	return Intrinsics{
+		"env": {
+			"memcpy": compile.IntrinsicMemcpy,
+			"memset": compile.IntrinsicMemset,
+			"sqrt":   compile.IntrinsicSqrtF64,
+			"sqrtf":  compile.IntrinsicSqrtF32,
+		},
+	}
+}
+
+// Register an intrinsic, replacing a previous one with the same name.
+func (r Intrinsics) Register(module, field string, x compile.Intrinsic) {
+	fields := r[module]
+	if fields == nil {
+		fields = make(map[string]compile.Intrinsic)
+		r[module] = fields
+	}
+	fields[field] = x
+}
+
+// ResolveIntrinsicFunc implements IntrinsicResolver.  An error is returned if
+// a registered function is imported with a different signature.
+func (r Intrinsics) ResolveIntrinsicFunc(moduleName, field string, sig wa.FuncType) (x compile.Intrinsic, found bool, err error) {
+	x, found = r[moduleName][field]
+	if found && !sig.Equal(x.Type()) {
+		err = module.Errorf("import function %s.%s has wrong signature for intrinsic %s: %s (should be %s)", moduleName, field, x, sig, x.Type())
+	}
+	return
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binding
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/wa"
+)
+
+// LazyFunc is an import function which is bound on demand.
+type LazyFunc struct {
+	ImportFunc
+	VectorIndex int
+}
+
+// LazyBinder resolves the address of a lazily bound import function.  The
+// address is written to the function's import vector slot.
+type LazyBinder interface {
+	BindLazyFunc(f LazyFunc) (addr uint64, err error)
+}
+
+// Lazy resolves import functions which the wrapped resolver doesn't find to
+// import vector slots which are bound on demand.  The slots are allocated
+// downwards starting from NextVectorIndex, which must be initialized to
+// VectorIndexLastImport or lower.  An import requested multiple times with
+// the same signature is allocated a single slot.
+//
+// The runtime must initialize the slots with the address of the NoFunction
+// trap routine; see InitVector.  Calling such an import function raises the
+// NoFunction trap, which the runtime can handle using BindTrap.
+//
+// A Lazy instance must be used for resolving the imports of a single module,
+// and it must be passed to BindImports (or wag.Compile) directly, so that
+// ImportVectorIndexes corresponds to the module's import functions.  Lazy
+// binding works only for import functions which are called directly.
+type Lazy struct {
+	ImportResolver
+	NextVectorIndex     int
+	Funcs               []LazyFunc
+	ImportVectorIndexes []int // Indexed by import function index.
+}
+
+func (l *Lazy) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = l.ResolveVariadicFunc(module, field, sig)
+	return
+}
+
+func (l *Lazy) ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	variadic, index, err = l.resolveVariadicFunc(module, field, sig)
+	if err == nil {
+		l.ImportVectorIndexes = append(l.ImportVectorIndexes, index)
+	}
+	return
+}
+
+func (l *Lazy) resolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	if l.ImportResolver != nil {
+		variadic, index, err = resolveVariadicFunc(l.ImportResolver, module, field, sig)
+		if !IsNotFound(err) {
+			return
+		}
+		variadic, err = false, nil
+	}
+
+	if f, found := l.Lookup(module, field, sig); found {
+		index = f.VectorIndex
+		return
+	}
+
+	index = l.NextVectorIndex
+	l.NextVectorIndex--
+	l.Funcs = append(l.Funcs, LazyFunc{ImportFunc{module, field, sig}, index})
+	return
+}
+
+func (l *Lazy) ResolveGlobal(module, field string, t wa.Type) (init uint64, err error) {
+	if l.ImportResolver == nil {
+		err = &NotFoundError{Module: module, Field: field, Global: true}
+		return
+	}
+
+	return l.ImportResolver.ResolveGlobal(module, field, t)
+}
+
+// Lookup a lazily bound function.
+func (l *Lazy) Lookup(module, field string, sig wa.FuncType) (f LazyFunc, found bool) {
+	for _, f = range l.Funcs {
+		if f.Module == module && f.Field == field && f.Equal(sig) {
+			found = true
+			return
+		}
+	}
+	return
+}
+
+// LookupIndex finds the lazily bound function which the module imports at
+// the given import function index.
+func (l *Lazy) LookupIndex(mod *compile.Module, importIndex int) (f LazyFunc, found bool) {
+	if importIndex < 0 || importIndex >= mod.NumImportFuncs() {
+		return
+	}
+
+	return l.Lookup(mod.ImportFunc(importIndex))
+}
+
+// InitVector sets the lazily bound slots of an import vector to trapAddr,
+// which is normally the absolute address of the NoFunction trap routine (text
+// address plus abi.TextAddrNoFunction).  The vector is addressed from the end.
+func (l *Lazy) InitVector(vector []byte, trapAddr uint64) {
+	for _, f := range l.Funcs {
+		binary.LittleEndian.PutUint64(vector[len(vector)+f.VectorIndex*8:], trapAddr)
+	}
+}
+
+// BindTrap handles a NoFunction trap caused by calling a lazily bound import
+// function.  retAddr is the return address (relative to text) found at the top
+// of the program's stack.  The binder is invoked with the function, and the
+// address is written to the vector slot.
+//
+// The runtime must retry the call by resuming the program at callAddr
+// (relative to text), e.g. by replacing the return address at the top of the
+// stack with it.
+func (l *Lazy) BindTrap(binder LazyBinder, funcMap *object.FuncMap, text, vector []byte, retAddr uint32) (callAddr uint32, err error) {
+	funcIndex, callAddr, ok := funcMap.FindCall(text, retAddr)
+	if !ok || funcIndex >= funcMap.NumImportFuncs || funcIndex >= len(l.ImportVectorIndexes) {
+		err = fmt.Errorf("no import function call at return address 0x%x", retAddr)
+		return
+	}
+
+	f, found := l.lookupVectorIndex(l.ImportVectorIndexes[funcIndex])
+	if !found {
+		err = fmt.Errorf("import function #%d is not bound lazily", funcIndex)
+		return
+	}
+
+	if len(vector) < -f.VectorIndex*8 {
+		err = errors.New("import vector is too short")
+		return
+	}
+
+	addr, err := binder.BindLazyFunc(f)
+	if err != nil {
+		return
+	}
+
+	binary.LittleEndian.PutUint64(vector[len(vector)+f.VectorIndex*8:], addr)
+	return
+}
+
+func (l *Lazy) lookupVectorIndex(index int) (f LazyFunc, found bool) {
+	for _, f = range l.Funcs {
+		if f.VectorIndex == index {
+			found = true
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,279 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binding
+
+import (
+	"fmt"
+
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/wa"
+)
+
+// The resolvers of this package forward VariadicImportResolver calls to the
+// resolvers which they wrap.  Other optional interfaces (such as
+// IntrinsicResolver) are not forwarded; they may be added by embedding the
+// resolver in a struct.
+
+// NotFoundError is returned by the resolvers of this package when an import
+// is not found.  Chain tries the next resolver, and StubMissing stubs the
+// import.  It is a module error.
+type NotFoundError struct {
+	Module string
+	Field  string
+	Global bool
+}
+
+func (e *NotFoundError) Error() string {
+	kind := "function"
+	if e.Global {
+		kind = "global"
+	}
+	return fmt.Sprintf("import %s not found: %s.%s", kind, e.Module, e.Field)
+}
+
+func (e *NotFoundError) ModuleError() string { return e.Error() }
+
+// IsNotFound checks if err is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+// Func is an import function implementation.
+type Func struct {
+	VectorIndex int
+	wa.FuncType      // Fixed parameters if variadic.
+	Variadic    bool // See VariadicImportResolver.
+}
+
+// Implements checks if the function can be called using the signature.
+func (f Func) Implements(sig wa.FuncType) bool {
+	if f.Variadic {
+		return f.FuncType.EqualVariadic(sig)
+	}
+	return f.FuncType.Equal(sig)
+}
+
+// Global is an import global's type and value.
+type Global struct {
+	Type wa.Type
+	Init uint64
+}
+
+// Map resolves imports by module and field names, and checks their
+// signatures and types.
+type Map struct {
+	Funcs   map[string]map[string]Func
+	Globals map[string]map[string]Global
+}
+
+// RegisterFunc adds or replaces a function.
+func (m *Map) RegisterFunc(module, field string, f Func) {
+	if m.Funcs == nil {
+		m.Funcs = make(map[string]map[string]Func)
+	}
+	fields := m.Funcs[module]
+	if fields == nil {
+		fields = make(map[string]Func)
+		m.Funcs[module] = fields
+	}
+	fields[field] = f
+}
+
+// RegisterGlobal adds or replaces a global.
+func (m *Map) RegisterGlobal(module, field string, g Global) {
+	if m.Globals == nil {
+		m.Globals = make(map[string]map[string]Global)
+	}
+	fields := m.Globals[module]
+	if fields == nil {
+		fields = make(map[string]Global)
+		m.Globals[module] = fields
+	}
+	fields[field] = g
+}
+
+func (m *Map) ResolveFunc(moduleName, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = m.ResolveVariadicFunc(moduleName, field, sig)
+	return
+}
+
+func (m *Map) ResolveVariadicFunc(moduleName, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	f, found := m.Funcs[moduleName][field]
+	if !found {
+		err = &NotFoundError{Module: moduleName, Field: field}
+		return
+	}
+
+	if !f.Implements(sig) {
+		err = module.Errorf("import function %s.%s has wrong signature: %s (implementation is %s)", moduleName, field, sig, f.FuncType)
+		return
+	}
+
+	variadic = f.Variadic
+	index = f.VectorIndex
+	return
+}
+
+func (m *Map) ResolveGlobal(moduleName, field string, t wa.Type) (init uint64, err error) {
+	g, found := m.Globals[moduleName][field]
+	if !found {
+		err = &NotFoundError{Module: moduleName, Field: field, Global: true}
+		return
+	}
+
+	if g.Type != t {
+		err = module.Errorf("import global %s.%s has wrong type: %s (should be %s)", moduleName, field, t, g.Type)
+		return
+	}
+
+	init = g.Init
+	return
+}
+
+// Namespaces routes imports to resolvers by module name.
+type Namespaces map[string]ImportResolver
+
+func (ns Namespaces) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = ns.ResolveVariadicFunc(module, field, sig)
+	return
+}
+
+func (ns Namespaces) ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	r := ns[module]
+	if r == nil {
+		err = &NotFoundError{Module: module, Field: field}
+		return
+	}
+
+	return resolveVariadicFunc(r, module, field, sig)
+}
+
+func (ns Namespaces) ResolveGlobal(module, field string, t wa.Type) (init uint64, err error) {
+	r := ns[module]
+	if r == nil {
+		err = &NotFoundError{Module: module, Field: field, Global: true}
+		return
+	}
+
+	return r.ResolveGlobal(module, field, t)
+}
+
+// Chain tries resolvers in order until one of them returns something other
+// than NotFoundError.
+type Chain []ImportResolver
+
+func (c Chain) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = c.ResolveVariadicFunc(module, field, sig)
+	return
+}
+
+func (c Chain) ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	err = &NotFoundError{Module: module, Field: field}
+
+	for _, r := range c {
+		variadic, index, err = resolveVariadicFunc(r, module, field, sig)
+		if !IsNotFound(err) {
+			break
+		}
+	}
+	return
+}
+
+func (c Chain) ResolveGlobal(module, field string, t wa.Type) (init uint64, err error) {
+	err = &NotFoundError{Module: module, Field: field, Global: true}
+
+	for _, r := range c {
+		init, err = r.ResolveGlobal(module, field, t)
+		if !IsNotFound(err) {
+			break
+		}
+	}
+	return
+}
+
+// StubMissing resolves import functions which the wrapped resolver doesn't
+// find to Unreachable, and import globals to zero.
+type StubMissing struct {
+	ImportResolver
+}
+
+func (s StubMissing) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = s.ResolveVariadicFunc(module, field, sig)
+	return
+}
+
+func (s StubMissing) ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	variadic, index, err = resolveVariadicFunc(s.ImportResolver, module, field, sig)
+	if IsNotFound(err) {
+		variadic, index, err = false, Unreachable, nil
+	}
+	return
+}
+
+func (s StubMissing) ResolveGlobal(module, field string, t wa.Type) (init uint64, err error) {
+	init, err = s.ImportResolver.ResolveGlobal(module, field, t)
+	if IsNotFound(err) {
+		init, err = 0, nil
+	}
+	return
+}
+
+// ImportFunc is a function requested by a module.
+type ImportFunc struct {
+	Module string
+	Field  string
+	wa.FuncType
+}
+
+// ImportGlobal is a global requested by a module.
+type ImportGlobal struct {
+	Module string
+	Field  string
+	Type   wa.Type
+}
+
+// Recorder lists the imports requested by a module.  If the wrapped resolver
+// is nil, functions are resolved to Unreachable and globals to zero.
+type Recorder struct {
+	ImportResolver
+	Funcs   []ImportFunc
+	Globals []ImportGlobal
+}
+
+func (r *Recorder) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	_, index, err = r.ResolveVariadicFunc(module, field, sig)
+	return
+}
+
+func (r *Recorder) ResolveVariadicFunc(module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	r.Funcs = append(r.Funcs, ImportFunc{module, field, sig})
+
+	if r.ImportResolver == nil {
+		index = Unreachable
+		return
+	}
+
+	return resolveVariadicFunc(r.ImportResolver, module, field, sig)
+}
+
+func (r *Recorder) ResolveGlobal(module, field string, t wa.Type) (init uint64, err error) {
+	r.Globals = append(r.Globals, ImportGlobal{module, field, t})
+
+	if r.ImportResolver == nil {
+		return
+	}
+
+	return r.ImportResolver.ResolveGlobal(module, field, t)
+}
+
+func resolveVariadicFunc(r ImportResolver, module, field string, sig wa.FuncType) (variadic bool, index int, err error) {
+	if v, ok := r.(VariadicImportResolver); ok {
+		return v.ResolveVariadicFunc(module, field, sig)
+	}
+
+	index, err = r.ResolveFunc(module, field, sig)
+	return
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package binding
+
+import (
+	"testing"
+
+	"github.com/tsavola/wag/wa"
+)
+
+var (
+	sigVoid  = wa.FuncType{}
+	sigI32   = wa.FuncType{Params: []wa.Type{wa.I32}}
+	sigI32x2 = wa.FuncType{Params: []wa.Type{wa.I32, wa.I32}}
+)
+
+func testMap() *Map {
+	m := new(Map)
+	m.RegisterFunc("env", "exit", Func{VectorIndex: -5, FuncType: sigI32})
+	m.RegisterFunc("env", "printf", Func{VectorIndex: -6, FuncType: sigI32, Variadic: true})
+	m.RegisterGlobal("env", "answer", Global{Type: wa.I32, Init: 42})
+	return m
+}
+
+func TestMap(t *testing.T) {
+	m := testMap()
+
+	if index, err := m.ResolveFunc("env", "exit", sigI32); err != nil || index != -5 {
+		t.Error(index, err)
+	}
+	if _, err := m.ResolveFunc("env", "exit", sigVoid); err == nil || IsNotFound(err) {
+		t.Error(err)
+	}
+	if variadic, index, err := m.ResolveVariadicFunc("env", "printf", sigI32x2); err != nil || !variadic || index != -6 {
+		t.Error(variadic, index, err)
+	}
+	if _, err := m.ResolveFunc("env", "printf", sigVoid); err == nil || IsNotFound(err) {
+		t.Error(err)
+	}
+	if _, err := m.ResolveFunc("env", "abort", sigVoid); !IsNotFound(err) {
+		t.Error(err)
+	}
+	if init, err := m.ResolveGlobal("env", "answer", wa.I32); err != nil || init != 42 {
+		t.Error(init, err)
+	}
+	if _, err := m.ResolveGlobal("env", "answer", wa.I64); err == nil || IsNotFound(err) {
+		t.Error(err)
+	}
+}
+
+func TestNamespacesAndChain(t *testing.T) {
+	other := new(Map)
+	other.RegisterFunc("env", "abort", Func{VectorIndex: -7, FuncType: sigVoid})
+	other.RegisterFunc("env", "exit", Func{VectorIndex: -8, FuncType: sigI32})
+
+	ns := Namespaces{"env": Chain{testMap(), other}}
+
+	if index, err := ns.ResolveFunc("env", "exit", sigI32); err != nil || index != -5 {
+		t.Error(index, err)
+	}
+	if index, err := ns.ResolveFunc("env", "abort", sigVoid); err != nil || index != -7 {
+		t.Error(index, err)
+	}
+	if variadic, _, err := ns.ResolveVariadicFunc("env", "printf", sigI32); err != nil || !variadic {
+		t.Error(variadic, err)
+	}
+	if _, err := ns.ResolveFunc("env", "atexit", sigVoid); !IsNotFound(err) {
+		t.Error(err)
+	}
+	if _, err := ns.ResolveFunc("wasi", "exit", sigI32); !IsNotFound(err) {
+		t.Error(err)
+	}
+	if _, err := ns.ResolveGlobal("wasi", "answer", wa.I32); !IsNotFound(err) {
+		t.Error(err)
+	}
+
+	// A signature error doesn't fall through.
+	if _, err := (Chain{testMap(), other}).ResolveFunc("env", "exit", sigVoid); err == nil || IsNotFound(err) {
+		t.Error(err)
+	}
+}
+
+func TestStubMissingAndRecorder(t *testing.T) {
+	rec := &Recorder{ImportResolver: StubMissing{testMap()}}
+
+	if index, err := rec.ResolveFunc("env", "abort", sigVoid); err != nil || index != Unreachable {
+		t.Error(index, err)
+	}
+	if index, err := rec.ResolveFunc("env", "exit", sigI32); err != nil || index != -5 {
+		t.Error(index, err)
+	}
+	if _, err := rec.ResolveFunc("env", "exit", sigVoid); err == nil {
+		t.Error("signature error was stubbed")
+	}
+	if init, err := rec.ResolveGlobal("env", "question", wa.I32); err != nil || init != 0 {
+		t.Error(init, err)
+	}
+
+	if len(rec.Funcs) != 3 || rec.Funcs[0].Field != "abort" || !rec.Funcs[1].Equal(sigI32) {
+		t.Error(rec.Funcs)
+	}
+	if len(rec.Globals) != 1 || rec.Globals[0].Field != "question" {
+		t.Error(rec.Globals)
+	}
+}
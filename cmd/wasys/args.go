@@ -0,0 +1,32 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Program's command-line arguments and environment variables.  They are
+// copied into buffers provided by the program via the args and environ
+// functions of the WASI module, or the env module (see envHostFuncs).
+var (
+	progArgs    []string
+	progEnviron []string
+)
+
+// selectEnviron picks environment variables which are forwarded to the
+// program.  A name without value refers to a host variable; it is skipped if
+// it is not set.
+func selectEnviron(names []string) (env []string) {
+	for _, name := range names {
+		if strings.Contains(name, "=") {
+			env = append(env, name)
+		} else if value, found := os.LookupEnv(name); found {
+			env = append(env, name+"="+value)
+		}
+	}
+	return
+}
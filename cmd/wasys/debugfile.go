@@ -0,0 +1,62 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/object/file/elf"
+)
+
+// nativeDWARF translates the program's DWARF line information so that it
+// describes the machine code at textAddr.  Nil is returned if the program
+// doesn't have DWARF line information.
+func nativeDWARF(obj *wag.Object, textAddr uint64) map[string][]byte {
+	data, err := obj.Debug.DWARF()
+	if err != nil {
+		log.Printf("DWARF: %v", err)
+		return nil
+	}
+	if data == nil {
+		return nil
+	}
+
+	sections, err := obj.InsnMap.NativeDWARF(textAddr, len(obj.Text), &obj.Names, data)
+	if err != nil {
+		log.Printf("DWARF: %v", err)
+		return nil
+	}
+
+	return sections
+}
+
+// writeDebugFile describes the loaded program text.  It can be loaded into
+// gdb using the add-symbol-file command (with the text address).
+func writeDebugFile(filename string, obj *wag.Object, textAddr uintptr) (err error) {
+	df := &elf.DebugFile{
+		TextAddr:       uint64(textAddr),
+		TextSize:       len(obj.Text),
+		FuncAddrs:      obj.FuncAddrs,
+		NumImportFuncs: obj.NumImportFuncs,
+		TrapAddrs:      obj.TrapAddrs,
+		Names:          &obj.Names,
+		DebugSections:  nativeDWARF(obj, uint64(textAddr)),
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	_, err = df.WriteTo(f)
+	return
+}
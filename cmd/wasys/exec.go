@@ -4,6 +4,33 @@
 
 package main
 
-func exec(textBase, stackLimit, memoryBase, stackPtr uintptr)
+// exec enters the program via the init or resume routine.  Value is passed in
+// the result register.  exec returns when the program invokes the trap handler
+// or a host function.  In the case of a trap, hostCall is zero and result is
+// the trap handler's argument (see package trap).  Otherwise hostCall is the
+// host function number and result is the result register's value.  The
+// program's stack pointer is returned in both cases.
+func exec(textBase, stackLimit, memoryBase, stackPtr, entryAddr uintptr, value uint64) (hostCall, result uint64, lastStackPtr uintptr)
+
+// hostCall is jumped to by host function stubs; it returns from exec.
+func hostCall()
+
 func importTrapHandler() uint64
 func importGrowMemory() uint64
+func importCurrentMemory() uint64
+
+// Go stack and frame pointers are saved during program execution.
+var (
+	execStackPtr uintptr
+	execFramePtr uintptr
+	execLinkAddr uintptr // arm64
+	execG        uintptr // arm64
+	hostLinkAddr uintptr // arm64: program's link address during host call
+)
+
+// Linear memory state is accessed by the grow and current memory routines.
+var (
+	memoryAddr       uintptr
+	memoryPages      uint64
+	memoryLimitPages uint64
+)
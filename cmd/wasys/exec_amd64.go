@@ -0,0 +1,22 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/tsavola/wag/object/stack"
+)
+
+// Host function arguments follow the return address on the stack.
+const stackArgsOffset = 8
+
+// setupInvokeFrame places function arguments and the return address at the
+// end of the stack.  The stack offset is returned.
+func setupInvokeFrame(stackMem []byte, retAddr uint64, args []uint64) (offset int) {
+	offset = len(stackMem) - stack.SetupEntryFrame(stackMem, 0, args)
+	binary.LittleEndian.PutUint64(stackMem[offset:], retAddr)
+	return
+}
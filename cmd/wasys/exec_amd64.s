@@ -4,16 +4,19 @@
 
 #include "textflag.h"
 
-// func exec(textBase, stackLimit, memoryBase, stackPtr uintptr)
-TEXT ·exec(SB),NOSPLIT,$0-48
+// func exec(textBase, stackLimit, memoryBase, stackPtr, entryAddr uintptr, value uint64) (hostCall, result uint64, lastStackPtr uintptr)
+TEXT ·exec(SB),NOSPLIT,$0-72
 	MOVQ	textBase+0(FP), R15
 	MOVQ	stackLimit+8(FP), BX
 	MOVQ	memoryBase+16(FP), R14
 	MOVQ	stackPtr+24(FP), CX
+	MOVQ	entryAddr+32(FP), DX
+	MOVQ	value+40(FP), AX
 
+	MOVQ	SP, ·execStackPtr(SB)
+	MOVQ	BP, ·execFramePtr(SB)
 	MOVQ	CX, SP			// stack ptr
 
-	XORL	AX, AX
 	XORL	CX, CX
 	XORL	BP, BP
 	XORL	SI, SI
@@ -25,9 +28,12 @@ TEXT ·exec(SB),NOSPLIT,$0-48
 	XORL	R12, R12
 	XORL	R13, R13
 
-	MOVQ	R15, DX
-	ADDQ	$32, DX			// init routine
-	JMP	DX
+	CMPL	·suspendPending(SB), $0
+	JEQ	enter
+	MOVQ	$0x7fffffffffffffff, BX // suspend bit and stack limit
+
+enter:
+	JMP	DX			// init or resume routine
 
 // func importTrapHandler() uint64
 TEXT ·importTrapHandler(SB),$0-8
@@ -36,17 +42,24 @@ TEXT ·importTrapHandler(SB),$0-8
 	RET
 
 TEXT trapHandler<>(SB),NOSPLIT,$0
-	CMPL	AX, $0			// exit trap (lower 32 bits)
-	JE	exittrap
-	ADDL	$100, AX		// 100 + trap id
-	JMP	sysexit
-
-exittrap:
-	SHRQ	$32, AX			// exit code (higher 32 bits)
-sysexit:
-	MOVL	AX, DI
-	MOVL	$231, AX		// exit_group syscall
-	SYSCALL
+	MOVQ	SP, CX
+	MOVQ	·execStackPtr(SB), SP
+	XCHGQ	BP, ·execFramePtr(SB)	// restore Go frame pointer
+	MOVQ	$0, 56(SP)		// hostCall
+	MOVQ	AX, 64(SP)		// result
+	MOVQ	CX, 72(SP)		// lastStackPtr
+	RET				// from exec
+
+// func hostCall()
+TEXT ·hostCall(SB),NOSPLIT,$0
+	// Host function number is in CX.
+	MOVQ	SP, DX
+	MOVQ	·execStackPtr(SB), SP
+	XCHGQ	BP, ·execFramePtr(SB)	// restore Go frame pointer
+	MOVQ	CX, 56(SP)		// hostCall
+	MOVQ	AX, 64(SP)		// result
+	MOVQ	DX, 72(SP)		// lastStackPtr
+	RET				// from exec
 
 // func importGrowMemory() uint64
 TEXT ·importGrowMemory(SB),$0-8
@@ -55,4 +68,43 @@ TEXT ·importGrowMemory(SB),$0-8
 	RET
 
 TEXT growMemory<>(SB),NOSPLIT,$0
-	HLT				// TODO: implementation
+	MOVL	AX, SI			// increment pages
+	MOVQ	·memoryPages(SB), R12	// current pages
+	LEAQ	(R12)(SI*1), DI		// new pages
+	CMPQ	DI, ·memoryLimitPages(SB)
+	JA	outofmemory
+
+	MOVQ	R12, DI
+	SHLQ	$16, DI
+	ADDQ	R14, DI			// mprotect addr
+	SHLQ	$16, SI			// mprotect len
+	MOVL	$3, DX			// PROT_READ|PROT_WRITE
+	MOVL	$10, AX			// mprotect syscall
+	SYSCALL
+	TESTQ	AX, AX
+	JNE	outofmemory
+
+	SHRQ	$16, SI
+	ADDQ	R12, SI
+	MOVQ	SI, ·memoryPages(SB)	// new pages
+	MOVL	R12, AX			// old pages
+	JMP	resume
+
+outofmemory:
+	MOVL	$-1, AX
+resume:
+	MOVQ	R15, DX
+	ADDQ	$16, DX
+	JMP	DX
+
+// func importCurrentMemory() uint64
+TEXT ·importCurrentMemory(SB),$0-8
+	LEAQ	currentMemory<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT currentMemory<>(SB),NOSPLIT,$0
+	MOVQ	·memoryPages(SB), AX
+	MOVQ	R15, DX
+	ADDQ	$16, DX
+	JMP	DX
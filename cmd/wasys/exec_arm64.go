@@ -0,0 +1,20 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "github.com/tsavola/wag/object/stack"
+
+// Host function arguments are at the top of the stack (return address is in
+// the link register).
+const stackArgsOffset = 0
+
+// setupInvokeFrame places function arguments at the end of the stack, and
+// arranges the return address to be loaded into the link register.  The stack
+// offset is returned.
+func setupInvokeFrame(stackMem []byte, retAddr uint64, args []uint64) (offset int) {
+	offset = len(stackMem) - stack.SetupEntryFrame(stackMem, 0, args) + 8
+	hostLinkAddr = uintptr(retAddr)
+	return
+}
@@ -4,38 +4,53 @@
 
 #include "textflag.h"
 
-// func exec(textBase, stackLimit, memoryBase, stackPtr uintptr)
-TEXT ·exec(SB),NOSPLIT,$0-48
-	MOVD	textBase+0(FP), R27
+// func exec(textBase, stackLimit, memoryBase, stackPtr, entryAddr uintptr, value uint64) (hostCall, result uint64, lastStackPtr uintptr)
+TEXT ·exec(SB),NOSPLIT,$0-72
+	MOVD	textBase+0(FP), R6
 	MOVD	stackLimit+8(FP), R0
 	MOVD	memoryBase+16(FP), R26
-	MOVD	stackPtr+24(FP), R29	// RegFakeSP
+	MOVD	stackPtr+24(FP), R1
+	MOVD	entryAddr+32(FP), R3
+	MOVD	value+40(FP), R5
 
+	MOVD	RSP, R2
+	MOVD	R2, ·execStackPtr(SB)
+	MOVD	R29, ·execFramePtr(SB)
+	MOVD	LR, ·execLinkAddr(SB)
+	MOVD	g, ·execG(SB)
+
+	MOVD	R1, R29			// RegFakeSP
 	MOVD	R0, RSP			// RegRealSP
 	ADD	$16, R0			// func call link addr + its stack check trap link addr
 	LSR	$4, R0
 	MOVD	R0, g			// RegStackLimit4 (R28)
 
-	MOVD	R27, R1
-	ADD	$32, R1			// init routine
-	JMP	(R1)
+	MOVWU	·suspendPending(SB), R4
+	CBZ	R4, enter
+	MOVD	$0x07fffffffffffffe, R4	// suspend bit (zero) and stack limit
+	MOVD	R4, g
+
+enter:
+	MOVD	·hostLinkAddr(SB), LR
+	MOVD	R6, R27			// RegTextBase (global accesses clobber R27)
+	MOVD	R5, R0
+	JMP	(R3)			// init or resume routine
 
 // func importTrapHandler() uint64
 TEXT ·importTrapHandler(SB),$0-8
 	BL	after
 
 traphandler:
-	CMPW	$0, R0
-	BEQ	exittrap
-	ADDW	$100, R0
-	JMP	sysexit
-
-exittrap:
-	LSR	$32, R0			// exit code (higher 32 bits)
-sysexit:
-	MOVD	$94, R8			// exit_group syscall
-	SVC
-	BRK
+	MOVD	R29, R1			// RegFakeSP
+	MOVD	·execStackPtr(SB), R2
+	MOVD	R2, RSP
+	MOVD	·execFramePtr(SB), R29
+	MOVD	·execLinkAddr(SB), LR
+	MOVD	·execG(SB), g
+	MOVD	ZR, 56(RSP)		// hostCall
+	MOVD	R0, 64(RSP)		// result
+	MOVD	R1, 72(RSP)		// lastStackPtr
+	RET				// from exec
 
 after:	MOVD	LR, ret+0(FP)
 	RET
@@ -45,7 +60,61 @@ TEXT ·importGrowMemory(SB),$0-8
 	BL	after
 
 growmemory:
-	BRK				// TODO: implementation
+	MOVD	R27, R9			// RegTextBase (global accesses clobber R27)
+	MOVWU	R0, R3			// increment pages
+	MOVD	·memoryPages(SB), R4	// current pages
+	ADD	R3, R4, R5		// new pages
+	MOVD	·memoryLimitPages(SB), R6
+	CMP	R6, R5
+	BHI	outofmemory
+
+	LSL	$16, R4, R0
+	ADD	R26, R0			// mprotect addr
+	LSL	$16, R3, R1		// mprotect len
+	MOVD	$3, R2			// PROT_READ|PROT_WRITE
+	MOVD	$226, R8		// mprotect syscall
+	SVC
+	CBNZ	R0, outofmemory
+
+	MOVD	R5, ·memoryPages(SB)	// new pages
+	MOVWU	R4, R0			// old pages
+	B	resume
+
+outofmemory:
+	MOVD	$0xffffffff, R0		// -1
+resume:
+	MOVD	R9, R27
+	ADD	$16, R27, R1
+	B	(R1)
 
 after:	MOVD	LR, ret+0(FP)
 	RET
+
+// func importCurrentMemory() uint64
+TEXT ·importCurrentMemory(SB),$0-8
+	BL	after
+
+currentmemory:
+	MOVD	R27, R9			// RegTextBase (global accesses clobber R27)
+	MOVD	·memoryPages(SB), R0
+	MOVD	R9, R27
+	ADD	$16, R27, R1
+	B	(R1)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func hostCall()
+TEXT ·hostCall(SB),NOSPLIT,$0
+	// Host function number is in R1.
+	MOVD	LR, ·hostLinkAddr(SB)
+	MOVD	R29, R2			// RegFakeSP
+	MOVD	·execStackPtr(SB), R3
+	MOVD	R3, RSP
+	MOVD	·execFramePtr(SB), R29
+	MOVD	·execLinkAddr(SB), LR
+	MOVD	·execG(SB), g
+	MOVD	R1, 56(RSP)		// hostCall
+	MOVD	R0, 64(RSP)		// result
+	MOVD	R2, 72(RSP)		// lastStackPtr
+	RET				// from exec
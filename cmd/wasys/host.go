@@ -0,0 +1,210 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/tsavola/wag/wa"
+)
+
+// Host function numbers.  They are used also by host_*.s.
+const (
+	wasiArgsGet = iota + 1
+	wasiArgsSizesGet
+	wasiClockTimeGet
+	wasiEnvironGet
+	wasiEnvironSizesGet
+	wasiFdClose
+	wasiFdFdstatGet
+	wasiFdPrestatDirName
+	wasiFdPrestatGet
+	wasiFdRead
+	wasiFdSeek
+	wasiFdWrite
+	wasiPathOpen
+	wasiProcExit
+	wasiRandomGet
+	wasiSchedYield
+	envExit
+
+	numHostFuncs
+
+	hostInvokeReturn // Not an import function; see importInvokeReturn.
+	hostTraceBase    // Not an import function; see traceSyscalls.
+)
+
+func importWASIArgsGet() uint64
+func importWASIArgsSizesGet() uint64
+func importWASIClockTimeGet() uint64
+func importWASIEnvironGet() uint64
+func importWASIEnvironSizesGet() uint64
+func importWASIFdClose() uint64
+func importWASIFdFdstatGet() uint64
+func importWASIFdPrestatDirName() uint64
+func importWASIFdPrestatGet() uint64
+func importWASIFdRead() uint64
+func importWASIFdSeek() uint64
+func importWASIFdWrite() uint64
+func importWASIPathOpen() uint64
+func importWASIProcExit() uint64
+func importWASIRandomGet() uint64
+func importWASISchedYield() uint64
+func importWASINosys() uint64
+func importEnvExit() uint64
+
+type hostFunc struct {
+	module string
+	name   string
+	sig    wa.FuncType
+	impl   func(mem wasiMemory, args []uint64) wasiErrno
+}
+
+var hostFuncs = [numHostFuncs]hostFunc{
+	wasiArgsGet:          {wasiModule, "args_get", wasiSig(wa.I32, wa.I32), wasiArgsGetImpl},
+	wasiArgsSizesGet:     {wasiModule, "args_sizes_get", wasiSig(wa.I32, wa.I32), wasiArgsSizesGetImpl},
+	wasiClockTimeGet:     {wasiModule, "clock_time_get", wasiSig(wa.I32, wa.I64, wa.I32), wasiClockTimeGetImpl},
+	wasiEnvironGet:       {wasiModule, "environ_get", wasiSig(wa.I32, wa.I32), wasiEnvironGetImpl},
+	wasiEnvironSizesGet:  {wasiModule, "environ_sizes_get", wasiSig(wa.I32, wa.I32), wasiEnvironSizesGetImpl},
+	wasiFdClose:          {wasiModule, "fd_close", wasiSig(wa.I32), wasiFdCloseImpl},
+	wasiFdFdstatGet:      {wasiModule, "fd_fdstat_get", wasiSig(wa.I32, wa.I32), wasiFdFdstatGetImpl},
+	wasiFdPrestatDirName: {wasiModule, "fd_prestat_dir_name", wasiSig(wa.I32, wa.I32, wa.I32), wasiFdPrestatDirNameImpl},
+	wasiFdPrestatGet:     {wasiModule, "fd_prestat_get", wasiSig(wa.I32, wa.I32), wasiFdPrestatGetImpl},
+	wasiFdRead:           {wasiModule, "fd_read", wasiSig(wa.I32, wa.I32, wa.I32, wa.I32), wasiFdReadImpl},
+	wasiFdSeek:           {wasiModule, "fd_seek", wasiSig(wa.I32, wa.I64, wa.I32, wa.I32), wasiFdSeekImpl},
+	wasiFdWrite:          {wasiModule, "fd_write", wasiSig(wa.I32, wa.I32, wa.I32, wa.I32), wasiFdWriteImpl},
+	wasiPathOpen:         {wasiModule, "path_open", wasiSig(wa.I32, wa.I32, wa.I32, wa.I32, wa.I32, wa.I64, wa.I64, wa.I32, wa.I32), wasiPathOpenImpl},
+	wasiProcExit:         {wasiModule, "proc_exit", wa.FuncType{Params: []wa.Type{wa.I32}}, wasiProcExitImpl},
+	wasiRandomGet:        {wasiModule, "random_get", wasiSig(wa.I32, wa.I32), wasiRandomGetImpl},
+	wasiSchedYield:       {wasiModule, "sched_yield", wasiSig(), wasiSchedYieldImpl},
+	envExit:              {"env", "_exit", wa.FuncType{Params: []wa.Type{wa.I32}}, envExitImpl},
+}
+
+// Host functions which are also available to non-WASI programs via the env
+// module.  They have the same semantics as their WASI counterparts.
+var envHostFuncs = map[string]int{
+	"args_get":          wasiArgsGet,
+	"args_sizes_get":    wasiArgsSizesGet,
+	"environ_get":       wasiEnvironGet,
+	"environ_sizes_get": wasiEnvironSizesGet,
+}
+
+var hostVecBase int // Import vector index of host function number 0.
+
+// initHostFuncs extends the import vector with the host functions.
+func initHostFuncs() {
+	addrs := []uint64{
+		wasiArgsGet:          importWASIArgsGet(),
+		wasiArgsSizesGet:     importWASIArgsSizesGet(),
+		wasiClockTimeGet:     importWASIClockTimeGet(),
+		wasiEnvironGet:       importWASIEnvironGet(),
+		wasiEnvironSizesGet:  importWASIEnvironSizesGet(),
+		wasiFdClose:          importWASIFdClose(),
+		wasiFdFdstatGet:      importWASIFdFdstatGet(),
+		wasiFdPrestatDirName: importWASIFdPrestatDirName(),
+		wasiFdPrestatGet:     importWASIFdPrestatGet(),
+		wasiFdRead:           importWASIFdRead(),
+		wasiFdSeek:           importWASIFdSeek(),
+		wasiFdWrite:          importWASIFdWrite(),
+		wasiPathOpen:         importWASIPathOpen(),
+		wasiProcExit:         importWASIProcExit(),
+		wasiRandomGet:        importWASIRandomGet(),
+		wasiSchedYield:       importWASISchedYield(),
+		envExit:              importEnvExit(),
+		0:                    importWASINosys(), // Unused number.
+	}
+
+	vec := make([]byte, len(addrs)*8+len(importVector))
+	copy(vec[len(addrs)*8:], importVector)
+
+	hostVecBase = -len(importVector)/8 - 1
+
+	for num, addr := range addrs {
+		binary.LittleEndian.PutUint64(vec[len(vec)+(hostVecBase-num)*8:], addr)
+	}
+
+	importVector = vec
+}
+
+// resolveHostFunc looks up a function implemented in Go.
+func resolveHostFunc(module, field string, sig wa.FuncType) (index int, found bool, err error) {
+	for num := 1; num < numHostFuncs; num++ {
+		if f := &hostFuncs[num]; (f.module == module || module == "env" && envHostFuncs[field] == num) && f.name == field {
+			if !f.sig.Equal(sig) {
+				err = fmt.Errorf("%s function %s has wrong signature: %s (should be %s)", module, field, sig, f.sig)
+				return
+			}
+
+			index = hostVecBase - num
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+// callHost invokes a host function or a traced syscall.  Arguments are read
+// from the program's stack.
+func callHost(num uint64, stack []byte) (result uint64) {
+	if num >= hostTraceBase && num < hostTraceBase+uint64(len(traceSyscalls)) {
+		return callTracedSyscall(int(num-hostTraceBase), stack)
+	}
+
+	if num >= numHostFuncs || hostFuncs[num].impl == nil {
+		panic(fmt.Errorf("invalid host function number: %d", num))
+	}
+	f := &hostFuncs[num]
+
+	args := readHostArgs(stack, len(f.sig.Params))
+
+	if tracing && (num == wasiProcExit || num == envExit) {
+		traceHostCall(f, args, "?")
+	}
+
+	defer func() {
+		if x := recover(); x != nil {
+			errno, ok := x.(wasiErrno)
+			if !ok {
+				panic(x)
+			}
+			result = uint64(errno)
+		}
+
+		if tracing {
+			traceHostCall(f, args, formatWASIErrno(wasiErrno(result)))
+		}
+	}()
+
+	result = uint64(f.impl(linearMemory(), args))
+	return
+}
+
+// readHostArgs from the program's stack.  The last argument is at the top.
+func readHostArgs(stack []byte, count int) (args []uint64) {
+	args = make([]uint64, count)
+	for i := range args {
+		args[i] = binary.LittleEndian.Uint64(stack[(len(args)-1-i)*8:])
+	}
+	return
+}
+
+// linearMemory gets the currently accessible linear memory.
+func linearMemory() wasiMemory {
+	var mem []byte
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&mem))
+	h.Data = memoryAddr
+	h.Len = int(memoryPages << wa.PageBits)
+	h.Cap = h.Len
+	return wasiMemory(mem)
+}
+
+func envExitImpl(mem wasiMemory, args []uint64) wasiErrno {
+	exitProcess(int(int32(args[0])))
+	panic("unreachable")
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+#define HOSTFUNC(NAME, STUB, NUM) \
+	TEXT NAME(SB),$0-8; \
+	LEAQ	STUB(SB), AX; \
+	MOVQ	AX, ret+0(FP); \
+	RET; \
+	TEXT STUB(SB),NOSPLIT,$0; \
+	MOVL	$NUM, CX; \
+	JMP	·hostCall(SB)
+
+HOSTFUNC(·importWASIArgsGet, wasiArgsGet<>, const_wasiArgsGet)
+HOSTFUNC(·importWASIArgsSizesGet, wasiArgsSizesGet<>, const_wasiArgsSizesGet)
+HOSTFUNC(·importWASIClockTimeGet, wasiClockTimeGet<>, const_wasiClockTimeGet)
+HOSTFUNC(·importWASIEnvironGet, wasiEnvironGet<>, const_wasiEnvironGet)
+HOSTFUNC(·importWASIEnvironSizesGet, wasiEnvironSizesGet<>, const_wasiEnvironSizesGet)
+HOSTFUNC(·importWASIFdClose, wasiFdClose<>, const_wasiFdClose)
+HOSTFUNC(·importWASIFdFdstatGet, wasiFdFdstatGet<>, const_wasiFdFdstatGet)
+HOSTFUNC(·importWASIFdPrestatDirName, wasiFdPrestatDirName<>, const_wasiFdPrestatDirName)
+HOSTFUNC(·importWASIFdPrestatGet, wasiFdPrestatGet<>, const_wasiFdPrestatGet)
+HOSTFUNC(·importWASIFdRead, wasiFdRead<>, const_wasiFdRead)
+HOSTFUNC(·importWASIFdSeek, wasiFdSeek<>, const_wasiFdSeek)
+HOSTFUNC(·importWASIFdWrite, wasiFdWrite<>, const_wasiFdWrite)
+HOSTFUNC(·importWASIPathOpen, wasiPathOpen<>, const_wasiPathOpen)
+HOSTFUNC(·importWASIProcExit, wasiProcExit<>, const_wasiProcExit)
+HOSTFUNC(·importWASIRandomGet, wasiRandomGet<>, const_wasiRandomGet)
+HOSTFUNC(·importWASISchedYield, wasiSchedYield<>, const_wasiSchedYield)
+HOSTFUNC(·importEnvExit, envExit<>, const_envExit)
+
+// func importInvokeReturn() uint64
+TEXT ·importInvokeReturn(SB),$0-8
+	LEAQ	invokeReturn<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT invokeReturn<>(SB),NOSPLIT,$0
+	MOVQ	X0, ·invokeFloatResult(SB)
+	MOVL	$const_hostInvokeReturn, CX
+	JMP	·hostCall(SB)
+
+// func importWASINosys() uint64
+TEXT ·importWASINosys(SB),$0-8
+	LEAQ	wasiNosys<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT wasiNosys<>(SB),NOSPLIT,$0
+	MOVL	$52, AX			// ENOSYS
+	MOVQ	R15, DX
+	ADDQ	$16, DX
+	JMP	DX
@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+#define HOSTFUNC(NAME, NUM) \
+	TEXT NAME(SB),$0-8; \
+	BL	3(PC); \
+	MOVD	$NUM, R1; \
+	JMP	·hostCall(SB); \
+	MOVD	LR, ret+0(FP); \
+	RET
+
+HOSTFUNC(·importWASIArgsGet, const_wasiArgsGet)
+HOSTFUNC(·importWASIArgsSizesGet, const_wasiArgsSizesGet)
+HOSTFUNC(·importWASIClockTimeGet, const_wasiClockTimeGet)
+HOSTFUNC(·importWASIEnvironGet, const_wasiEnvironGet)
+HOSTFUNC(·importWASIEnvironSizesGet, const_wasiEnvironSizesGet)
+HOSTFUNC(·importWASIFdClose, const_wasiFdClose)
+HOSTFUNC(·importWASIFdFdstatGet, const_wasiFdFdstatGet)
+HOSTFUNC(·importWASIFdPrestatDirName, const_wasiFdPrestatDirName)
+HOSTFUNC(·importWASIFdPrestatGet, const_wasiFdPrestatGet)
+HOSTFUNC(·importWASIFdRead, const_wasiFdRead)
+HOSTFUNC(·importWASIFdSeek, const_wasiFdSeek)
+HOSTFUNC(·importWASIFdWrite, const_wasiFdWrite)
+HOSTFUNC(·importWASIPathOpen, const_wasiPathOpen)
+HOSTFUNC(·importWASIProcExit, const_wasiProcExit)
+HOSTFUNC(·importWASIRandomGet, const_wasiRandomGet)
+HOSTFUNC(·importWASISchedYield, const_wasiSchedYield)
+HOSTFUNC(·importEnvExit, const_envExit)
+
+// func importInvokeReturn() uint64
+TEXT ·importInvokeReturn(SB),$0-8
+	BL	after
+
+invokereturn:
+	FMOVD	F0, ·invokeFloatResult(SB)
+	MOVD	$const_hostInvokeReturn, R1
+	JMP	·hostCall(SB)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func importWASINosys() uint64
+TEXT ·importWASINosys(SB),$0-8
+	BL	after
+
+nosys:
+	MOVD	$52, R0			// ENOSYS
+	MOVD	R27, R1
+	ADD	$16, R1
+	B	(R1)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
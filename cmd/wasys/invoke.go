@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/wa"
+)
+
+// Invoked function returns to this stub instead of the init routine, so that
+// the full result value is available.  Floating-point result register is
+// stored in invokeFloatResult.
+func importInvokeReturn() uint64
+
+var invokeFloatResult uint64
+
+// getInvokeFunc is an entry policy which accepts any signature.
+func getInvokeFunc(m *compile.Module, name string) (funcIndex uint32, sig wa.FuncType, err error) {
+	funcIndex, sig, found := m.ExportFunc(name)
+	if !found {
+		err = fmt.Errorf("export function %q not found", name)
+	}
+	return
+}
+
+// parseInvokeArgs converts literals to the function's parameter types.
+func parseInvokeArgs(sig wa.FuncType, literals []string) (args []uint64, err error) {
+	if len(literals) != len(sig.Params) {
+		err = fmt.Errorf("function %s takes %d arguments (%d given)", sig, len(sig.Params), len(literals))
+		return
+	}
+
+	args = make([]uint64, len(literals))
+
+	for i, s := range literals {
+		t := sig.Params[i]
+		bits := int(t.Size()) * 8
+
+		switch t.Category() {
+		case wa.Int:
+			var n int64
+			if n, err = strconv.ParseInt(s, 0, bits); err != nil {
+				var u uint64
+				if u, err = strconv.ParseUint(s, 0, bits); err != nil {
+					err = fmt.Errorf("argument %d: invalid %s literal: %q", i, t, s)
+					return
+				}
+				n = int64(u)
+			}
+			if bits == 32 {
+				args[i] = uint64(uint32(n))
+			} else {
+				args[i] = uint64(n)
+			}
+
+		case wa.Float:
+			var x float64
+			if x, err = strconv.ParseFloat(s, bits); err != nil {
+				err = fmt.Errorf("argument %d: invalid %s literal: %q", i, t, s)
+				return
+			}
+			if bits == 32 {
+				args[i] = uint64(math.Float32bits(float32(x)))
+			} else {
+				args[i] = math.Float64bits(x)
+			}
+		}
+	}
+
+	return
+}
+
+// formatInvokeResult formats the result register value of an invoked
+// function.
+func formatInvokeResult(t wa.Type, result, floatResult uint64) string {
+	switch t {
+	case wa.I32:
+		return strconv.FormatInt(int64(int32(result)), 10)
+
+	case wa.I64:
+		return strconv.FormatInt(int64(result), 10)
+
+	case wa.F32:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(floatResult))), 'g', -1, 32)
+
+	case wa.F64:
+		return strconv.FormatFloat(math.Float64frombits(floatResult), 'g', -1, 64)
+
+	default:
+		return ""
+	}
+}
@@ -7,23 +7,30 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"syscall"
 	"unsafe"
 
 	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
 	"github.com/tsavola/wag/buffer"
 	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/memory"
+	"github.com/tsavola/wag/object/abi"
 	"github.com/tsavola/wag/object/debug/dump"
+	"github.com/tsavola/wag/object/stack"
+	"github.com/tsavola/wag/object/stack/stacktrace"
+	"github.com/tsavola/wag/trap"
 	"github.com/tsavola/wag/wa"
 )
 
-const linearMemoryAddressSpace = 8 * 1024 * 1024 * 1024
 const signalStackReserve = 8192
 
 var (
@@ -42,11 +49,41 @@ var (
 
 type resolver struct{}
 
-func (resolver) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+func (r resolver) ResolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
 	if verbose {
 		log.Printf("import %s%s", field, sig)
 	}
 
+	if !importAllowed(module, field) {
+		err = fmt.Errorf("import function not allowed by policy: %s %s", module, field)
+		return
+	}
+
+	index, err = r.resolveFunc(module, field, sig)
+	if err == nil {
+		bindSyscalls(module, field, index)
+	}
+	return
+}
+
+func (resolver) resolveFunc(module, field string, sig wa.FuncType) (index int, err error) {
+	if standalone {
+		if module == wasiModule {
+			err = fmt.Errorf("WASI is not supported by standalone executables: %s", field)
+			return
+		}
+	} else {
+		if module == wasiModule {
+			return resolveWASIFunc(field, sig)
+		}
+
+		var found bool
+		index, found, err = resolveHostFunc(module, field, sig)
+		if found || err != nil {
+			return
+		}
+	}
+
 	if module != "env" {
 		err = fmt.Errorf("import function's module is unknown: %s %s", module, field)
 		return
@@ -63,6 +100,9 @@ func (resolver) ResolveFunc(module, field string, sig wa.FuncType) (index int, e
 	}
 
 	index = i.index
+	if tracing {
+		index = bindTraceSyscall(field, sig)
+	}
 	return
 }
 
@@ -71,6 +111,17 @@ func (resolver) ResolveGlobal(module, field string, t wa.Type) (init uint64, err
 	return
 }
 
+type stringList []string
+
+func (list *stringList) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *stringList) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
 func makeMem(size int, prot, extraFlags int) (mem []byte, err error) {
 	if size > 0 {
 		mem, err = syscall.Mmap(-1, 0, size, prot, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS|extraFlags)
@@ -90,7 +141,7 @@ func main() {
 	log.SetFlags(0)
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] wasmfile\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] wasmfile [arg...]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		flag.PrintDefaults()
 	}
@@ -100,21 +151,100 @@ func main() {
 		stackSize = wa.PageSize
 		entry     = "main"
 		dumpText  = false
+		guardSize = 0
+		dirs      []string
+		envNames  []string
+		policy    string
+		invoke    string
+		output    string
+		snapFile  string
+		resume    string
+		debugFile string
 	)
 
 	flag.BoolVar(&verbose, "v", verbose, "verbose logging")
+	flag.BoolVar(&tracing, "trace", tracing, "log import function calls")
 	flag.IntVar(&textSize, "textsize", textSize, "maximum program text size")
 	flag.IntVar(&stackSize, "stacksize", stackSize, "call stack size")
 	flag.StringVar(&entry, "entry", entry, "function to run")
+	flag.StringVar(&invoke, "invoke", invoke, "function to call with the arguments and print its result")
+	flag.StringVar(&output, "o", output, "write a standalone executable instead of running the program")
+	flag.StringVar(&snapFile, "snapshot", snapFile, "file to write when the program is suspended by SIGUSR1 (default wasmfile.snap; created in advance if -policy is specified)")
+	flag.StringVar(&resume, "resume", resume, "snapshot file to resume the program from")
 	flag.BoolVar(&dumpText, "dumptext", dumpText, "disassemble the generated code to stdout")
+	flag.StringVar(&debugFile, "debugfile", debugFile, "write symbols and source line information of the loaded code to a file (for gdb's add-symbol-file)")
+	flag.IntVar(&guardSize, "guardsize", guardSize, "memory guard region size (nonzero value enables explicit bounds checks)")
+	flag.Var((*stringList)(&dirs), "dir", "preopened directory for WASI program (may be repeated)")
+	flag.Var(policyList{}, "allow", "comma-separated import functions which may be bound (may be repeated)")
+	flag.StringVar(&policy, "policy", policy, "file listing import functions which may be bound")
+	flag.Var((*stringList)(&envNames), "env", "environment variable NAME or NAME=VALUE to forward to the program (may be repeated)")
 	flag.Parse()
 
-	if flag.NArg() != 1 {
+	if flag.NArg() < 1 {
 		flag.Usage()
 		os.Exit(2)
 	}
 	filename := flag.Arg(0)
 
+	entrySet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "entry" {
+			entrySet = true
+		}
+	})
+
+	if policy != "" {
+		if err := loadPolicy(policy); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if output != "" {
+		if invoke != "" {
+			log.Fatal("-invoke and -o cannot be used together")
+		}
+		standalone = true
+	}
+
+	if tracing && standalone {
+		log.Fatal("-trace and -o cannot be used together")
+	}
+
+	var runtime *standaloneRuntime
+	if standalone {
+		var err error
+		if runtime, err = newStandaloneRuntime(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if resume != "" && (invoke != "" || standalone) {
+		log.Fatal("-resume cannot be used with -invoke or -o")
+	}
+	if snapFile == "" {
+		snapFile = filename + ".snap"
+	}
+
+	if invoke != "" {
+		entry = invoke
+		progArgs = flag.Args()[:1]
+	} else {
+		progArgs = flag.Args()
+	}
+	progEnviron = selectEnviron(envNames)
+
+	for _, dir := range dirs {
+		if err := preopenWASIDir(dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if !standalone {
+		initHostFuncs()
+	}
+	if tracing {
+		initTraceFuncs()
+	}
+
 	prog, err := ioutil.ReadFile(filename)
 	if err != nil {
 		log.Fatal(err)
@@ -135,11 +265,50 @@ func main() {
 	textAddr := memAddr(textMem)
 	textBuf := buffer.NewStatic(textMem[:0], len(textMem))
 
+	var (
+		entryType wa.FuncType
+		entryArgs []uint64
+	)
+
 	config := &wag.Config{
 		Text:            textBuf,
 		MemoryAlignment: os.Getpagesize(),
 		Entry:           entry,
+		BoundsChecks:    guardSize != 0,
+		DebugInfo:       true,
+	}
+
+	// Entry arguments depend on the signature, so they are resolved by the
+	// policy before Compile checks them.  Command-line arguments and
+	// environment variables are not passed to the entry function; its
+	// parameters (if any) are zero unless it is invoked.
+
+	config.EntryPolicy = func(m *compile.Module, symbol string) (index uint32, sig wa.FuncType, err error) {
+		if invoke != "" {
+			index, sig, err = getInvokeFunc(m, symbol)
+		} else {
+			policy := binding.GetMainFunc
+			if !entrySet {
+				// WASI programs are started via _start.
+				policy = binding.GetFirstFunc(nil, "_start", symbol)
+			}
+			index, sig, err = policy(m, symbol)
+		}
+		if err != nil {
+			return
+		}
+
+		entryType = sig
+
+		if invoke != "" {
+			entryArgs, err = parseInvokeArgs(sig, flag.Args()[1:])
+		} else {
+			entryArgs = make([]uint64, len(sig.Params))
+		}
+		config.EntryArgs = entryArgs
+		return
 	}
+
 	obj, err := wag.Compile(config, progReader, resolver{})
 	if dumpText && len(obj.Text) > 0 {
 		e := dump.Text(os.Stdout, obj.Text, textAddr, obj.FuncAddrs, &obj.Names)
@@ -151,21 +320,50 @@ func main() {
 		log.Fatal(err)
 	}
 
-	setImportVectorCurrentMemory(obj.InitialMemorySize)
+	if debugFile != "" && !standalone {
+		if err := writeDebugFile(debugFile, obj, textAddr); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	globalsMemory, err := makeMem(obj.MemoryOffset+linearMemoryAddressSpace, syscall.PROT_NONE, 0)
-	if err != nil {
-		log.Fatal(err)
+	if standalone {
+		if err := writeStandalone(output, runtime, obj, entryType); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	err = syscall.Mprotect(globalsMemory[:obj.MemoryOffset+obj.InitialMemorySize], syscall.PROT_READ|syscall.PROT_WRITE)
+	var (
+		memSize = obj.InitialMemorySize
+		snap    *snapshot
+	)
+
+	if resume != "" {
+		snap, err = readSnapshot(resume, prog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(snap.globals) != obj.MemoryOffset {
+			log.Fatal("snapshot doesn't match the compiled program")
+		}
+		memSize = len(snap.memory)
+	}
+
+	mem, err := memory.Reserve(obj.MemoryOffset, memSize, obj.MemorySizeLimit, guardSize)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	copy(globalsMemory, obj.GlobalsMemory)
+	if snap != nil {
+		copy(mem.GlobalsMemory(), snap.globals)
+		copy(mem.GlobalsMemory()[obj.MemoryOffset:], snap.memory)
+	} else {
+		copy(mem.GlobalsMemory(), obj.GlobalsMemory)
+	}
 
-	memoryAddr := memAddr(globalsMemory) + uintptr(obj.MemoryOffset)
+	memoryPages = uint64(mem.Size() >> wa.PageBits)
+	memoryLimitPages = uint64(mem.SizeLimit() >> wa.PageBits)
+	memoryAddr = mem.MemoryAddr()
 
 	if err := syscall.Mprotect(vecMem, syscall.PROT_READ); err != nil {
 		log.Fatal(err)
@@ -179,16 +377,142 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	stackOffset := stackSize - len(obj.StackFrame)
-	copy(stackMem[stackOffset:], obj.StackFrame)
+	entryFuncAddr := uint32(binary.LittleEndian.Uint64(obj.StackFrame)) // Zero if no entry.
+
+	// Invoked function is called directly after the init routine has run
+	// the start function.
+
+	// Resumed program's call stack is placed at the end of the stack, and it
+	// is entered via the resume routine.
+
+	var (
+		stackOffset int
+		enterAddr   = textAddr + abi.TextAddrStart
+	)
+
+	if snap != nil {
+		callStack, err := stack.Import(snap.stack, uint64(textAddr), &obj.CallMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(callStack) > stackSize {
+			log.Fatal("stack is too small for resuming program")
+		}
+		stackOffset = stackSize - copy(stackMem[stackSize-len(callStack):], callStack)
+		enterAddr = textAddr + abi.TextAddrResume
+	} else if invoke != "" {
+		stackOffset = stackSize - stack.SetupEntryFrame(stackMem, 0, nil)
+	} else {
+		stackOffset = stackSize - stack.SetupEntryFrame(stackMem, entryFuncAddr, entryArgs)
+	}
 
 	stackAddr := memAddr(stackMem)
 	stackLimit := stackAddr + signalStackReserve
-	stackPtr := stackAddr + uintptr(stackOffset)
 
-	if stackLimit >= stackPtr {
+	if stackLimit >= stackAddr+uintptr(stackOffset) {
 		log.Fatal("stack is too small for starting program")
 	}
 
-	exec(textAddr, stackLimit, memoryAddr, stackPtr)
+	if invoke == "" {
+		if err := installSuspendHandler(stackMem); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if importPolicy != nil {
+		if invoke == "" {
+			if err := openSnapshot(snapFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := installSeccomp(); err != nil {
+			removeUnusedSnapshot()
+			log.Fatal(err)
+		}
+	}
+
+	// Host function calls return from exec; the program is resumed by
+	// entering it again.
+
+	run := func(entryAddr uintptr, stackOffset int) (hostCall, result uint64, callStack []byte) {
+		var (
+			stackPtr = stackAddr + uintptr(stackOffset)
+			value    uint64
+		)
+
+		for {
+			hostCall, result, lastStackPtr := exec(textAddr, stackLimit, memoryAddr, stackPtr, entryAddr, value)
+
+			offset := lastStackPtr - stackAddr
+			if offset > uintptr(len(stackMem)) {
+				log.Fatalf("stack pointer 0x%x is out of bounds", lastStackPtr)
+			}
+
+			if hostCall == 0 || hostCall == hostInvokeReturn {
+				return hostCall, result, stackMem[offset:]
+			}
+
+			value = callHost(hostCall, stackMem[offset+stackArgsOffset:])
+			entryAddr = textAddr + abi.TextAddrResume
+			stackPtr = lastStackPtr
+		}
+	}
+
+	_, result, callStack := run(enterAddr, stackOffset)
+	if suspended(result) {
+		globals := mem.GlobalsMemory()[:obj.MemoryOffset]
+		if err := writeSnapshot(snapFile, prog, obj, textAddr, globals, linearMemory(), callStack); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%s; snapshot written to %s", trap.Suspended, snapFile)
+		os.Exit(100 + int(trap.Suspended))
+	}
+	if invoke == "" || trap.ID(uint32(result)) != trap.Exit {
+		exitOrTrap(obj, textAddr, callStack, result, entryType, false)
+	}
+
+	stackOffset = setupInvokeFrame(stackMem, importInvokeReturn(), entryArgs)
+
+	hostCall, result, callStack := run(textAddr+uintptr(entryFuncAddr), stackOffset)
+	if hostCall == 0 {
+		exitOrTrap(obj, textAddr, callStack, result, wa.FuncType{}, true)
+	}
+
+	if entryType.Result != wa.Void {
+		fmt.Println(formatInvokeResult(entryType.Result, result, invokeFloatResult))
+	}
+}
+
+func exitOrTrap(obj *wag.Object, textAddr uintptr, callStack []byte, result uint64, entryType wa.FuncType, invoked bool) {
+	if id := trap.ID(uint32(result)); id != trap.Exit {
+		log.Print(id)
+		printStacktrace(obj, textAddr, callStack, invoked)
+		exitProcess(100 + int(id))
+	}
+
+	// Entry function's i32 result is the exit status.
+	if entryType.Result == wa.Void {
+		exitProcess(0)
+	}
+	exitProcess(int(int32(result >> 32)))
+}
+
+// printStacktrace of a trapped program.  The bottom frame of an invoked
+// function doesn't return to the init routine, so the trace is incomplete.
+func printStacktrace(obj *wag.Object, textAddr uintptr, callStack []byte, invoked bool) {
+	frames, err := stack.Trace(callStack, uint64(textAddr), obj.InsnMap, nil)
+	if err != nil && !(invoked && len(frames) > 0) {
+		log.Printf("stacktrace: %v", err)
+		return
+	}
+
+	debugInfo, err := obj.Debug.DWARF()
+	if err != nil {
+		log.Printf("DWARF: %v", err)
+	}
+
+	if err := stacktrace.Fprint(os.Stderr, frames, obj.FuncTypes, &obj.Names, debugInfo); err != nil {
+		log.Print(err)
+	}
 }
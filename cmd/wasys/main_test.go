@@ -0,0 +1,108 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Exports add(i32, i32) i32.
+const testAddModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x07\x01\x60\x02\x7f\x7f\x01\x7f\x03\x02\x01\x00\x07\x07\x01\x03\x61\x64\x64\x00\x00\x0a\x09\x01\x07\x00\x20\x00\x20\x01\x6a\x0b"
+
+// The test binary runs itself as wasys when this variable is set.
+const testMainEnv = "WASYS_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testMainEnv) != "" {
+		os.Args = append([]string{"wasys"}, os.Args[1:]...)
+		main()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func runWasys(t *testing.T, args ...string) (output string, status int) {
+	t.Helper()
+
+	cmd := osexec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), testMainEnv+"=1")
+
+	b, err := cmd.CombinedOutput()
+	if err != nil {
+		exit, ok := err.(*osexec.ExitError)
+		if !ok {
+			t.Fatal(err)
+		}
+		status = exit.ExitCode()
+	}
+
+	output = string(b)
+	return
+}
+
+func writeTestModule(t *testing.T, module string) (filename string, cleanup func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "wasys-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename = filepath.Join(dir, "test.wasm")
+	if err := ioutil.WriteFile(filename, []byte(module), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	cleanup = func() { os.RemoveAll(dir) }
+	return
+}
+
+func TestInvokeParams(t *testing.T) {
+	filename, cleanup := writeTestModule(t, testAddModule)
+	defer cleanup()
+
+	output, status := runWasys(t, "-invoke", "add", filename, "1", "2")
+	if status != 0 || strings.TrimSpace(output) != "3" {
+		t.Errorf("status %d, output: %q", status, output)
+	}
+
+	output, status = runWasys(t, "-invoke", "add", filename, "1")
+	if status == 0 {
+		t.Errorf("argument count mismatch was accepted; output: %q", output)
+	}
+}
+
+func TestEntryParams(t *testing.T) {
+	filename, cleanup := writeTestModule(t, testAddModule)
+	defer cleanup()
+
+	// Parameters are zero, so the exit status is zero.
+	output, status := runWasys(t, "-entry", "add", filename)
+	if status != 0 {
+		t.Errorf("status %d, output: %q", status, output)
+	}
+}
+
+func TestUnusedSnapshotRemoved(t *testing.T) {
+	filename, cleanup := writeTestModule(t, testAddModule)
+	defer cleanup()
+
+	// Snapshot file is created in advance when there is a policy.
+	output, status := runWasys(t, "-allow", "", "-entry", "add", filename)
+	if status != 0 {
+		t.Errorf("status %d, output: %q", status, output)
+	}
+
+	if _, err := os.Stat(filename + ".snap"); !os.IsNotExist(err) {
+		t.Errorf("snapshot file: %v", err)
+	}
+}
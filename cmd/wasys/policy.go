@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// importPolicy lists the import functions which a program may bind.  An
+// entry is a function name of the env module, "module.name" for other
+// modules, or "module.*" for all functions of a module.  All imports are
+// allowed if the policy is nil.
+var importPolicy map[string]bool
+
+// Syscalls which may be made by the process after the program has been
+// bound.  Initialized with runtimeSyscalls; see installSeccomp.
+var boundSyscalls = make(map[uintptr]bool)
+
+// Syscalls made by host functions (in addition to runtimeSyscalls).
+var hostFuncSyscalls = map[int][]uintptr{
+	wasiFdFdstatGet: {syscall.SYS_FSTAT},
+	wasiFdSeek:      {syscall.SYS_LSEEK},
+	wasiPathOpen:    {sysOpenat2},
+}
+
+type policyList struct{}
+
+func (policyList) String() string {
+	return ""
+}
+
+// Set adds comma-separated entries to the policy.
+func (policyList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		allowImport(name)
+	}
+	return nil
+}
+
+func allowImport(name string) {
+	if importPolicy == nil {
+		importPolicy = make(map[string]bool)
+	}
+	if name = strings.TrimSpace(name); name != "" {
+		importPolicy[name] = true
+	}
+}
+
+// loadPolicy reads policy entries from a file, one per line.  Empty lines and
+// lines starting with # are ignored.
+func loadPolicy(filename string) (err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	allowImport("") // Empty file denies everything.
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := s.Text(); !strings.HasPrefix(line, "#") {
+			allowImport(line)
+		}
+	}
+	return s.Err()
+}
+
+func importAllowed(module, field string) bool {
+	if importPolicy == nil {
+		return true
+	}
+	if module == "env" && importPolicy[field] {
+		return true
+	}
+	return importPolicy[module+"."+field] || importPolicy[module+".*"]
+}
+
+// bindSyscalls records the syscalls needed by an import function which has
+// been resolved to the given import vector index.
+func bindSyscalls(module, field string, index int) {
+	if module == "env" {
+		if num, found := importSyscallNumbers[field]; found && (importFuncs[field].index == index || tracing && traceSyscallIndex(field) == index) {
+			boundSyscalls[num] = true
+		}
+	}
+
+	if num := hostVecBase - index; num > 0 && num < numHostFuncs {
+		for _, sysnum := range hostFuncSyscalls[num] {
+			boundSyscalls[sysnum] = true
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	seccompRetKillProcess = 0x80000000
+	seccompRetErrno       = 0x00050000
+	seccompRetAllow       = 0x7fff0000
+
+	seccompDataNr   = 0 // Offset of seccomp_data.nr.
+	seccompDataArch = 4 // Offset of seccomp_data.arch.
+
+	prSetNoNewPrivs = 38
+)
+
+// Syscalls which may be made by the Go runtime and the host functions after
+// the filter has been installed.
+var runtimeSyscalls = append([]uintptr{
+	syscall.SYS_CLOCK_GETTIME,
+	syscall.SYS_CLOCK_NANOSLEEP,
+	syscall.SYS_CLONE,
+	syscall.SYS_CLOSE,
+	syscall.SYS_EPOLL_CREATE1,
+	syscall.SYS_EPOLL_CTL,
+	syscall.SYS_EPOLL_PWAIT,
+	syscall.SYS_EXIT,
+	syscall.SYS_EXIT_GROUP,
+	syscall.SYS_FCNTL,
+	syscall.SYS_FUTEX,
+	syscall.SYS_GETPID,
+	syscall.SYS_GETTID,
+	syscall.SYS_MADVISE,
+	syscall.SYS_MINCORE,
+	syscall.SYS_MMAP,
+	syscall.SYS_MPROTECT,
+	syscall.SYS_MUNMAP,
+	syscall.SYS_NANOSLEEP,
+	syscall.SYS_PIPE2,
+	syscall.SYS_READ,
+	syscall.SYS_RT_SIGACTION,
+	syscall.SYS_RT_SIGPROCMASK,
+	syscall.SYS_RT_SIGRETURN,
+	syscall.SYS_SCHED_GETAFFINITY,
+	syscall.SYS_SCHED_YIELD,
+	syscall.SYS_SETITIMER,
+	syscall.SYS_SIGALTSTACK,
+	syscall.SYS_TGKILL,
+	syscall.SYS_TIMER_CREATE,
+	syscall.SYS_TIMER_DELETE,
+	syscall.SYS_TIMER_SETTIME,
+	syscall.SYS_WRITE,
+}, archRuntimeSyscalls...)
+
+// installSeccomp restricts the syscalls of all threads to runtimeSyscalls and
+// the syscalls of the bound import functions.  Other syscalls fail with
+// EPERM.  The filter can't be removed.
+func installSeccomp() (err error) {
+	for _, num := range runtimeSyscalls {
+		boundSyscalls[num] = true
+	}
+
+	var nums []int
+	for num := range boundSyscalls {
+		nums = append(nums, int(num))
+	}
+	sort.Ints(nums)
+
+	if len(nums) > 255 {
+		err = fmt.Errorf("too many syscalls for seccomp filter: %d", len(nums))
+		return
+	}
+
+	filter := []syscall.SockFilter{
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataArch),
+		bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, auditArch, 1, 0),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillProcess),
+		bpfStmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, seccompDataNr),
+	}
+
+	for i, num := range nums {
+		skip := uint8(len(nums) - i) // Jump to allow.
+		filter = append(filter, bpfJump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, uint32(num), skip, 0))
+	}
+
+	filter = append(filter,
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetErrno|uint32(syscall.EPERM)),
+		bpfStmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+	)
+
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		err = fmt.Errorf("prctl: %v", errno)
+		return
+	}
+
+	tid, _, errno := syscall.Syscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		err = fmt.Errorf("seccomp: %v", errno)
+		return
+	}
+	if tid != 0 {
+		err = fmt.Errorf("seccomp: thread %d could not be synchronized", tid)
+		return
+	}
+
+	return
+}
+
+func bpfStmt(code uint16, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/object/stack"
+	"github.com/tsavola/wag/trap"
+)
+
+var snapshotMagic = [8]byte{'w', 'a', 's', 'y', 's', 'n', 'a', 'p'}
+
+// Snapshot file starts with a header.  It is followed by globals, linear
+// memory and the portable call stack.
+type snapshotHeader struct {
+	Magic        [8]byte
+	ModuleHash   [sha256.Size]byte
+	MemoryOffset uint64 // Size of globals.
+	MemorySize   uint64
+	StackSize    uint64
+}
+
+type snapshot struct {
+	globals []byte
+	memory  []byte
+	stack   []byte // Portable.
+}
+
+// These are accessed by the suspend signal handler.
+var (
+	suspendPending    uint32  // Set by signal handler, checked by exec.
+	suspendThreadID   int32   // Thread which executes the program.
+	suspendStackBegin uintptr // The program's stack (including signal reserve).
+	suspendStackEnd   uintptr
+)
+
+func suspendHandler() uint64
+func sigreturn() uint64 // Zero if not needed.
+
+// installSuspendHandler makes SIGUSR1 suspend the program.  The signal
+// handler sets the suspend bit (or the pending flag) of the thread which
+// executes the program; the program traps as soon as it reaches a loop or a
+// function call.  It must be called on the thread which executes the program;
+// the thread is locked.
+func installSuspendHandler(stackMem []byte) (err error) {
+	runtime.LockOSThread()
+
+	suspendThreadID = int32(syscall.Gettid())
+	suspendStackBegin = memAddr(stackMem)
+	suspendStackEnd = suspendStackBegin + uintptr(len(stackMem))
+
+	act := sigaction{
+		handler:  uintptr(suspendHandler()),
+		flags:    saSiginfo | saOnstack | saRestart,
+		restorer: uintptr(sigreturn()),
+	}
+	if act.restorer != 0 {
+		act.flags |= saRestorer
+	}
+
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_RT_SIGACTION, uintptr(syscall.SIGUSR1), uintptr(unsafe.Pointer(&act)), 0, unsafe.Sizeof(act.mask), 0, 0)
+	if errno != 0 {
+		err = fmt.Errorf("rt_sigaction: %v", errno)
+	}
+	return
+}
+
+const (
+	saSiginfo  = 0x4
+	saOnstack  = 0x08000000
+	saRestart  = 0x10000000
+	saRestorer = 0x04000000
+)
+
+type sigaction struct {
+	handler  uintptr
+	flags    uint64
+	restorer uintptr
+	mask     uint64
+}
+
+// suspended checks if the program trapped because of a suspend signal.  The
+// suspend bit is also interpreted as call stack exhaustion.
+func suspended(result uint64) bool {
+	if atomic.LoadUint32(&suspendPending) == 0 {
+		return false
+	}
+
+	switch trap.ID(uint32(result)) {
+	case trap.Suspended, trap.CallStackExhausted:
+		return true
+	}
+	return false
+}
+
+// Snapshot file which was opened before the seccomp filter was installed.
+var (
+	snapshotFile    *os.File
+	snapshotCreated bool // The file didn't exist and nothing has been written.
+)
+
+// openSnapshot creates the snapshot file in advance, so that it can be written
+// when opening files is denied by the seccomp filter.  The file is truncated
+// only when a snapshot is written.  If the file is created here, it is removed
+// by exitProcess unless a snapshot is written.
+func openSnapshot(filename string) (err error) {
+	snapshotFile, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		snapshotCreated = true
+		boundSyscalls[syscall.SYS_UNLINKAT] = true
+	} else if os.IsExist(err) {
+		snapshotFile, err = os.OpenFile(filename, os.O_WRONLY, 0)
+	}
+	if err == nil {
+		boundSyscalls[syscall.SYS_FTRUNCATE] = true
+	}
+	return
+}
+
+// removeUnusedSnapshot removes the snapshot file if it was created by
+// openSnapshot but no snapshot was written.
+func removeUnusedSnapshot() {
+	if snapshotCreated {
+		os.Remove(snapshotFile.Name())
+		snapshotCreated = false
+	}
+}
+
+// exitProcess removes the unused snapshot file before exiting.
+func exitProcess(status int) {
+	removeUnusedSnapshot()
+	os.Exit(status)
+}
+
+func hashModule(prog []byte) [sha256.Size]byte {
+	return sha256.Sum256(prog)
+}
+
+// writeSnapshot of a suspended program.  The call stack is converted to the
+// portable representation.
+func writeSnapshot(filename string, prog []byte, obj *wag.Object, textAddr uintptr, globals, memory, callStack []byte) (err error) {
+	portable, err := stack.Export(callStack, uint64(textAddr), &obj.CallMap)
+	if err != nil {
+		return
+	}
+
+	f := snapshotFile
+	if f != nil {
+		snapshotCreated = false
+		err = f.Truncate(0)
+	} else {
+		f, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	}
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+
+	header := snapshotHeader{
+		Magic:        snapshotMagic,
+		ModuleHash:   hashModule(prog),
+		MemoryOffset: uint64(len(globals)),
+		MemorySize:   uint64(len(memory)),
+		StackSize:    uint64(len(portable)),
+	}
+
+	if err = binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return
+	}
+	for _, b := range [][]byte{globals, memory, portable} {
+		if _, err = w.Write(b); err != nil {
+			return
+		}
+	}
+
+	err = w.Flush()
+	return
+}
+
+// readSnapshot of a program.  The module must be the same one which was
+// suspended.
+func readSnapshot(filename string, prog []byte) (s *snapshot, err error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+
+	var header snapshotHeader
+
+	if err = binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return
+	}
+	if header.Magic != snapshotMagic {
+		err = errors.New("not a snapshot file")
+		return
+	}
+	if header.ModuleHash != hashModule(prog) {
+		err = errors.New("snapshot was made of a different module")
+		return
+	}
+	if header.MemoryOffset > 0x80000000 || header.MemorySize > 0x80000000 || header.StackSize > 0x80000000 {
+		err = errors.New("snapshot is too large")
+		return
+	}
+
+	s = &snapshot{
+		globals: make([]byte, header.MemoryOffset),
+		memory:  make([]byte, header.MemorySize),
+		stack:   make([]byte, header.StackSize),
+	}
+
+	for _, b := range [][]byte{s.globals, s.memory, s.stack} {
+		if _, err = io.ReadFull(r, b); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// func suspendHandler() uint64
+TEXT ·suspendHandler(SB),$0-8
+	LEAQ	suspendHandler<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+// Signal handler is called by the kernel: DI is signal number, SI is siginfo
+// and DX is ucontext.
+TEXT suspendHandler<>(SB),NOSPLIT,$0
+	MOVL	$1, ·suspendPending(SB)
+
+	MOVQ	160(DX), AX		// rsp in ucontext
+	CMPQ	AX, ·suspendStackBegin(SB)
+	JB	other
+	CMPQ	AX, ·suspendStackEnd(SB)
+	JAE	other
+
+	MOVQ	$0x7fffffffffffffff, AX // suspend bit and stack limit
+	MOVQ	AX, 128(DX)		// rbx in ucontext
+	RET
+
+other:
+	MOVL	$186, AX		// gettid syscall
+	SYSCALL
+	CMPL	AX, ·suspendThreadID(SB)
+	JEQ	done
+
+	MOVL	$39, AX			// getpid syscall
+	SYSCALL
+	MOVL	AX, DI
+	MOVL	·suspendThreadID(SB), SI
+	MOVL	$10, DX			// SIGUSR1
+	MOVL	$234, AX		// tgkill syscall
+	SYSCALL
+
+done:
+	RET
+
+// func sigreturn() uint64
+TEXT ·sigreturn(SB),$0-8
+	LEAQ	sigreturn<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT sigreturn<>(SB),NOSPLIT,$0
+	MOVL	$15, AX			// rt_sigreturn syscall
+	SYSCALL
+	INT	$3
@@ -0,0 +1,53 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// func suspendHandler() uint64
+TEXT ·suspendHandler(SB),$0-8
+	BL	after
+
+	// Signal handler is called by the kernel: R0 is signal number, R1 is
+	// siginfo and R2 is ucontext.
+
+suspendhandler:
+	MOVD	$1, R3
+	MOVW	R3, ·suspendPending(SB)
+
+	MOVD	432(R2), R3		// sp in ucontext
+	MOVD	·suspendStackBegin(SB), R4
+	CMP	R4, R3
+	BLO	other
+	MOVD	·suspendStackEnd(SB), R4
+	CMP	R4, R3
+	BHS	other
+
+	MOVD	$0x07fffffffffffffe, R3	// suspend bit (zero) and stack limit
+	MOVD	R3, 408(R2)		// x28 in ucontext
+	B	(R30)
+
+other:
+	MOVD	$178, R8		// gettid syscall
+	SVC
+	MOVW	·suspendThreadID(SB), R3
+	CMPW	R3, R0
+	BEQ	done
+
+	MOVD	$172, R8		// getpid syscall
+	SVC
+	MOVW	·suspendThreadID(SB), R1
+	MOVD	$10, R2			// SIGUSR1
+	MOVD	$131, R8		// tgkill syscall
+	SVC
+
+done:
+	B	(R30)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func sigreturn() uint64
+TEXT ·sigreturn(SB),$0-8
+	MOVD	ZR, ret+0(FP)		// Kernel provides default restorer.
+	RET
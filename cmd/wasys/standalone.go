@@ -0,0 +1,202 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	goelf "debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"unsafe"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/object/file/elf"
+	"github.com/tsavola/wag/wa"
+)
+
+// Standalone executables embed a minimal runtime: the standalone entry, trap
+// handler and memory routines, and the syscall wrappers of the import vector.
+// They don't depend on the Go runtime, so they are copied from the wasys
+// executable (using its symbol table) to a segment of their own.  Host
+// functions are not available.
+var standalone = false
+
+// Address of the runtime segment of standalone executables.
+const standaloneRuntimeAddr = 0x10000000
+
+func importStandaloneEntry() uint64
+func importStandaloneTrapHandler() uint64
+func importStandaloneGrowMemory() uint64
+func importStandaloneCurrentMemory() uint64
+
+// Runtime data of a standalone executable.  The standalone runtime routines
+// find it after the stack frame data.
+type standaloneData struct {
+	MemorySize      uint64
+	MemorySizeLimit uint64
+	ExitStatusMask  uint64 // Zero if entry function doesn't return a value.
+}
+
+// writeStandalone executable to a file.  Import vector must not contain host
+// functions.  Command-line arguments are not available to the program: entry
+// function parameters are zero.
+func writeStandalone(filename string, runtime *standaloneRuntime, obj *wag.Object, entryType wa.FuncType) (err error) {
+	entryAddr, err := runtime.routine(importStandaloneEntry())
+	if err != nil {
+		return
+	}
+
+	vec := make([]byte, len(importVector))
+	copy(vec, importVector)
+	binary.LittleEndian.PutUint64(vec[len(vec)-8:], importStandaloneTrapHandler())
+	binary.LittleEndian.PutUint64(vec[len(vec)-16:], importStandaloneGrowMemory())
+	binary.LittleEndian.PutUint64(vec[len(vec)-24:], importStandaloneCurrentMemory())
+
+	for i := 0; i < len(vec); i += 8 {
+		if addr := binary.LittleEndian.Uint64(vec[i:]); addr != 0 {
+			addr, err = runtime.routine(addr)
+			if err != nil {
+				return
+			}
+			binary.LittleEndian.PutUint64(vec[i:], addr)
+		}
+	}
+
+	data := standaloneData{
+		MemorySize:      uint64(obj.InitialMemorySize),
+		MemorySizeLimit: uint64(obj.MemorySizeLimit),
+	}
+	if entryType.Result != wa.Void {
+		data.ExitStatusMask = 0xffffffff
+	}
+
+	runtimeData := make([]byte, unsafe.Sizeof(data))
+	binary.LittleEndian.PutUint64(runtimeData[0:], data.MemorySize)
+	binary.LittleEndian.PutUint64(runtimeData[8:], data.MemorySizeLimit)
+	binary.LittleEndian.PutUint64(runtimeData[16:], data.ExitStatusMask)
+
+	ef := &elf.File{
+		Runtime:           runtime.code,
+		RuntimeAddr:       standaloneRuntimeAddr,
+		RuntimeEntry:      entryAddr,
+		EntryAddr:         uint32(binary.LittleEndian.Uint64(obj.StackFrame)),
+		EntryArgs:         make([]uint64, len(entryType.Params)),
+		ImportVector:      vec,
+		Text:              obj.Text,
+		GlobalsMemory:     obj.GlobalsMemory,
+		MemoryOffset:      obj.MemoryOffset,
+		InitialMemorySize: obj.InitialMemorySize,
+		RuntimeData:       runtimeData,
+		FuncAddrs:         obj.FuncAddrs,
+		NumImportFuncs:    obj.NumImportFuncs,
+		TrapAddrs:         obj.TrapAddrs,
+		Names:             &obj.Names,
+		DebugSections:     nativeDWARF(obj, elf.TextAddr),
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(filename)
+		}
+	}()
+
+	_, err = ef.WriteTo(f)
+	return
+}
+
+// standaloneRuntime collects runtime routines from the wasys executable into
+// a small position-independent blob.  Each routine is copied along with the
+// rest of the function symbol which contains it.
+type standaloneRuntime struct {
+	syms   []goelf.Symbol // Text symbols sorted by address.
+	bias   uint64         // Load address minus symbol value.
+	code   []byte
+	copied map[uint64]int // Symbol value to code offset.
+}
+
+// newStandaloneRuntime fails if the wasys executable doesn't have a symbol
+// table (e.g. it was linked with -ldflags=-s).  It should be called before
+// doing any work.
+func newStandaloneRuntime() (r *standaloneRuntime, err error) {
+	filename, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	f, err := goelf.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	syms, err := f.Symbols()
+	if err != nil {
+		if err == goelf.ErrNoSymbols {
+			err = fmt.Errorf("%s: standalone output requires wasys to be built with a symbol table (without -ldflags=-s)", filename)
+		}
+		return
+	}
+
+	r = &standaloneRuntime{copied: make(map[uint64]int)}
+
+	for _, sym := range syms {
+		if goelf.ST_TYPE(sym.Info) == goelf.STT_FUNC && sym.Size > 0 {
+			r.syms = append(r.syms, sym)
+		}
+	}
+	sort.Slice(r.syms, func(i, j int) bool { return r.syms[i].Value < r.syms[j].Value })
+
+	// Position-independent executable may have been loaded anywhere.
+	for _, sym := range r.syms {
+		if sym.Name == "main.main" {
+			r.bias = uint64(reflect.ValueOf(main).Pointer()) - sym.Value
+			return
+		}
+	}
+
+	err = fmt.Errorf("%s: main function symbol not found", filename)
+	return
+}
+
+// routine copies the function which contains the address (unless already
+// copied), and returns the corresponding address in the runtime segment.
+func (r *standaloneRuntime) routine(addr uint64) (runtimeAddr uint64, err error) {
+	symAddr := addr - r.bias
+
+	i := sort.Search(len(r.syms), func(i int) bool {
+		return r.syms[i].Value+r.syms[i].Size > symAddr
+	})
+	if i == len(r.syms) || r.syms[i].Value > symAddr {
+		err = fmt.Errorf("runtime routine at 0x%x not found in symbol table", addr)
+		return
+	}
+	sym := r.syms[i]
+
+	offset, found := r.copied[sym.Value]
+	if !found {
+		var code []byte
+		h := (*reflect.SliceHeader)(unsafe.Pointer(&code))
+		h.Data = uintptr(sym.Value + r.bias)
+		h.Len = int(sym.Size)
+		h.Cap = h.Len
+
+		offset = alignSize(len(r.code), 16)
+		r.code = append(r.code, make([]byte, offset-len(r.code))...)
+		r.code = append(r.code, code...)
+		r.copied[sym.Value] = offset
+	}
+
+	runtimeAddr = standaloneRuntimeAddr + uint64(offset) + (symAddr - sym.Value)
+	return
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// Standalone runtime routines are executed without the Go runtime.  Segment
+// addresses are defined by package object/file/elf.
+
+#define STACK_SEGMENT	$0x300000000
+#define TEXT_ADDR	$0x200000000
+#define MEMORY_ADDR	$0x400000000
+
+// Runtime data pointer is stored in R13.
+#define LOAD_RUNTIME_DATA \
+	MOVQ	STACK_SEGMENT, R13; \
+	MOVQ	(R13), R12; \
+	LEAQ	8(R13)(R12*1), R13
+
+// func importStandaloneEntry() uint64
+TEXT ·importStandaloneEntry(SB),$0-8
+	LEAQ	standaloneEntry<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT standaloneEntry<>(SB),NOSPLIT,$0
+	MOVQ	STACK_SEGMENT, AX
+	MOVQ	(AX), CX		// stack frame size
+	ADDQ	CX, AX			// at last item of stack frame data
+	SHRQ	$3, CX			// stack item count
+	JMP	check
+
+copy:
+	MOVQ	(AX), DX
+	SUBQ	$8, AX
+	PUSHQ	DX
+	DECQ	CX
+check:
+	JNE	copy
+
+	MOVQ	SP, BX
+	SUBQ	$0x100000, BX		// stack limit
+	MOVQ	MEMORY_ADDR, R14
+	MOVQ	TEXT_ADDR, R15
+
+	XORL	AX, AX
+	XORL	CX, CX
+	XORL	BP, BP
+	XORL	SI, SI
+	XORL	DI, DI
+	XORL	R8, R8
+	XORL	R9, R9
+	XORL	R10, R10
+	XORL	R11, R11
+	XORL	R12, R12
+	XORL	R13, R13
+
+	LEAQ	32(R15), DX		// init routine
+	JMP	DX
+
+// func importStandaloneTrapHandler() uint64
+TEXT ·importStandaloneTrapHandler(SB),$0-8
+	LEAQ	standaloneTrapHandler<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT standaloneTrapHandler<>(SB),NOSPLIT,$0
+	TESTL	AX, AX
+	JNE	trap
+
+	LOAD_RUNTIME_DATA
+	MOVQ	AX, DI
+	SHRQ	$32, DI
+	ANDQ	16(R13), DI		// exit status mask
+	JMP	exit
+
+trap:
+	MOVL	AX, DI
+	ADDL	$100, DI
+
+exit:
+	MOVL	$231, AX		// exit_group syscall
+	SYSCALL
+	INT	$3
+
+// func importStandaloneGrowMemory() uint64
+TEXT ·importStandaloneGrowMemory(SB),$0-8
+	LEAQ	standaloneGrowMemory<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT standaloneGrowMemory<>(SB),NOSPLIT,$0
+	LOAD_RUNTIME_DATA
+	MOVL	AX, SI
+	SHLQ	$16, SI			// increment bytes
+	MOVQ	(R13), R12		// current bytes
+	LEAQ	(R12)(SI*1), DI
+	CMPQ	DI, 8(R13)		// size limit
+	JA	outofmemory
+	TESTQ	SI, SI
+	JEQ	done
+
+	LEAQ	(R14)(R12*1), DI	// mmap addr
+	MOVL	$3, DX			// PROT_READ|PROT_WRITE
+	MOVL	$0x32, R10		// MAP_PRIVATE|MAP_ANONYMOUS|MAP_FIXED
+	MOVQ	$-1, R8			// fd
+	XORL	R9, R9			// offset
+	MOVL	$9, AX			// mmap syscall
+	SYSCALL
+	CMPQ	AX, $-4096
+	JA	outofmemory
+
+	ADDQ	SI, (R13)		// new bytes
+
+done:
+	MOVQ	R12, AX
+	SHRQ	$16, AX			// old pages
+	JMP	resume
+
+outofmemory:
+	MOVL	$-1, AX
+resume:
+	MOVQ	R15, DX
+	ADDQ	$16, DX
+	JMP	DX
+
+// func importStandaloneCurrentMemory() uint64
+TEXT ·importStandaloneCurrentMemory(SB),$0-8
+	LEAQ	standaloneCurrentMemory<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT standaloneCurrentMemory<>(SB),NOSPLIT,$0
+	LOAD_RUNTIME_DATA
+	MOVQ	(R13), AX
+	SHRQ	$16, AX
+	MOVQ	R15, DX
+	ADDQ	$16, DX
+	JMP	DX
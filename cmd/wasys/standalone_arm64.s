@@ -0,0 +1,137 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// Standalone runtime routines are executed without the Go runtime.  Segment
+// addresses are defined by package object/file/elf.
+
+#define STACK_SEGMENT	$0x300000000
+#define TEXT_ADDR	$0x200000000
+#define MEMORY_ADDR	$0x400000000
+
+// Runtime data pointer is stored in R9.
+#define LOAD_RUNTIME_DATA \
+	MOVD	STACK_SEGMENT, R9; \
+	MOVD	(R9), R10; \
+	ADD	R10, R9; \
+	ADD	$8, R9
+
+// func importStandaloneEntry() uint64
+TEXT ·importStandaloneEntry(SB),$0-8
+	BL	after
+
+entry:
+	MOVD	STACK_SEGMENT, R0
+	MOVD	(R0), R1		// stack frame size
+	ADD	R1, R0			// at last item of stack frame data
+	MOVD	RSP, R2
+	B	check
+
+copy:
+	MOVD	(R0), R3
+	SUB	$8, R0
+	MOVD.W	R3, -8(R2)
+	SUB	$8, R1
+check:
+	CBNZ	R1, copy
+
+	MOVD	R2, R29			// RegFakeSP
+	MOVD	R2, R0
+	SUB	$0x100000, R0
+	AND	$~31, R0		// RegStackLimit4 must be odd (not suspended)
+	MOVD	R0, RSP			// RegRealSP
+	ADD	$16, R0			// func call link addr + its stack check trap link addr
+	LSR	$4, R0
+	MOVD	R0, g			// RegStackLimit4 (R28)
+	MOVD	MEMORY_ADDR, R26
+	MOVD	TEXT_ADDR, R27
+
+	MOVD	ZR, R0
+	ADD	$32, R27, R1		// init routine
+	B	(R1)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func importStandaloneTrapHandler() uint64
+TEXT ·importStandaloneTrapHandler(SB),$0-8
+	BL	after
+
+traphandler:
+	ANDS	$0xffffffff, R0, R1
+	BNE	trap
+
+	LOAD_RUNTIME_DATA
+	LSR	$32, R0
+	MOVD	16(R9), R1		// exit status mask
+	AND	R1, R0
+	B	exit
+
+trap:
+	ADD	$100, R1, R0
+
+exit:
+	MOVD	$94, R8			// exit_group syscall
+	SVC
+	BRK
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func importStandaloneGrowMemory() uint64
+TEXT ·importStandaloneGrowMemory(SB),$0-8
+	BL	after
+
+growmemory:
+	LOAD_RUNTIME_DATA
+	MOVWU	R0, R1
+	LSL	$16, R1			// increment bytes
+	MOVD	(R9), R10		// current bytes
+	ADD	R10, R1, R6
+	MOVD	8(R9), R7		// size limit
+	CMP	R7, R6
+	BHI	outofmemory
+	CBZ	R1, done
+
+	ADD	R10, R26, R0		// mmap addr
+	MOVD	$3, R2			// PROT_READ|PROT_WRITE
+	MOVD	$0x32, R3		// MAP_PRIVATE|MAP_ANONYMOUS|MAP_FIXED
+	MOVD	$-1, R4			// fd
+	MOVD	ZR, R5			// offset
+	MOVD	$222, R8		// mmap syscall
+	SVC
+	CMN	$4096, R0
+	BHI	outofmemory
+
+	MOVD	R6, (R9)		// new bytes
+
+done:
+	LSR	$16, R10, R0		// old pages
+	B	resume
+
+outofmemory:
+	MOVD	$0xffffffff, R0
+resume:
+	MOVD	R27, R1
+	ADD	$16, R1
+	B	(R1)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
+
+// func importStandaloneCurrentMemory() uint64
+TEXT ·importStandaloneCurrentMemory(SB),$0-8
+	BL	after
+
+currentmemory:
+	LOAD_RUNTIME_DATA
+	MOVD	(R9), R0
+	LSR	$16, R0
+	MOVD	R27, R1
+	ADD	$16, R1
+	B	(R1)
+
+after:	MOVD	LR, ret+0(FP)
+	RET
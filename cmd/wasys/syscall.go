@@ -60,6 +60,7 @@ func init() {
 	importVector = make([]byte, 432)
 	binary.LittleEndian.PutUint64(importVector[424:], importTrapHandler())
 	binary.LittleEndian.PutUint64(importVector[416:], importGrowMemory())
+	binary.LittleEndian.PutUint64(importVector[408:], importCurrentMemory())
 	binary.LittleEndian.PutUint64(importVector[400:], importRead())
 	binary.LittleEndian.PutUint64(importVector[392:], importWrite())
 	binary.LittleEndian.PutUint64(importVector[384:], importClose())
@@ -163,7 +164,3 @@ func init() {
 	importFuncs["dup3"] = importFunc{-53, 3}
 	importFuncs["pipe2"] = importFunc{-54, 2}
 }
-
-func setImportVectorCurrentMemory(size int) {
-	binary.LittleEndian.PutUint64(importVector[408:], uint64(size))
-}
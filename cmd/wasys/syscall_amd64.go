@@ -0,0 +1,57 @@
+// Generated by internal/cmd/syscalls/generate.go
+
+package main
+
+var importSyscallNumbers = map[string]uintptr{
+	"read":              0,
+	"write":             1,
+	"close":             3,
+	"lseek":             8,
+	"pread":             17,
+	"pwrite":            18,
+	"dup":               32,
+	"getpid":            39,
+	"sendfile":          40,
+	"shutdown":          48,
+	"socketpair":        53,
+	"flock":             73,
+	"fsync":             74,
+	"fdatasync":         75,
+	"truncate":          76,
+	"ftruncate":         77,
+	"getcwd":            79,
+	"chdir":             80,
+	"fchdir":            81,
+	"fchmod":            91,
+	"fchown":            93,
+	"lchown":            94,
+	"umask":             95,
+	"getuid":            102,
+	"getgid":            104,
+	"vhangup":           153,
+	"sync":              162,
+	"gettid":            186,
+	"time":              201,
+	"posix_fadvise":     221,
+	"_exit":             231,
+	"inotify_init1":     294,
+	"inotify_add_watch": 254,
+	"inotify_rm_watch":  255,
+	"openat":            257,
+	"mkdirat":           258,
+	"fchownat":          260,
+	"unlinkat":          263,
+	"renameat":          264,
+	"linkat":            265,
+	"symlinkat":         266,
+	"readlinkat":        267,
+	"fchmodat":          268,
+	"faccessat":         269,
+	"splice":            275,
+	"tee":               276,
+	"sync_file_range":   277,
+	"fallocate":         285,
+	"eventfd":           290,
+	"dup3":              292,
+	"pipe2":             293,
+}
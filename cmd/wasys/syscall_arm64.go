@@ -0,0 +1,57 @@
+// Generated by internal/cmd/syscalls/generate.go
+
+package main
+
+var importSyscallNumbers = map[string]uintptr{
+	"read":              63,
+	"write":             64,
+	"close":             57,
+	"lseek":             62,
+	"pread":             67,
+	"pwrite":            68,
+	"dup":               23,
+	"getpid":            172,
+	"sendfile":          71,
+	"shutdown":          210,
+	"socketpair":        199,
+	"flock":             32,
+	"fsync":             82,
+	"fdatasync":         83,
+	"truncate":          45,
+	"ftruncate":         46,
+	"getcwd":            17,
+	"chdir":             49,
+	"fchdir":            50,
+	"fchmod":            52,
+	"fchown":            55,
+	"lchown":            1032,
+	"umask":             166,
+	"getuid":            174,
+	"getgid":            176,
+	"vhangup":           58,
+	"sync":              81,
+	"gettid":            178,
+	"time":              1062,
+	"posix_fadvise":     223,
+	"_exit":             94,
+	"inotify_init1":     26,
+	"inotify_add_watch": 27,
+	"inotify_rm_watch":  28,
+	"openat":            56,
+	"mkdirat":           34,
+	"fchownat":          54,
+	"unlinkat":          35,
+	"renameat":          38,
+	"linkat":            37,
+	"symlinkat":         36,
+	"readlinkat":        78,
+	"fchmodat":          53,
+	"faccessat":         48,
+	"splice":            76,
+	"tee":               77,
+	"sync_file_range":   84,
+	"fallocate":         47,
+	"eventfd":           19,
+	"dup3":              24,
+	"pipe2":             59,
+}
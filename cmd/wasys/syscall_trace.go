@@ -0,0 +1,109 @@
+// Generated by internal/cmd/syscalls/generate.go
+
+package main
+
+func traceRead() uint64
+func traceWrite() uint64
+func traceClose() uint64
+func traceLseek() uint64
+func tracePread() uint64
+func tracePwrite() uint64
+func traceDup() uint64
+func traceGetpid() uint64
+func traceSendfile() uint64
+func traceShutdown() uint64
+func traceSocketpair() uint64
+func traceFlock() uint64
+func traceFsync() uint64
+func traceFdatasync() uint64
+func traceTruncate() uint64
+func traceFtruncate() uint64
+func traceGetcwd() uint64
+func traceChdir() uint64
+func traceFchdir() uint64
+func traceFchmod() uint64
+func traceFchown() uint64
+func traceLchown() uint64
+func traceUmask() uint64
+func traceGetuid() uint64
+func traceGetgid() uint64
+func traceVhangup() uint64
+func traceSync() uint64
+func traceGettid() uint64
+func traceTime() uint64
+func tracePosixFadvise() uint64
+func traceExit() uint64
+func traceInotifyInit1() uint64
+func traceInotifyAddWatch() uint64
+func traceInotifyRmWatch() uint64
+func traceOpenat() uint64
+func traceMkdirat() uint64
+func traceFchownat() uint64
+func traceUnlinkat() uint64
+func traceRenameat() uint64
+func traceLinkat() uint64
+func traceSymlinkat() uint64
+func traceReadlinkat() uint64
+func traceFchmodat() uint64
+func traceFaccessat() uint64
+func traceSplice() uint64
+func traceTee() uint64
+func traceSyncFileRange() uint64
+func traceFallocate() uint64
+func traceEventfd() uint64
+func traceDup3() uint64
+func tracePipe2() uint64
+
+var traceSyscalls = []traceSyscall{
+	{"read", 2, "d,out3,d", traceRead},
+	{"write", 2, "d,in3,d", traceWrite},
+	{"close", 0, "d", traceClose},
+	{"lseek", 0, "d,d,d", traceLseek},
+	{"pread", 2, "d,out3,d,d", tracePread},
+	{"pwrite", 2, "d,in3,d,d", tracePwrite},
+	{"dup", 0, "d", traceDup},
+	{"getpid", 0, "", traceGetpid},
+	{"sendfile", 4, "d,d,p,d", traceSendfile},
+	{"shutdown", 0, "d,d", traceShutdown},
+	{"socketpair", 8, "d,d,d,p", traceSocketpair},
+	{"flock", 0, "d,d", traceFlock},
+	{"fsync", 0, "d", traceFsync},
+	{"fdatasync", 0, "d", traceFdatasync},
+	{"truncate", 1, "s,d", traceTruncate},
+	{"ftruncate", 0, "d,d", traceFtruncate},
+	{"getcwd", 1, "out2,d", traceGetcwd},
+	{"chdir", 1, "s", traceChdir},
+	{"fchdir", 0, "d", traceFchdir},
+	{"fchmod", 0, "d,o", traceFchmod},
+	{"fchown", 0, "d,d,d", traceFchown},
+	{"lchown", 1, "s,d,d", traceLchown},
+	{"umask", 0, "o", traceUmask},
+	{"getuid", 0, "", traceGetuid},
+	{"getgid", 0, "", traceGetgid},
+	{"vhangup", 0, "", traceVhangup},
+	{"sync", 0, "", traceSync},
+	{"gettid", 0, "", traceGettid},
+	{"time", 1, "p", traceTime},
+	{"posix_fadvise", 0, "d,d,d,d", tracePosixFadvise},
+	{"_exit", 0, "d", traceExit},
+	{"inotify_init1", 0, "", traceInotifyInit1},
+	{"inotify_add_watch", 2, "d,s,x", traceInotifyAddWatch},
+	{"inotify_rm_watch", 0, "d,d", traceInotifyRmWatch},
+	{"openat", 2, "d,s,x,o", traceOpenat},
+	{"mkdirat", 2, "d,s,o", traceMkdirat},
+	{"fchownat", 2, "d,s,d,d,x", traceFchownat},
+	{"unlinkat", 2, "d,s,x", traceUnlinkat},
+	{"renameat", 10, "d,s,d,s", traceRenameat},
+	{"linkat", 10, "d,s,d,s,x", traceLinkat},
+	{"symlinkat", 5, "s,d,s", traceSymlinkat},
+	{"readlinkat", 6, "d,s,out4,d", traceReadlinkat},
+	{"fchmodat", 2, "d,s,o,x", traceFchmodat},
+	{"faccessat", 2, "d,s,o,x", traceFaccessat},
+	{"splice", 10, "d,p,d,p,d,x", traceSplice},
+	{"tee", 0, "d,d,d,x", traceTee},
+	{"sync_file_range", 0, "d,d,d,x", traceSyncFileRange},
+	{"fallocate", 0, "d,x,d,d", traceFallocate},
+	{"eventfd", 0, "d,x", traceEventfd},
+	{"dup3", 0, "d,d,x", traceDup3},
+	{"pipe2", 1, "p,x", tracePipe2},
+}
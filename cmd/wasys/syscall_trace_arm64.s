@@ -0,0 +1,64 @@
+// Generated by internal/cmd/syscalls/generate.go
+
+#include "go_asm.h"
+#include "textflag.h"
+
+#define TRACEFUNC(NAME, STUB, NUM) \
+	TEXT NAME(SB),$0-8; \
+	BL	3(PC); \
+	MOVD	$(NUM), R1; \
+	JMP	·hostCall(SB); \
+	MOVD	LR, ret+0(FP); \
+	RET
+
+TRACEFUNC(·traceRead, traceRead<>, const_hostTraceBase+0)
+TRACEFUNC(·traceWrite, traceWrite<>, const_hostTraceBase+1)
+TRACEFUNC(·traceClose, traceClose<>, const_hostTraceBase+2)
+TRACEFUNC(·traceLseek, traceLseek<>, const_hostTraceBase+3)
+TRACEFUNC(·tracePread, tracePread<>, const_hostTraceBase+4)
+TRACEFUNC(·tracePwrite, tracePwrite<>, const_hostTraceBase+5)
+TRACEFUNC(·traceDup, traceDup<>, const_hostTraceBase+6)
+TRACEFUNC(·traceGetpid, traceGetpid<>, const_hostTraceBase+7)
+TRACEFUNC(·traceSendfile, traceSendfile<>, const_hostTraceBase+8)
+TRACEFUNC(·traceShutdown, traceShutdown<>, const_hostTraceBase+9)
+TRACEFUNC(·traceSocketpair, traceSocketpair<>, const_hostTraceBase+10)
+TRACEFUNC(·traceFlock, traceFlock<>, const_hostTraceBase+11)
+TRACEFUNC(·traceFsync, traceFsync<>, const_hostTraceBase+12)
+TRACEFUNC(·traceFdatasync, traceFdatasync<>, const_hostTraceBase+13)
+TRACEFUNC(·traceTruncate, traceTruncate<>, const_hostTraceBase+14)
+TRACEFUNC(·traceFtruncate, traceFtruncate<>, const_hostTraceBase+15)
+TRACEFUNC(·traceGetcwd, traceGetcwd<>, const_hostTraceBase+16)
+TRACEFUNC(·traceChdir, traceChdir<>, const_hostTraceBase+17)
+TRACEFUNC(·traceFchdir, traceFchdir<>, const_hostTraceBase+18)
+TRACEFUNC(·traceFchmod, traceFchmod<>, const_hostTraceBase+19)
+TRACEFUNC(·traceFchown, traceFchown<>, const_hostTraceBase+20)
+TRACEFUNC(·traceLchown, traceLchown<>, const_hostTraceBase+21)
+TRACEFUNC(·traceUmask, traceUmask<>, const_hostTraceBase+22)
+TRACEFUNC(·traceGetuid, traceGetuid<>, const_hostTraceBase+23)
+TRACEFUNC(·traceGetgid, traceGetgid<>, const_hostTraceBase+24)
+TRACEFUNC(·traceVhangup, traceVhangup<>, const_hostTraceBase+25)
+TRACEFUNC(·traceSync, traceSync<>, const_hostTraceBase+26)
+TRACEFUNC(·traceGettid, traceGettid<>, const_hostTraceBase+27)
+TRACEFUNC(·traceTime, traceTime<>, const_hostTraceBase+28)
+TRACEFUNC(·tracePosixFadvise, tracePosixFadvise<>, const_hostTraceBase+29)
+TRACEFUNC(·traceExit, traceExit<>, const_hostTraceBase+30)
+TRACEFUNC(·traceInotifyInit1, traceInotifyInit1<>, const_hostTraceBase+31)
+TRACEFUNC(·traceInotifyAddWatch, traceInotifyAddWatch<>, const_hostTraceBase+32)
+TRACEFUNC(·traceInotifyRmWatch, traceInotifyRmWatch<>, const_hostTraceBase+33)
+TRACEFUNC(·traceOpenat, traceOpenat<>, const_hostTraceBase+34)
+TRACEFUNC(·traceMkdirat, traceMkdirat<>, const_hostTraceBase+35)
+TRACEFUNC(·traceFchownat, traceFchownat<>, const_hostTraceBase+36)
+TRACEFUNC(·traceUnlinkat, traceUnlinkat<>, const_hostTraceBase+37)
+TRACEFUNC(·traceRenameat, traceRenameat<>, const_hostTraceBase+38)
+TRACEFUNC(·traceLinkat, traceLinkat<>, const_hostTraceBase+39)
+TRACEFUNC(·traceSymlinkat, traceSymlinkat<>, const_hostTraceBase+40)
+TRACEFUNC(·traceReadlinkat, traceReadlinkat<>, const_hostTraceBase+41)
+TRACEFUNC(·traceFchmodat, traceFchmodat<>, const_hostTraceBase+42)
+TRACEFUNC(·traceFaccessat, traceFaccessat<>, const_hostTraceBase+43)
+TRACEFUNC(·traceSplice, traceSplice<>, const_hostTraceBase+44)
+TRACEFUNC(·traceTee, traceTee<>, const_hostTraceBase+45)
+TRACEFUNC(·traceSyncFileRange, traceSyncFileRange<>, const_hostTraceBase+46)
+TRACEFUNC(·traceFallocate, traceFallocate<>, const_hostTraceBase+47)
+TRACEFUNC(·traceEventfd, traceEventfd<>, const_hostTraceBase+48)
+TRACEFUNC(·traceDup3, traceDup3<>, const_hostTraceBase+49)
+TRACEFUNC(·tracePipe2, tracePipe2<>, const_hostTraceBase+50)
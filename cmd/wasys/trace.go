@@ -0,0 +1,259 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/tsavola/wag/wa"
+)
+
+// Import function calls are logged if tracing is enabled.  Syscall imports
+// are bound to trace stubs instead of the syscall wrappers; the stubs make
+// host calls, and the syscalls are made by callTracedSyscall.  Host function
+// calls are logged by callHost.
+var tracing = false
+
+// traceSyscall describes a syscall import.  Format lists the parameters,
+// separated by commas:
+//
+//   - d: decimal integer,
+//   - o: octal integer,
+//   - x: hexadecimal integer,
+//   - p: pointer (linear memory address),
+//   - s: null-terminated string,
+//   - inN: input buffer whose size is parameter N (counting from 1),
+//   - outN: output buffer whose capacity is parameter N; the result is the
+//     size of the output.
+type traceSyscall struct {
+	name    string
+	ptrMask int
+	format  string
+	stub    func() uint64
+}
+
+// Maximum number of bytes to log.
+const (
+	traceBufLen    = 32
+	traceStringLen = 256
+)
+
+var (
+	traceVecBase      int           // Import vector index of the first trace stub.
+	traceSyscallTypes []wa.FuncType // Signatures of the syscall imports.
+)
+
+// initTraceFuncs extends the import vector with the trace stubs.
+func initTraceFuncs() {
+	vec := make([]byte, len(traceSyscalls)*8+len(importVector))
+	copy(vec[len(traceSyscalls)*8:], importVector)
+
+	traceVecBase = -len(importVector)/8 - 1
+
+	for i, sc := range traceSyscalls {
+		binary.LittleEndian.PutUint64(vec[len(vec)+(traceVecBase-i)*8:], sc.stub())
+	}
+
+	importVector = vec
+	traceSyscallTypes = make([]wa.FuncType, len(traceSyscalls))
+}
+
+// traceSyscallIndex returns the import vector index of the syscall's trace
+// stub.  Zero is returned if the syscall is unknown.
+func traceSyscallIndex(field string) int {
+	for i := range traceSyscalls {
+		if traceSyscalls[i].name == field {
+			return traceVecBase - i
+		}
+	}
+	return 0
+}
+
+// bindTraceSyscall returns the import vector index of the syscall's trace
+// stub.  The signature is used to decode the arguments.
+func bindTraceSyscall(field string, sig wa.FuncType) (index int) {
+	index = traceSyscallIndex(field)
+	traceSyscallTypes[traceVecBase-index] = sig
+	return
+}
+
+// callTracedSyscall makes a syscall on behalf of the program and logs it.  It
+// behaves like the syscall wrapper: pointer arguments are translated to
+// absolute addresses, and a negated errno is returned on error.
+func callTracedSyscall(num int, stack []byte) (result uint64) {
+	var (
+		sc      = &traceSyscalls[num]
+		sig     = traceSyscallTypes[num]
+		formats = strings.Split(sc.format, ",")
+		args    = readHostArgs(stack, len(sig.Params))
+		sysargs [6]uintptr
+	)
+
+	for i, x := range args {
+		if sc.ptrMask&(1<<uint(i)) != 0 {
+			if addr := uint32(x); addr != 0 {
+				sysargs[i] = memoryAddr + uintptr(addr)
+			}
+		} else {
+			sysargs[i] = uintptr(x)
+		}
+	}
+
+	strs := make([]string, len(args))
+	for i, x := range args {
+		if !strings.HasPrefix(formats[i], "out") {
+			strs[i] = formatTraceArg(sig.Params[i], x, formats[i], args, 0)
+		}
+	}
+
+	if sc.name == "_exit" {
+		log.Printf("trace: %s(%s) = ?", sc.name, strings.Join(strs, ", "))
+	}
+
+	r1, _, errno := syscall.Syscall6(importSyscallNumbers[sc.name], sysargs[0], sysargs[1], sysargs[2], sysargs[3], sysargs[4], sysargs[5])
+	if errno != 0 {
+		result = uint64(-int64(errno))
+	} else {
+		result = uint64(r1)
+	}
+
+	for i, x := range args {
+		if strings.HasPrefix(formats[i], "out") {
+			if errno != 0 {
+				strs[i] = formatTraceArg(sig.Params[i], x, "p", args, 0)
+			} else {
+				strs[i] = formatTraceArg(sig.Params[i], x, formats[i], args, result)
+			}
+		}
+	}
+
+	if errno != 0 {
+		log.Printf("trace: %s(%s) = -%d (%v)", sc.name, strings.Join(strs, ", "), errno, errno)
+	} else {
+		log.Printf("trace: %s(%s) = %d", sc.name, strings.Join(strs, ", "), int64(result))
+	}
+	return
+}
+
+// traceHostCall logs a host function call.  WASI errno is returned by
+// host functions.
+func traceHostCall(f *hostFunc, args []uint64, result string) {
+	strs := make([]string, len(args))
+	for i, x := range args {
+		strs[i] = formatTraceArg(f.sig.Params[i], x, "d", args, 0)
+	}
+	log.Printf("trace: %s(%s) = %s", f.name, strings.Join(strs, ", "), result)
+}
+
+func formatWASIErrno(errno wasiErrno) string {
+	if errno != wasiESuccess {
+		for e, we := range wasiErrnos {
+			if we == errno {
+				return fmt.Sprintf("%d (%v)", errno, e)
+			}
+		}
+	}
+	return strconv.Itoa(int(errno))
+}
+
+// formatTraceArg according to its type and format.  Buffer sizes are looked
+// up from args; output buffer size is limited by the result.
+func formatTraceArg(t wa.Type, x uint64, format string, args []uint64, result uint64) string {
+	switch t {
+	case wa.F32:
+		return strconv.FormatFloat(float64(math.Float32frombits(uint32(x))), 'g', -1, 32)
+
+	case wa.F64:
+		return strconv.FormatFloat(math.Float64frombits(x), 'g', -1, 64)
+
+	}
+
+	signed := int64(x)
+	if t == wa.I32 {
+		x = uint64(uint32(x))
+		signed = int64(int32(x))
+	}
+
+	switch {
+	case format == "o" && x != 0:
+		return fmt.Sprintf("0%o", x)
+
+	case format == "x", format == "p":
+		return fmt.Sprintf("0x%x", x)
+
+	case format == "s":
+		if s, ok := readTraceString(uint32(x)); ok {
+			if len(s) == traceStringLen {
+				return strconv.Quote(s) + "..."
+			}
+			return strconv.Quote(s)
+		}
+		return fmt.Sprintf("0x%x", x)
+
+	case strings.HasPrefix(format, "in"), strings.HasPrefix(format, "out"):
+		n, err := strconv.Atoi(strings.TrimLeft(format, "inout"))
+		if err != nil || n < 1 || n > len(args) {
+			panic(fmt.Errorf("invalid trace format: %s", format))
+		}
+		size := args[n-1]
+		if format[0] == 'o' && result < size {
+			size = result
+		}
+		if b, ok := readTraceBuf(uint32(x), size); ok {
+			return quoteTraceBuf(b, size)
+		}
+		return fmt.Sprintf("0x%x", x)
+
+	default:
+		return strconv.FormatInt(signed, 10)
+	}
+}
+
+func readTraceString(addr uint32) (s string, ok bool) {
+	mem := linearMemory()
+	if addr == 0 || uint64(addr) >= uint64(len(mem)) {
+		return
+	}
+
+	b := mem[addr:]
+	if len(b) > traceStringLen {
+		b = b[:traceStringLen]
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	s = string(b)
+	ok = true
+	return
+}
+
+func readTraceBuf(addr uint32, size uint64) (b []byte, ok bool) {
+	mem := linearMemory()
+	if addr == 0 || uint64(addr)+size > uint64(len(mem)) {
+		return
+	}
+
+	if size > traceBufLen {
+		size = traceBufLen
+	}
+	b = mem[addr : uint64(addr)+size]
+	ok = true
+	return
+}
+
+func quoteTraceBuf(b []byte, size uint64) string {
+	s := strconv.Quote(string(b))
+	if uint64(len(b)) < size {
+		s += "..."
+	}
+	return s
+}
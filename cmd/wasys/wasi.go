@@ -0,0 +1,541 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/tsavola/wag/wa"
+)
+
+const wasiModule = "wasi_snapshot_preview1"
+
+type wasiErrno uint32
+
+const (
+	wasiESuccess     = wasiErrno(0)
+	wasiE2big        = wasiErrno(1)
+	wasiEAcces       = wasiErrno(2)
+	wasiEAgain       = wasiErrno(6)
+	wasiEBadf        = wasiErrno(8)
+	wasiEExist       = wasiErrno(20)
+	wasiEFault       = wasiErrno(21)
+	wasiEFbig        = wasiErrno(22)
+	wasiEIntr        = wasiErrno(27)
+	wasiEInval       = wasiErrno(28)
+	wasiEIO          = wasiErrno(29)
+	wasiEIsdir       = wasiErrno(31)
+	wasiELoop        = wasiErrno(32)
+	wasiEMfile       = wasiErrno(33)
+	wasiENametoolong = wasiErrno(37)
+	wasiENoent       = wasiErrno(44)
+	wasiENomem       = wasiErrno(48)
+	wasiENospc       = wasiErrno(51)
+	wasiENosys       = wasiErrno(52)
+	wasiENotdir      = wasiErrno(54)
+	wasiENotempty    = wasiErrno(55)
+	wasiEPerm        = wasiErrno(63)
+	wasiEPipe        = wasiErrno(64)
+	wasiERofs        = wasiErrno(69)
+	wasiESpipe       = wasiErrno(70)
+	wasiENotcapable  = wasiErrno(76)
+)
+
+var wasiErrnos = map[syscall.Errno]wasiErrno{
+	syscall.E2BIG:        wasiE2big,
+	syscall.EACCES:       wasiEAcces,
+	syscall.EAGAIN:       wasiEAgain,
+	syscall.EBADF:        wasiEBadf,
+	syscall.EEXIST:       wasiEExist,
+	syscall.EFAULT:       wasiEFault,
+	syscall.EFBIG:        wasiEFbig,
+	syscall.EINTR:        wasiEIntr,
+	syscall.EINVAL:       wasiEInval,
+	syscall.EIO:          wasiEIO,
+	syscall.EISDIR:       wasiEIsdir,
+	syscall.ELOOP:        wasiELoop,
+	syscall.EMFILE:       wasiEMfile,
+	syscall.ENAMETOOLONG: wasiENametoolong,
+	syscall.ENOENT:       wasiENoent,
+	syscall.ENOMEM:       wasiENomem,
+	syscall.ENOSPC:       wasiENospc,
+	syscall.ENOSYS:       wasiENosys,
+	syscall.ENOTDIR:      wasiENotdir,
+	syscall.ENOTEMPTY:    wasiENotempty,
+	syscall.EPERM:        wasiEPerm,
+	syscall.EPIPE:        wasiEPipe,
+	syscall.EROFS:        wasiERofs,
+	syscall.ESPIPE:       wasiESpipe,
+}
+
+func wasiError(err error) wasiErrno {
+	if err == nil {
+		return wasiESuccess
+	}
+	if e, ok := err.(syscall.Errno); ok {
+		if n, found := wasiErrnos[e]; found {
+			return n
+		}
+	}
+	return wasiEIO
+}
+
+const (
+	wasiFiletypeUnknown         = 0
+	wasiFiletypeBlockDevice     = 1
+	wasiFiletypeCharacterDevice = 2
+	wasiFiletypeDirectory       = 3
+	wasiFiletypeRegularFile     = 4
+	wasiFiletypeSocketStream    = 6
+	wasiFiletypeSymbolicLink    = 7
+)
+
+const (
+	wasiFdflagAppend   = 1 << 0
+	wasiFdflagDsync    = 1 << 1
+	wasiFdflagNonblock = 1 << 2
+	wasiFdflagSync     = 1 << 4
+
+	wasiOflagCreat     = 1 << 0
+	wasiOflagDirectory = 1 << 1
+	wasiOflagExcl      = 1 << 2
+	wasiOflagTrunc     = 1 << 3
+
+	wasiLookupSymlinkFollow = 1 << 0
+
+	wasiRightFdRead  = 1 << 1
+	wasiRightFdWrite = 1 << 6
+)
+
+const (
+	sysOpenat2 = 437 // Same on amd64 and arm64.
+
+	resolveNoMagiclinks = 0x02
+	resolveBeneath      = 0x08
+)
+
+func wasiSig(params ...wa.Type) wa.FuncType {
+	return wa.FuncType{Params: params, Result: wa.I32}
+}
+
+var wasiFiles = map[uint32]*wasiFile{0: {fd: 0}, 1: {fd: 1}, 2: {fd: 2}}
+
+type wasiFile struct {
+	fd      int    // Host file descriptor.
+	preopen string // Directory name if preopened.
+}
+
+func resolveWASIFunc(field string, sig wa.FuncType) (index int, err error) {
+	index, found, err := resolveHostFunc(wasiModule, field, sig)
+	if found || err != nil {
+		return
+	}
+
+	// Unimplemented functions return ENOSYS.
+	if sig.Result != wa.I32 {
+		err = fmt.Errorf("%s function not supported: %s", wasiModule, field)
+		return
+	}
+
+	index = hostVecBase
+	return
+}
+
+// preopenWASIDir opens a host directory for the program.
+func preopenWASIDir(dir string) (err error) {
+	fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return
+	}
+
+	wasiFiles[wasiAllocFd()] = &wasiFile{fd: fd, preopen: dir}
+	return
+}
+
+func wasiAllocFd() (fd uint32) {
+	for fd = 3; wasiFiles[fd] != nil; fd++ {
+	}
+	return
+}
+
+// wasiMemory accessors panic with wasiEFault if the program passes an
+// invalid pointer.
+type wasiMemory []byte
+
+func (mem wasiMemory) bytes(ptr, size uint32) []byte {
+	if uint64(ptr)+uint64(size) > uint64(len(mem)) {
+		panic(wasiEFault)
+	}
+	return mem[ptr : ptr+size]
+}
+
+func (mem wasiMemory) uint32(ptr uint32) uint32 {
+	return binary.LittleEndian.Uint32(mem.bytes(ptr, 4))
+}
+
+func (mem wasiMemory) putUint32(ptr, value uint32) {
+	binary.LittleEndian.PutUint32(mem.bytes(ptr, 4), value)
+}
+
+func (mem wasiMemory) putUint64(ptr uint32, value uint64) {
+	binary.LittleEndian.PutUint64(mem.bytes(ptr, 8), value)
+}
+
+// iovecs gets the buffers described by an iovec array.
+func (mem wasiMemory) iovecs(ptr, count uint32) (bufs [][]byte) {
+	arraySize := uint64(count) * 8
+	if uint64(ptr)+arraySize > uint64(len(mem)) {
+		panic(wasiEFault)
+	}
+
+	array := mem[uint64(ptr) : uint64(ptr)+arraySize]
+	for len(array) > 0 {
+		buf := binary.LittleEndian.Uint32(array[0:])
+		size := binary.LittleEndian.Uint32(array[4:])
+		bufs = append(bufs, mem.bytes(buf, size))
+		array = array[8:]
+	}
+	return
+}
+
+func wasiFileOf(fd uint64) *wasiFile {
+	f := wasiFiles[uint32(fd)]
+	if f == nil {
+		panic(wasiEBadf)
+	}
+	return f
+}
+
+func wasiStringsSizesGet(mem wasiMemory, strs []string, countPtr, sizePtr uint64) wasiErrno {
+	var size int
+	for _, s := range strs {
+		size += len(s) + 1
+	}
+
+	mem.putUint32(uint32(countPtr), uint32(len(strs)))
+	mem.putUint32(uint32(sizePtr), uint32(size))
+	return wasiESuccess
+}
+
+func wasiStringsGet(mem wasiMemory, strs []string, ptrsPtr, bufPtr uint64) wasiErrno {
+	ptrs := uint32(ptrsPtr)
+	buf := uint32(bufPtr)
+
+	for i, s := range strs {
+		mem.putUint32(ptrs+uint32(i)*4, buf)
+		b := mem.bytes(buf, uint32(len(s))+1)
+		copy(b, s)
+		b[len(s)] = 0
+		buf += uint32(len(b))
+	}
+
+	return wasiESuccess
+}
+
+func wasiArgsGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	return wasiStringsGet(mem, progArgs, args[0], args[1])
+}
+
+func wasiArgsSizesGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	return wasiStringsSizesGet(mem, progArgs, args[0], args[1])
+}
+
+func wasiEnvironGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	return wasiStringsGet(mem, progEnviron, args[0], args[1])
+}
+
+func wasiEnvironSizesGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	return wasiStringsSizesGet(mem, progEnviron, args[0], args[1])
+}
+
+func wasiClockTimeGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	clock := uint32(args[0])
+	if clock > 3 { // Realtime, monotonic, process and thread CPU time.
+		return wasiEInval
+	}
+
+	var ts syscall.Timespec
+
+	_, _, errno := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, uintptr(clock), uintptr(unsafe.Pointer(&ts)), 0)
+	if errno != 0 {
+		return wasiError(errno)
+	}
+
+	mem.putUint64(uint32(args[2]), uint64(ts.Nano()))
+	return wasiESuccess
+}
+
+func wasiFdCloseImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+	delete(wasiFiles, uint32(args[0]))
+	return wasiError(syscall.Close(f.fd))
+}
+
+func wasiFdFdstatGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(f.fd, &st); err != nil {
+		return wasiError(err)
+	}
+
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(f.fd), syscall.F_GETFL, 0)
+	if errno != 0 {
+		return wasiError(errno)
+	}
+
+	var fdflags uint16
+	if flags&syscall.O_APPEND != 0 {
+		fdflags |= wasiFdflagAppend
+	}
+	if flags&syscall.O_NONBLOCK != 0 {
+		fdflags |= wasiFdflagNonblock
+	}
+
+	b := mem.bytes(uint32(args[1]), 24)
+	b[0] = wasiFiletype(st.Mode)
+	b[1] = 0
+	binary.LittleEndian.PutUint16(b[2:], fdflags)
+	binary.LittleEndian.PutUint32(b[4:], 0)
+	binary.LittleEndian.PutUint64(b[8:], ^uint64(0))  // Base rights.
+	binary.LittleEndian.PutUint64(b[16:], ^uint64(0)) // Inheriting rights.
+	return wasiESuccess
+}
+
+func wasiFiletype(mode uint32) uint8 {
+	switch mode & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		return wasiFiletypeBlockDevice
+	case syscall.S_IFCHR:
+		return wasiFiletypeCharacterDevice
+	case syscall.S_IFDIR:
+		return wasiFiletypeDirectory
+	case syscall.S_IFREG:
+		return wasiFiletypeRegularFile
+	case syscall.S_IFSOCK:
+		return wasiFiletypeSocketStream
+	case syscall.S_IFLNK:
+		return wasiFiletypeSymbolicLink
+	default:
+		return wasiFiletypeUnknown
+	}
+}
+
+func wasiFdPrestatGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+	if f.preopen == "" {
+		return wasiEBadf
+	}
+
+	b := mem.bytes(uint32(args[1]), 8)
+	binary.LittleEndian.PutUint32(b[0:], 0) // Directory.
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(f.preopen)))
+	return wasiESuccess
+}
+
+func wasiFdPrestatDirNameImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+	if f.preopen == "" {
+		return wasiEBadf
+	}
+
+	b := mem.bytes(uint32(args[1]), uint32(args[2]))
+	if len(b) < len(f.preopen) {
+		return wasiENametoolong
+	}
+
+	copy(b, f.preopen)
+	return wasiESuccess
+}
+
+func wasiFdReadImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+
+	var total uint32
+
+	for _, buf := range mem.iovecs(uint32(args[1]), uint32(args[2])) {
+		n, err := syscall.Read(f.fd, buf)
+		if err != nil {
+			if total == 0 {
+				return wasiError(err)
+			}
+			break
+		}
+
+		total += uint32(n)
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	mem.putUint32(uint32(args[3]), total)
+	return wasiESuccess
+}
+
+func wasiFdWriteImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+
+	var total uint32
+
+	for _, buf := range mem.iovecs(uint32(args[1]), uint32(args[2])) {
+		n, err := syscall.Write(f.fd, buf)
+		if err != nil {
+			if total == 0 {
+				return wasiError(err)
+			}
+			break
+		}
+
+		total += uint32(n)
+
+		if n < len(buf) {
+			break
+		}
+	}
+
+	mem.putUint32(uint32(args[3]), total)
+	return wasiESuccess
+}
+
+func wasiFdSeekImpl(mem wasiMemory, args []uint64) wasiErrno {
+	f := wasiFileOf(args[0])
+
+	whence := int(uint32(args[2])) // Set, current and end match Linux.
+	if whence > 2 {
+		return wasiEInval
+	}
+
+	offset, err := syscall.Seek(f.fd, int64(args[1]), whence)
+	if err != nil {
+		return wasiError(err)
+	}
+
+	mem.putUint64(uint32(args[3]), uint64(offset))
+	return wasiESuccess
+}
+
+// wasiPathOpenImpl resolves paths beneath a preopened directory.  Absolute
+// paths, ".." components and symbolic links which would escape the directory
+// are rejected by the kernel (openat2 with RESOLVE_BENEATH).
+func wasiPathOpenImpl(mem wasiMemory, args []uint64) wasiErrno {
+	dir := wasiFileOf(args[0])
+	if dir.preopen == "" {
+		return wasiENotcapable
+	}
+
+	var (
+		dirflags   = uint32(args[1])
+		name       = string(mem.bytes(uint32(args[2]), uint32(args[3])))
+		oflags     = uint32(args[4])
+		rightsBase = args[5]
+		fdflags    = uint32(args[7])
+	)
+
+	if strings.IndexByte(name, 0) >= 0 {
+		return wasiEInval
+	}
+
+	flags := syscall.O_CLOEXEC
+
+	switch rightsBase & (wasiRightFdRead | wasiRightFdWrite) {
+	case wasiRightFdWrite:
+		flags |= syscall.O_WRONLY
+	case wasiRightFdRead | wasiRightFdWrite:
+		flags |= syscall.O_RDWR
+	default:
+		flags |= syscall.O_RDONLY
+	}
+
+	if dirflags&wasiLookupSymlinkFollow == 0 {
+		flags |= syscall.O_NOFOLLOW
+	}
+	if oflags&wasiOflagCreat != 0 {
+		flags |= syscall.O_CREAT
+	}
+	if oflags&wasiOflagDirectory != 0 {
+		flags |= syscall.O_DIRECTORY
+	}
+	if oflags&wasiOflagExcl != 0 {
+		flags |= syscall.O_EXCL
+	}
+	if oflags&wasiOflagTrunc != 0 {
+		flags |= syscall.O_TRUNC
+	}
+	if fdflags&wasiFdflagAppend != 0 {
+		flags |= syscall.O_APPEND
+	}
+	if fdflags&wasiFdflagDsync != 0 {
+		flags |= syscall.O_DSYNC
+	}
+	if fdflags&wasiFdflagNonblock != 0 {
+		flags |= syscall.O_NONBLOCK
+	}
+	if fdflags&wasiFdflagSync != 0 {
+		flags |= syscall.O_SYNC
+	}
+
+	fd, err := openBeneath(dir.fd, name, flags, 0666)
+	if err != nil {
+		if err == syscall.EXDEV {
+			return wasiENotcapable
+		}
+		return wasiError(err)
+	}
+
+	newFd := wasiAllocFd()
+	wasiFiles[newFd] = &wasiFile{fd: fd}
+
+	mem.putUint32(uint32(args[8]), newFd)
+	return wasiESuccess
+}
+
+// openBeneath opens a file relative to a directory without escaping it.
+func openBeneath(dirfd int, name string, flags int, mode uint32) (fd int, err error) {
+	pathname, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return
+	}
+
+	how := struct {
+		flags   uint64
+		mode    uint64
+		resolve uint64
+	}{
+		flags:   uint64(flags),
+		mode:    uint64(mode),
+		resolve: resolveBeneath | resolveNoMagiclinks,
+	}
+
+	r, _, errno := syscall.Syscall6(sysOpenat2, uintptr(dirfd), uintptr(unsafe.Pointer(pathname)), uintptr(unsafe.Pointer(&how)), unsafe.Sizeof(how), 0, 0)
+	if errno != 0 {
+		err = errno
+		return
+	}
+
+	fd = int(r)
+	return
+}
+
+func wasiProcExitImpl(mem wasiMemory, args []uint64) wasiErrno {
+	exitProcess(int(int32(args[0])))
+	panic("unreachable")
+}
+
+func wasiRandomGetImpl(mem wasiMemory, args []uint64) wasiErrno {
+	if _, err := rand.Read(mem.bytes(uint32(args[0]), uint32(args[1]))); err != nil {
+		return wasiEIO
+	}
+	return wasiESuccess
+}
+
+func wasiSchedYieldImpl(mem wasiMemory, args []uint64) wasiErrno {
+	return wasiESuccess
+}
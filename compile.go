@@ -9,6 +9,8 @@
 package wag
 
 import (
+	"sort"
+
 	"github.com/tsavola/wag/binding"
 	"github.com/tsavola/wag/compile"
 	"github.com/tsavola/wag/object/debug"
@@ -18,18 +20,21 @@ import (
 )
 
 // EntryPolicy validates an entry function's signature while looking it up from
-// a module's exported functions.
-type EntryPolicy func(m *compile.Module, symbol string) (globalIndex uint32, sig wa.FuncType, err error)
+// a module's exported functions.  See the binding package for implementations.
+type EntryPolicy = binding.EntryPolicy
 
 // Config for a single compiler invocation.  Zero values are replaced with
 // effective defaults during compilation.
 type Config struct {
-	Text            compile.CodeBuffer // Defaults to dynamically sized buffer.
-	GlobalsMemory   compile.DataBuffer // Defaults to dynamically sized buffer.
-	MemoryAlignment int                // Defaults to minimal valid alignment.
-	Entry           string             // No entry function by default.
-	EntryPolicy     EntryPolicy        // Defaults to binding.GetMainFunc.
-	EntryArgs       []uint64           // Defaults to zeros (subject to policy).
+	Text            compile.CodeBuffer  // Defaults to dynamically sized buffer.
+	GlobalsMemory   compile.DataBuffer  // Defaults to dynamically sized buffer.
+	MemoryAlignment int                 // Defaults to minimal valid alignment.
+	Entry           string              // No entry function by default.
+	EntryPolicy     EntryPolicy         // Defaults to binding.GetMainFunc.
+	EntryArgs       []uint64            // Must match entry function's parameters.
+	Entries         map[string][]uint64 // Additional entry functions and arguments.
+	BoundsChecks    bool                // See compile.CodeConfig.
+	DebugInfo       bool                // Map instructions and load DWARF sections.
 }
 
 // Object code with debug information.  The fields are roughly in order of
@@ -38,15 +43,18 @@ type Config struct {
 // Executing the code requires a platform-specific mechanism; it's not
 // supported by this package.
 type Object struct {
-	FuncTypes         []wa.FuncType       // Signatures for debug output.
-	InitialMemorySize int                 // Current memory allocation.
-	MemorySizeLimit   int                 // Maximum valid value if not limited.
-	Text              []byte              // Machine code and read-only data.
-	debug.InsnMap                         // Stack unwinding and debug metadata.
-	MemoryOffset      int                 // Threshold between globals and memory.
-	GlobalsMemory     []byte              // Global values and memory contents.
-	StackFrame        []byte              // Entry function address and arguments.
-	Names             section.NameSection // Symbols for debug output.
+	FuncTypes         []wa.FuncType          // Signatures for debug output.
+	InitialMemorySize int                    // Current memory allocation.
+	MemorySizeLimit   int                    // Maximum valid value if not limited.
+	Text              []byte                 // Machine code and read-only data.
+	debug.InsnMap                            // Stack unwinding and debug metadata.
+	MemoryOffset      int                    // Threshold between globals and memory.
+	GlobalsMemory     []byte                 // Global values and memory contents.
+	ExportFuncs       map[string]ExportFunc  // Export functions by name.
+	StackFrame        []byte                 // Entry function address and arguments.
+	EntryFrames       map[string][]byte      // Stack frames by entry function name.
+	Names             section.NameSection    // Symbols for debug output.
+	Debug             section.CustomSections // DWARF sections if DebugInfo was configured.
 }
 
 // Compile a WebAssembly binary module into machine code.  The Object is
@@ -71,6 +79,21 @@ func Compile(objectConfig *Config, r compile.Reader, imports binding.ImportResol
 		section.CustomName: object.Names.Load,
 	}
 
+	// Instruction positions are tracked via a pass-through reader.  The
+	// reader must be used for all sections, so that the source positions
+	// are correct.
+
+	var mapper compile.ObjectMapper = &object.CallMap
+
+	if objectConfig.DebugInfo {
+		r = object.InsnMap.Reader(r)
+		mapper = &object.InsnMap
+
+		for _, name := range section.CustomDWARFNames {
+			customSections[name] = object.Debug.Load
+		}
+	}
+
 	var loadingConfig = compile.Config{
 		CustomSectionLoader: customSections.Load,
 	}
@@ -92,6 +115,15 @@ func Compile(objectConfig *Config, r compile.Reader, imports binding.ImportResol
 		return
 	}
 
+	// Export function signatures are retained so that entry stack frames can
+	// be formed after compilation (see Object.EntryFrame).
+
+	object.ExportFuncs = make(map[string]ExportFunc)
+	for name, index := range module.ExportFuncs() {
+		_, sig, _ := module.ExportFunc(name)
+		object.ExportFuncs[name] = ExportFunc{index, sig}
+	}
+
 	// Fill in host function addresses and global variables' values.
 
 	err = binding.BindImports(&module, imports)
@@ -102,13 +134,15 @@ func Compile(objectConfig *Config, r compile.Reader, imports binding.ImportResol
 	// Generate executable code and debug information while reading the
 	// WebAssembly code section.  Text encodes the import function vector
 	// indexes, but not the function addresses (the vector can be mapped
-	// separately during execution).  It is also independent of entry function
-	// choice and program state.
+	// separately during execution), unless the resolver binds some functions
+	// to native addresses (see object.Relocate).  It is also independent of
+	// entry function choice and program state.
 
 	var codeConfig = &compile.CodeConfig{
-		Text:   objectConfig.Text,
-		Mapper: &object.CallMap,
-		Config: loadingConfig,
+		Text:         objectConfig.Text,
+		Mapper:       mapper,
+		BoundsChecks: objectConfig.BoundsChecks,
+		Config:       loadingConfig,
 	}
 
 	err = compile.LoadCodeSection(codeConfig, r, module)
@@ -148,11 +182,11 @@ func Compile(objectConfig *Config, r compile.Reader, imports binding.ImportResol
 		entryAddr  uint32
 	)
 
-	if objectConfig.Entry != "" {
-		if objectConfig.EntryPolicy == nil {
-			objectConfig.EntryPolicy = binding.GetMainFunc
-		}
+	if objectConfig.EntryPolicy == nil {
+		objectConfig.EntryPolicy = binding.GetMainFunc
+	}
 
+	if objectConfig.Entry != "" {
 		entryIndex, entryType, err = objectConfig.EntryPolicy(&module, objectConfig.Entry)
 		if err != nil {
 			return
@@ -162,18 +196,50 @@ func Compile(objectConfig *Config, r compile.Reader, imports binding.ImportResol
 	}
 
 	// Form a stack frame for the init routine which calls the entry function.
-	// Add zeros if all arguments weren't provided but the policy was lenient.
-
-	var entryArgs []uint64
+	// The policy may be lenient, but the argument count must still match.
 
-	if n := len(entryType.Params); len(objectConfig.EntryArgs) >= n {
-		entryArgs = objectConfig.EntryArgs[:n]
-	} else {
-		entryArgs = make([]uint64, n)
-		copy(entryArgs, objectConfig.EntryArgs)
+	if objectConfig.Entry != "" {
+		err = checkEntryArgs(objectConfig.Entry, entryType, objectConfig.EntryArgs)
+		if err != nil {
+			return
+		}
 	}
 
-	object.StackFrame = stack.EntryFrame(entryAddr, entryArgs)
+	object.StackFrame = stack.EntryFrame(entryAddr, objectConfig.EntryArgs)
+
+	// Form stack frames for the additional entry functions using the same
+	// policy.  The table includes also the primary entry function.
+
+	if objectConfig.Entry != "" || len(objectConfig.Entries) > 0 {
+		object.EntryFrames = make(map[string][]byte)
+
+		if objectConfig.Entry != "" {
+			object.EntryFrames[objectConfig.Entry] = object.StackFrame
+		}
+
+		names := make([]string, 0, len(objectConfig.Entries))
+		for name := range objectConfig.Entries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			index, sig, e := objectConfig.EntryPolicy(&module, name)
+			if e != nil {
+				err = e
+				return
+			}
+
+			args := objectConfig.Entries[name]
+
+			err = checkEntryArgs(name, sig, args)
+			if err != nil {
+				return
+			}
+
+			object.EntryFrames[name] = stack.EntryFrame(object.FuncAddrs[index], args)
+		}
+	}
 
 	// Read the whole binary module to get the name section.
 
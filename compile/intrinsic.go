@@ -0,0 +1,27 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compile
+
+import (
+	"github.com/tsavola/wag/internal/isa/prop"
+	"github.com/tsavola/wag/internal/module"
+)
+
+// Intrinsic is an import function implementation which is generated inline
+// instead of calling a host function.  Intrinsic.Type returns the signature
+// which the import function must have.
+type Intrinsic = module.Intrinsic
+
+const (
+	IntrinsicMemcpy     = module.IntrinsicMemcpy     // (dest i32, src i32, n i32) i32
+	IntrinsicMemset     = module.IntrinsicMemset     // (dest i32, c i32, n i32) i32
+	IntrinsicSqrtF32    = module.IntrinsicSqrtF32    // (f32) f32
+	IntrinsicSqrtF64    = module.IntrinsicSqrtF64    // (f64) f64
+	IntrinsicCycleCount = module.IntrinsicCycleCount // () i64
+)
+
+// IntrinsicsSupported is false if intrinsics can't be generated for the target
+// architecture.  Import functions must then be bound via the import vector.
+const IntrinsicsSupported = prop.Intrinsics
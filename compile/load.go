@@ -98,6 +98,12 @@ type Config struct {
 // ModuleConfig for a single compiler invocation.
 type ModuleConfig struct {
 	Config
+
+	// ImportTableAndMemory permits the module to import its table and memory.
+	// The loader merely records the imports (see Module.ImportTable and
+	// Module.ImportMemory); binding them is up to the caller, so they are
+	// rejected by default.
+	ImportTableAndMemory bool
 }
 
 // Module contains a WebAssembly module specification without code or data.
@@ -228,7 +234,7 @@ func loadTypeSection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
 	}
 }
 
-func loadImportSection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
+func loadImportSection(m *Module, config *ModuleConfig, _ uint32, load loader.L) {
 	for i := range load.Count(module.MaxImports, "import") {
 		moduleLen := load.Varuint32()
 		if moduleLen > maxStringLen {
@@ -282,6 +288,40 @@ func loadImportSection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
 				Field:  fieldStr,
 			})
 
+		case module.ExternalKindTable:
+			if !config.ImportTableAndMemory {
+				panic(module.Errorf("import kind not supported: %s", kind))
+			}
+			if m.m.TableImported {
+				panic(module.Error("multiple tables not supported"))
+			}
+
+			if elementType := load.Varint7(); elementType != -0x10 {
+				panic(module.Errorf("unsupported table element type in import #%d: %d", i, elementType))
+			}
+
+			m.m.TableLimitValues = readResizableLimits(load, maxTableLimit, maxTableLimit, 1)
+			m.m.ImportTable = module.Import{
+				Module: moduleStr,
+				Field:  fieldStr,
+			}
+			m.m.TableImported = true
+
+		case module.ExternalKindMemory:
+			if !config.ImportTableAndMemory {
+				panic(module.Errorf("import kind not supported: %s", kind))
+			}
+			if m.m.MemoryImported {
+				panic(module.Error("multiple memories not supported"))
+			}
+
+			m.m.MemoryLimitValues = readResizableLimits(load, maxInitialMemoryLimit, maxMaximumMemoryLimit, wa.PageSize)
+			m.m.ImportMemory = module.Import{
+				Module: moduleStr,
+				Field:  fieldStr,
+			}
+			m.m.MemoryImported = true
+
 		default:
 			panic(module.Errorf("import kind not supported: %s", kind))
 		}
@@ -304,6 +344,10 @@ func loadTableSection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
 	case 0:
 
 	case 1:
+		if m.m.TableImported {
+			panic(module.Error("multiple tables not supported"))
+		}
+
 		if elementType := load.Varint7(); elementType != -0x10 {
 			panic(module.Errorf("unsupported table element type: %d", elementType))
 		}
@@ -320,6 +364,10 @@ func loadMemorySection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
 	case 0:
 
 	case 1:
+		if m.m.MemoryImported {
+			panic(module.Error("multiple memories not supported"))
+		}
+
 		m.m.MemoryLimitValues = readResizableLimits(load, maxInitialMemoryLimit, maxMaximumMemoryLimit, wa.PageSize)
 
 	default:
@@ -361,7 +409,13 @@ func loadExportSection(m *Module, _ *ModuleConfig, _ uint32, load loader.L) {
 			}
 			m.m.ExportFuncs[string(fieldStr)] = index
 
-		case module.ExternalKindTable, module.ExternalKindMemory, module.ExternalKindGlobal:
+		case module.ExternalKindTable:
+			m.m.ExportTables = append(m.m.ExportTables, string(fieldStr))
+
+		case module.ExternalKindMemory:
+			m.m.ExportMemories = append(m.m.ExportMemories, string(fieldStr))
+
+		case module.ExternalKindGlobal:
 
 		default:
 			panic(module.Errorf("custom export kind: %s", kind))
@@ -468,14 +522,99 @@ func (m Module) ImportGlobal(i int) (module, field string, t wa.Type) {
 func (m *Module) SetImportFunc(i int, vecIndex int)  { m.m.ImportFuncs[i].VecIndex = vecIndex }
 func (m *Module) SetImportGlobal(i int, init uint64) { m.m.Globals[i].Init = init }
 
+// SetImportFuncVariadic is like SetImportFunc, but the import function's
+// trampoline passes the argument count and signature index to the function.
+func (m *Module) SetImportFuncVariadic(i int, vecIndex int) {
+	imp := &m.m.ImportFuncs[i]
+	imp.VecIndex = vecIndex
+	imp.Variadic = true
+	imp.Native = false
+	imp.Intrinsic = module.IntrinsicNone
+}
+
+// SetImportFuncIntrinsic causes an import function to be generated inline.
+// The function must have the intrinsic's signature.
+func (m *Module) SetImportFuncIntrinsic(i int, x Intrinsic) {
+	imp := &m.m.ImportFuncs[i]
+	imp.Variadic = false
+	imp.Native = false
+	imp.Intrinsic = x
+}
+
+// SetImportFuncNative binds an import function directly to native code.  It is
+// called without going through the import vector.  An absolute address causes
+// relocations to be recorded via ObjectMapper; a text-relative address is a
+// sign-extended 32-bit offset.  Variadic calling convention is not supported.
+func (m *Module) SetImportFuncNative(i int, addr uint64, absolute bool) {
+	imp := &m.m.ImportFuncs[i]
+	imp.Variadic = false
+	imp.Intrinsic = module.IntrinsicNone
+	imp.Native = true
+	imp.NativeAbs = absolute
+	imp.NativeAddr = addr
+}
+
+// ImportTable returns the table import's name, if the table is imported.
+func (m Module) ImportTable() (module, field string, imported bool) {
+	imp := m.m.ImportTable
+	return imp.Module, imp.Field, m.m.TableImported
+}
+
+// ImportMemory returns the memory import's name, if the memory is imported.
+func (m Module) ImportMemory() (module, field string, imported bool) {
+	imp := m.m.ImportMemory
+	return imp.Module, imp.Field, m.m.MemoryImported
+}
+
+// TableFuncs returns the function indexes of the table elements.  Elements
+// which are not initialized by the module are out of the function index range.
+func (m Module) TableFuncs() []uint32 { return m.m.TableFuncs }
+
+// ResizeTable sets the number of table elements.  Added elements are not
+// initialized.  The table cannot be shrunk.
+func (m *Module) ResizeTable(size int) {
+	if size < len(m.m.TableFuncs) {
+		panic("table cannot be shrunk")
+	}
+
+	for len(m.m.TableFuncs) < size {
+		m.m.TableFuncs = append(m.m.TableFuncs, math.MaxInt32) // invalid function index
+	}
+}
+
+// ReserveGlobals makes room for other modules' globals in front of this
+// module's globals (before) and between them and linear memory (after).  The
+// sizes are in words.  It must be called before code generation.
+func (m *Module) ReserveGlobals(before, after int) {
+	m.m.GlobalsBefore = before
+	m.m.GlobalsAfter = after
+}
+
 func (m Module) GlobalsSize() int {
-	size := len(m.m.Globals) * obj.Word
+	size := (m.m.GlobalsBefore + len(m.m.Globals) + m.m.GlobalsAfter) * obj.Word
 	mask := datalayout.MinAlignment - 1 // Round up so that linear memory will
 	return (size + mask) &^ mask        // have at least minimum alignment.
 }
 
 func (m Module) ExportFuncs() map[string]uint32 { return m.m.ExportFuncs }
 
+func (m Module) ExportTable(field string) bool  { return hasString(m.m.ExportTables, field) }
+func (m Module) ExportMemory(field string) bool { return hasString(m.m.ExportMemories, field) }
+
+func hasString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// StartFunc returns the index of the start function, if it is defined.
+func (m Module) StartFunc() (funcIndex uint32, defined bool) {
+	return m.m.StartIndex, m.m.StartDefined
+}
+
 func (m Module) ExportFunc(field string) (funcIndex uint32, sig wa.FuncType, found bool) {
 	funcIndex, found = m.m.ExportFuncs[field]
 	if found {
@@ -493,6 +632,7 @@ type CodeConfig struct {
 	Mapper       ObjectMapper
 	EventHandler func(event.Event)
 	LastInitFunc uint32
+	BoundsChecks bool // Check memory accesses against maximum memory size.
 	Config
 }
 
@@ -556,7 +696,7 @@ func loadCodeSection(config *CodeConfig, r Reader, mod Module) {
 		mapper = dummyMap{}
 	}
 
-	codegen.GenProgram(config.Text, mapper, load, &mod.m, config.EventHandler, int(config.LastInitFunc)+1)
+	codegen.GenProgram(config.Text, mapper, load, &mod.m, config.EventHandler, int(config.LastInitFunc)+1, config.BoundsChecks)
 }
 
 // DataConfig for a single compiler invocation.
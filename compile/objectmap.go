@@ -6,15 +6,18 @@ package compile
 
 import (
 	"github.com/tsavola/wag/internal/obj"
+	"github.com/tsavola/wag/trap"
 )
 
 type ObjectMapper = obj.ObjectMapper
 
 type dummyMap struct{}
 
-func (dummyMap) InitObjectMap(int, int)     {}
-func (dummyMap) PutImportFuncAddr(uint32)   {}
-func (dummyMap) PutFuncAddr(uint32)         {}
-func (dummyMap) PutCallSite(uint32, int32)  {}
-func (dummyMap) PutInsnAddr(uint32)         {}
-func (dummyMap) PutDataBlock(uint32, int32) {}
+func (dummyMap) InitObjectMap(int, int)             {}
+func (dummyMap) PutImportFuncAddr(uint32)           {}
+func (dummyMap) PutImportReloc(uint32, int, uint64) {}
+func (dummyMap) PutTrapAddr(trap.ID, uint32)        {}
+func (dummyMap) PutFuncAddr(uint32)                 {}
+func (dummyMap) PutCallSite(uint32, int32)          {}
+func (dummyMap) PutInsnAddr(uint32)                 {}
+func (dummyMap) PutDataBlock(uint32, int32)         {}
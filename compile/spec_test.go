@@ -439,7 +439,7 @@ func testModule(t *testing.T, wast []byte, filename string, quiet bool) []byte {
 			CustomSectionLoader: section.CustomLoaders{section.CustomName: nameSection.Load}.Load,
 		}
 
-		mod := loadInitialSections(&ModuleConfig{common}, wasm)
+		mod := loadInitialSections(&ModuleConfig{Config: common}, wasm)
 		bindVariadicImports(&mod, runner.Resolver)
 
 		var timedout bool
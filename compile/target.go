@@ -0,0 +1,28 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compile
+
+import (
+	"github.com/tsavola/wag/internal/gen/codegen"
+)
+
+// Optional x86-64 CPU features which may be used by generated code.
+const (
+	FeatureLZCNT = 1 << iota
+	FeaturePOPCNT
+	FeatureTZCNT
+)
+
+// TargetISA of generated machine code: "amd64" or "arm64".
+func TargetISA() string {
+	return codegen.TargetISA
+}
+
+// TargetFeatures is a bit mask of the optional CPU features which generated
+// code may use.  Machine code is not portable between CPUs with different
+// feature sets.
+func TargetFeatures() uint64 {
+	return codegen.TargetFeatures()
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wag
+
+import (
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/object/stack"
+	"github.com/tsavola/wag/wa"
+)
+
+// ExportFunc is an export function's index and signature.
+type ExportFunc struct {
+	Index uint32
+	wa.FuncType
+}
+
+// EntryFrame forms a stack frame for the init routine which calls the named
+// export function.  The argument count must match the function's parameter
+// count exactly.  The frame is also added to EntryFrames.
+//
+// This can be used after compilation (or after the Object has been restored
+// from storage) without access to the WebAssembly module.
+func (o *Object) EntryFrame(name string, args []uint64) (frame []byte, err error) {
+	f, found := o.ExportFuncs[name]
+	if !found {
+		err = &binding.EntryError{Names: []string{name}}
+		return
+	}
+
+	if err = checkEntryArgs(name, f.FuncType, args); err != nil {
+		return
+	}
+
+	if int(f.Index) >= len(o.FuncAddrs) {
+		err = module.Errorf("export function %q is not available in text", name)
+		return
+	}
+
+	frame = stack.EntryFrame(o.FuncAddrs[f.Index], args)
+
+	if o.EntryFrames == nil {
+		o.EntryFrames = make(map[string][]byte)
+	}
+	o.EntryFrames[name] = frame
+	return
+}
+
+// checkEntryArgs returns binding.EntryError if the argument count doesn't
+// match the parameter count.
+func checkEntryArgs(name string, sig wa.FuncType, args []uint64) error {
+	if len(args) == len(sig.Params) {
+		return nil
+	}
+
+	return &binding.EntryError{
+		Names: []string{name},
+		Found: true,
+		Sig:   sig,
+		Args:  append([]uint64{}, args...),
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package wag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/object/stack"
+	"github.com/tsavola/wag/wa"
+)
+
+// Exports main(i32, i32) i32 and run() i64.
+const testEntryModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0e\x03\x60\x00\x00\x60\x02\x7f\x7f\x01\x7f\x60\x00\x01\x7e\x03\x03\x02\x01\x02\x07\x0e\x02\x04\x6d\x61\x69\x6e\x00\x00\x03\x72\x75\x6e\x00\x01\x0a\x0b\x02\x04\x00\x41\x00\x0b\x04\x00\x42\x00\x0b"
+
+func TestEntryFrames(t *testing.T) {
+	config := &Config{
+		Entries: map[string][]uint64{
+			"main": {1, 2, 3},
+			"run":  nil,
+		},
+		EntryPolicy: binding.GetExactFunc(nil, wa.I64),
+	}
+
+	if _, err := Compile(config, strings.NewReader(testEntryModule), binding.StubMissing{}); err == nil {
+		t.Error("policy was not applied to additional entry functions")
+	}
+
+	config = &Config{
+		Entries: map[string][]uint64{
+			"main": {1, 2, 3},
+		},
+	}
+
+	if _, err := Compile(config, strings.NewReader(testEntryModule), binding.StubMissing{}); err == nil {
+		t.Error("argument count of additional entry function was not checked")
+	}
+
+	config = &Config{
+		Entry:       "run",
+		EntryPolicy: binding.GetExactFunc(nil, wa.I64),
+		EntryArgs:   []uint64{1},
+	}
+
+	if _, err := Compile(config, strings.NewReader(testEntryModule), binding.StubMissing{}); err == nil {
+		t.Error("argument count of primary entry function was not checked")
+	} else if e, ok := err.(*binding.EntryError); !ok || len(e.Args) != 1 {
+		t.Errorf("%#v", err)
+	}
+
+	config = &Config{
+		Entries: map[string][]uint64{
+			"main": {1, 2},
+		},
+	}
+
+	obj, err := Compile(config, strings.NewReader(testEntryModule), binding.StubMissing{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(obj.ExportFuncs) != 2 || obj.ExportFuncs["run"].Result != wa.I64 {
+		t.Error(obj.ExportFuncs)
+	}
+	if addr := binary.LittleEndian.Uint64(obj.StackFrame); addr != 0 {
+		t.Errorf("primary entry address: 0x%x", addr)
+	}
+	if len(obj.EntryFrames) != 1 || !bytes.Equal(obj.EntryFrames["main"], stack.EntryFrame(obj.FuncAddrs[0], []uint64{1, 2})) {
+		t.Error(obj.EntryFrames)
+	}
+
+	frame, err := obj.EntryFrame("run", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, stack.EntryFrame(obj.FuncAddrs[1], nil)) || !bytes.Equal(obj.EntryFrames["run"], frame) {
+		t.Error(frame)
+	}
+
+	if _, err := obj.EntryFrame("main", []uint64{1}); err == nil {
+		t.Error("argument count was not checked")
+	}
+	if _, err := obj.EntryFrame("start", nil); err == nil {
+		t.Error("missing function was found")
+	}
+}
@@ -26,6 +26,7 @@ type call struct {
 	number  int
 	params  int
 	ptrMask int
+	format  string // Parameter formats; see traceSyscall in cmd/wasys/trace.go.
 }
 
 func (sc call) titleName() string {
@@ -45,6 +46,24 @@ func main() {
 	}
 	defer impl.Close()
 
+	nums, err := os.Create(fmt.Sprintf("cmd/wasys/syscall_%s.go", runtime.GOARCH))
+	if err != nil {
+		log.Panic(err)
+	}
+	defer nums.Close()
+
+	traceDecl, err := os.Create("cmd/wasys/syscall_trace.go")
+	if err != nil {
+		log.Panic(err)
+	}
+	defer traceDecl.Close()
+
+	traceImpl, err := os.Create(fmt.Sprintf("cmd/wasys/syscall_trace_%s.s", runtime.GOARCH))
+	if err != nil {
+		log.Panic(err)
+	}
+	defer traceImpl.Close()
+
 	fmt.Fprintf(decl, "// Generated by internal/cmd/syscalls/generate.go\n\n")
 	fmt.Fprintf(decl, "package main\n\n")
 	fmt.Fprintf(decl, "import \"encoding/binary\"\n\n")
@@ -64,6 +83,7 @@ func main() {
 	fmt.Fprintf(decl, "\timportVector = make([]byte, %d)\n", (len(syscalls)+3)*8)
 	fmt.Fprintf(decl, "\tbinary.LittleEndian.PutUint64(importVector[%d:], importTrapHandler())\n", (len(syscalls)+2)*8)
 	fmt.Fprintf(decl, "\tbinary.LittleEndian.PutUint64(importVector[%d:], importGrowMemory())\n", (len(syscalls)+1)*8)
+	fmt.Fprintf(decl, "\tbinary.LittleEndian.PutUint64(importVector[%d:], importCurrentMemory())\n", (len(syscalls)+0)*8)
 
 	for i, sc := range syscalls {
 		offset := (len(syscalls) - i - 1) * 8
@@ -77,9 +97,61 @@ func main() {
 
 	fmt.Fprintf(decl, "}\n") // init()
 
-	fmt.Fprintf(decl, "\nfunc setImportVectorCurrentMemory(size int) {\n")
-	fmt.Fprintf(decl, "\tbinary.LittleEndian.PutUint64(importVector[%d:], uint64(size))\n", (len(syscalls)+0)*8)
-	fmt.Fprintf(decl, "}\n")
+	fmt.Fprintf(nums, "// Generated by internal/cmd/syscalls/generate.go\n\n")
+	fmt.Fprintf(nums, "package main\n\n")
+	fmt.Fprintf(nums, "var importSyscallNumbers = map[string]uintptr{\n")
+
+	for _, sc := range syscalls {
+		fmt.Fprintf(nums, "\t%q: %d,\n", sc.name, sc.number)
+	}
+
+	fmt.Fprintf(nums, "}\n")
+
+	fmt.Fprintf(traceDecl, "// Generated by internal/cmd/syscalls/generate.go\n\n")
+	fmt.Fprintf(traceDecl, "package main\n\n")
+
+	for _, sc := range syscalls {
+		fmt.Fprintf(traceDecl, "func trace%s() uint64\n", sc.titleName())
+	}
+
+	fmt.Fprintf(traceDecl, "\nvar traceSyscalls = []traceSyscall{\n")
+
+	for _, sc := range syscalls {
+		fmt.Fprintf(traceDecl, "\t{%q, %d, %q, trace%s},\n", sc.name, sc.ptrMask, sc.format, sc.titleName())
+	}
+
+	fmt.Fprintf(traceDecl, "}\n")
+
+	fmt.Fprintf(traceImpl, "// Generated by internal/cmd/syscalls/generate.go\n\n")
+	fmt.Fprintf(traceImpl, "#include \"go_asm.h\"\n")
+	fmt.Fprintf(traceImpl, "#include \"textflag.h\"\n\n")
+	fmt.Fprintf(traceImpl, "%s\n", traceMacros[runtime.GOARCH])
+
+	for i, sc := range syscalls {
+		fmt.Fprintf(traceImpl, "TRACEFUNC(·trace%s, trace%s<>, const_hostTraceBase+%d)\n", sc.titleName(), sc.titleName(), i)
+	}
+}
+
+// Trace stubs make host call number hostTraceBase+i, where i is the index of
+// the syscall.
+var traceMacros = map[string]string{
+	"amd64": `#define TRACEFUNC(NAME, STUB, NUM) \
+	TEXT NAME(SB),$0-8; \
+	LEAQ	STUB(SB), AX; \
+	MOVQ	AX, ret+0(FP); \
+	RET; \
+	TEXT STUB(SB),NOSPLIT,$0; \
+	MOVL	$(NUM), CX; \
+	JMP	·hostCall(SB)
+`,
+	"arm64": `#define TRACEFUNC(NAME, STUB, NUM) \
+	TEXT NAME(SB),$0-8; \
+	BL	3(PC); \
+	MOVD	$(NUM), R1; \
+	JMP	·hostCall(SB); \
+	MOVD	LR, ret+0(FP); \
+	RET
+`,
 }
 
 var x86Regs = []string{"DI", "SI", "DX", "R10", "R8", "R9"}
@@ -142,55 +214,55 @@ var generators = map[string]func(io.Writer, call){
 }
 
 var syscalls = []call{
-	{"read", syscall.SYS_READ, 3, ptr2},
-	{"write", syscall.SYS_WRITE, 3, ptr2},
-	{"close", syscall.SYS_CLOSE, 1, 0},
-	{"lseek", syscall.SYS_LSEEK, 3, 0},
-	{"pread", syscall.SYS_PREAD64, 4, ptr2},
-	{"pwrite", syscall.SYS_PWRITE64, 4, ptr2},
-	{"dup", syscall.SYS_DUP, 1, 0},
-	{"getpid", syscall.SYS_GETPID, 0, 0},
-	{"sendfile", syscall.SYS_SENDFILE, 4, ptr3},
-	{"shutdown", syscall.SYS_SHUTDOWN, 2, 0},
-	{"socketpair", syscall.SYS_SOCKETPAIR, 4, ptr4},
-	{"flock", syscall.SYS_FLOCK, 2, 0},
-	{"fsync", syscall.SYS_FSYNC, 1, 0},
-	{"fdatasync", syscall.SYS_FDATASYNC, 1, 0},
-	{"truncate", syscall.SYS_TRUNCATE, 2, ptr1},
-	{"ftruncate", syscall.SYS_FTRUNCATE, 2, 0},
-	{"getcwd", syscall.SYS_GETCWD, 2, ptr1},
-	{"chdir", syscall.SYS_CHDIR, 1, ptr1},
-	{"fchdir", syscall.SYS_FCHDIR, 1, 0},
-	{"fchmod", syscall.SYS_FCHMOD, 2, 0},
-	{"fchown", syscall.SYS_FCHOWN, 3, 0},
-	{"lchown", syscall.SYS_LCHOWN, 3, ptr1},
-	{"umask", syscall.SYS_UMASK, 1, 0},
-	{"getuid", syscall.SYS_GETUID, 0, 0},
-	{"getgid", syscall.SYS_GETGID, 0, 0},
-	{"vhangup", syscall.SYS_VHANGUP, 0, 0},
-	{"sync", syscall.SYS_SYNC, 0, 0},
-	{"gettid", syscall.SYS_GETTID, 0, 0},
-	{"time", syscall.SYS_TIME, 1, ptr1},
-	{"posix_fadvise", syscall.SYS_FADVISE64, 4, 0},
-	{"_exit", syscall.SYS_EXIT_GROUP, 1, 0},
-	{"inotify_init1", syscall.SYS_INOTIFY_INIT1, 0, 0},
-	{"inotify_add_watch", syscall.SYS_INOTIFY_ADD_WATCH, 3, ptr2},
-	{"inotify_rm_watch", syscall.SYS_INOTIFY_RM_WATCH, 2, 0},
-	{"openat", syscall.SYS_OPENAT, 4, ptr2},
-	{"mkdirat", syscall.SYS_MKDIRAT, 3, ptr2},
-	{"fchownat", syscall.SYS_FCHOWNAT, 5, ptr2},
-	{"unlinkat", syscall.SYS_UNLINKAT, 3, ptr2},
-	{"renameat", syscall.SYS_RENAMEAT, 4, ptr2 | ptr4},
-	{"linkat", syscall.SYS_LINKAT, 5, ptr2 | ptr4},
-	{"symlinkat", syscall.SYS_SYMLINKAT, 3, ptr1 | ptr3},
-	{"readlinkat", syscall.SYS_READLINKAT, 4, ptr2 | ptr3},
-	{"fchmodat", syscall.SYS_FCHMODAT, 4, ptr2},
-	{"faccessat", syscall.SYS_FACCESSAT, 4, ptr2},
-	{"splice", syscall.SYS_SPLICE, 6, ptr2 | ptr4},
-	{"tee", syscall.SYS_TEE, 4, 0},
-	{"sync_file_range", syscall.SYS_SYNC_FILE_RANGE, 4, 0},
-	{"fallocate", syscall.SYS_FALLOCATE, 4, 0},
-	{"eventfd", syscall.SYS_EVENTFD2, 2, 0},
-	{"dup3", syscall.SYS_DUP3, 3, 0},
-	{"pipe2", syscall.SYS_PIPE2, 2, ptr1},
+	{"read", syscall.SYS_READ, 3, ptr2, "d,out3,d"},
+	{"write", syscall.SYS_WRITE, 3, ptr2, "d,in3,d"},
+	{"close", syscall.SYS_CLOSE, 1, 0, "d"},
+	{"lseek", syscall.SYS_LSEEK, 3, 0, "d,d,d"},
+	{"pread", syscall.SYS_PREAD64, 4, ptr2, "d,out3,d,d"},
+	{"pwrite", syscall.SYS_PWRITE64, 4, ptr2, "d,in3,d,d"},
+	{"dup", syscall.SYS_DUP, 1, 0, "d"},
+	{"getpid", syscall.SYS_GETPID, 0, 0, ""},
+	{"sendfile", syscall.SYS_SENDFILE, 4, ptr3, "d,d,p,d"},
+	{"shutdown", syscall.SYS_SHUTDOWN, 2, 0, "d,d"},
+	{"socketpair", syscall.SYS_SOCKETPAIR, 4, ptr4, "d,d,d,p"},
+	{"flock", syscall.SYS_FLOCK, 2, 0, "d,d"},
+	{"fsync", syscall.SYS_FSYNC, 1, 0, "d"},
+	{"fdatasync", syscall.SYS_FDATASYNC, 1, 0, "d"},
+	{"truncate", syscall.SYS_TRUNCATE, 2, ptr1, "s,d"},
+	{"ftruncate", syscall.SYS_FTRUNCATE, 2, 0, "d,d"},
+	{"getcwd", syscall.SYS_GETCWD, 2, ptr1, "out2,d"},
+	{"chdir", syscall.SYS_CHDIR, 1, ptr1, "s"},
+	{"fchdir", syscall.SYS_FCHDIR, 1, 0, "d"},
+	{"fchmod", syscall.SYS_FCHMOD, 2, 0, "d,o"},
+	{"fchown", syscall.SYS_FCHOWN, 3, 0, "d,d,d"},
+	{"lchown", syscall.SYS_LCHOWN, 3, ptr1, "s,d,d"},
+	{"umask", syscall.SYS_UMASK, 1, 0, "o"},
+	{"getuid", syscall.SYS_GETUID, 0, 0, ""},
+	{"getgid", syscall.SYS_GETGID, 0, 0, ""},
+	{"vhangup", syscall.SYS_VHANGUP, 0, 0, ""},
+	{"sync", syscall.SYS_SYNC, 0, 0, ""},
+	{"gettid", syscall.SYS_GETTID, 0, 0, ""},
+	{"time", syscall.SYS_TIME, 1, ptr1, "p"},
+	{"posix_fadvise", syscall.SYS_FADVISE64, 4, 0, "d,d,d,d"},
+	{"_exit", syscall.SYS_EXIT_GROUP, 1, 0, "d"},
+	{"inotify_init1", syscall.SYS_INOTIFY_INIT1, 0, 0, ""},
+	{"inotify_add_watch", syscall.SYS_INOTIFY_ADD_WATCH, 3, ptr2, "d,s,x"},
+	{"inotify_rm_watch", syscall.SYS_INOTIFY_RM_WATCH, 2, 0, "d,d"},
+	{"openat", syscall.SYS_OPENAT, 4, ptr2, "d,s,x,o"},
+	{"mkdirat", syscall.SYS_MKDIRAT, 3, ptr2, "d,s,o"},
+	{"fchownat", syscall.SYS_FCHOWNAT, 5, ptr2, "d,s,d,d,x"},
+	{"unlinkat", syscall.SYS_UNLINKAT, 3, ptr2, "d,s,x"},
+	{"renameat", syscall.SYS_RENAMEAT, 4, ptr2 | ptr4, "d,s,d,s"},
+	{"linkat", syscall.SYS_LINKAT, 5, ptr2 | ptr4, "d,s,d,s,x"},
+	{"symlinkat", syscall.SYS_SYMLINKAT, 3, ptr1 | ptr3, "s,d,s"},
+	{"readlinkat", syscall.SYS_READLINKAT, 4, ptr2 | ptr3, "d,s,out4,d"},
+	{"fchmodat", syscall.SYS_FCHMODAT, 4, ptr2, "d,s,o,x"},
+	{"faccessat", syscall.SYS_FACCESSAT, 4, ptr2, "d,s,o,x"},
+	{"splice", syscall.SYS_SPLICE, 6, ptr2 | ptr4, "d,p,d,p,d,x"},
+	{"tee", syscall.SYS_TEE, 4, 0, "d,d,d,x"},
+	{"sync_file_range", syscall.SYS_SYNC_FILE_RANGE, 4, 0, "d,d,d,x"},
+	{"fallocate", syscall.SYS_FALLOCATE, 4, 0, "d,x,d,d"},
+	{"eventfd", syscall.SYS_EVENTFD2, 2, 0, "d,x"},
+	{"dup3", syscall.SYS_DUP3, 3, 0, "d,d,x"},
+	{"pipe2", syscall.SYS_PIPE2, 2, ptr1, "p,x"},
 }
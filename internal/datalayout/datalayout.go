@@ -26,7 +26,7 @@ const (
 )
 
 func MemoryOffset(m *module.M, alignment int) int {
-	globalsSize := len(m.Globals) * obj.Word
+	globalsSize := (m.GlobalsBefore + len(m.Globals) + m.GlobalsAfter) * obj.Word
 
 	mask := alignment - 1
 	return (globalsSize + mask) &^ mask
@@ -34,7 +34,7 @@ func MemoryOffset(m *module.M, alignment int) int {
 
 func CopyGlobalsAlign(buffer data.Buffer, m *module.M, memoryOffset int) {
 	globalsSize := len(m.Globals) * obj.Word
-	globalsOffset := memoryOffset - globalsSize
+	globalsOffset := memoryOffset - m.GlobalsAfter*obj.Word - globalsSize
 
 	b := buffer.ResizeBytes(memoryOffset)
 	b = b[globalsOffset:]
@@ -14,3 +14,8 @@ var (
 	asm    arm.MacroAssembler
 	linker arm.Linker
 )
+
+// Target architecture and optional CPU features of generated code.
+const TargetISA = "arm64"
+
+func TargetFeatures() uint64 { return 0 }
@@ -29,6 +29,26 @@ func genCall(f *gen.Func, load loader.L, op opcode.Opcode, info opInfo) (deadend
 	}
 
 	sig := checkCallOperandCount(f, f.Module.Funcs[funcIndex])
+
+	if funcIndex < uint32(len(f.Module.ImportFuncs)) {
+		imp := f.Module.ImportFuncs[funcIndex]
+
+		switch {
+		case imp.Intrinsic != module.IntrinsicNone:
+			// No suspension point; don't finalize like a call.
+			asm.Intrinsic(&f.Prog, imp.Intrinsic, 0, f.CallStackOffset())
+			f.Regs.CheckNoneAllocated()
+			opDropCallOperands(f, len(sig.Params))
+			pushResultRegOperand(f, sig.Result)
+			return
+
+		case imp.Native:
+			opCallNative(f, int(funcIndex))
+			opFinalizeCall(f, sig)
+			return
+		}
+	}
+
 	opCall(f, &f.FuncLinks[funcIndex].L)
 	opFinalizeCall(f, sig)
 	return
@@ -99,6 +119,16 @@ func opCall(f *gen.Func, l *link.L) {
 	}
 }
 
+// opCallNative bypasses the import function's trampoline.
+func opCallNative(f *gen.Func, importIndex int) {
+	imp := f.Module.ImportFuncs[importIndex]
+	retAddr := asm.Call(&f.Prog, nativeTarget(imp))
+	f.MapCallAddr(retAddr)
+	if imp.NativeAbs {
+		f.Map.PutImportReloc(uint32(retAddr), importIndex, imp.NativeAddr)
+	}
+}
+
 func opCallIndirect(f *gen.Func, sigIndex int32, funcIndexReg reg.R) {
 	retAddr := asm.CallIndirect(f, sigIndex, funcIndexReg)
 	f.MapCallAddr(retAddr)
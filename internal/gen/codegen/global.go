@@ -14,7 +14,7 @@ import (
 )
 
 func globalOffset(f *gen.Func, index uint32) int32 {
-	return (int32(index) - int32(len(f.Module.Globals))) * obj.Word
+	return (int32(index) - int32(len(f.Module.Globals)+f.Module.GlobalsAfter)) * obj.Word
 }
 
 func genGetGlobal(f *gen.Func, load loader.L, op opcode.Opcode, info opInfo) (deadend bool) {
@@ -7,6 +7,8 @@ package codegen
 import (
 	"github.com/tsavola/wag/internal/gen"
 	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/internal/obj"
+	"github.com/tsavola/wag/trap"
 )
 
 func genImportTrampoline(p *gen.Prog, m *module.M, funcIndex int, imp module.ImportFunc) (addr int32) {
@@ -14,9 +16,40 @@ func genImportTrampoline(p *gen.Prog, m *module.M, funcIndex int, imp module.Imp
 	addr = p.Text.Addr
 	p.Map.PutImportFuncAddr(uint32(addr))
 
+	if imp.Intrinsic != module.IntrinsicNone {
+		// Arguments are behind the link address.
+		asm.Intrinsic(p, imp.Intrinsic, obj.Word, obj.Word)
+		asm.Return(p, 0)
+		return
+	}
+
+	if imp.Native {
+		asm.Branch(p, nativeTarget(imp))
+		if imp.NativeAbs {
+			p.Map.PutImportReloc(uint32(p.Text.Addr), funcIndex, imp.NativeAddr)
+		}
+		return
+	}
+
+	if imp.VecIndex == 0 {
+		// Stub for unresolved function.
+		asm.Branch(p, p.TrapLinks[trap.Unreachable].Addr)
+		return
+	}
+
 	sigIndex := m.Funcs[funcIndex]
 	sig := m.Types[sigIndex]
 
 	asm.JumpToImportFunc(p, imp.VecIndex, imp.Variadic, len(sig.Params), int(sigIndex))
 	return
 }
+
+// nativeTarget is the address used when generating a direct call or jump to a
+// native import function.  Absolute addresses are relocated later; the
+// placeholder is the NoFunction trap.
+func nativeTarget(imp module.ImportFunc) int32 {
+	if imp.NativeAbs {
+		return 0
+	}
+	return int32(imp.NativeAddr)
+}
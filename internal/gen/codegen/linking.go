@@ -0,0 +1,50 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package codegen
+
+import (
+	"github.com/tsavola/wag/internal/code"
+	"github.com/tsavola/wag/internal/gen"
+)
+
+// The code sizes of the functions generated by GenLinkCall and GenLinkInit
+// don't depend on the offsets or addresses, so they may be regenerated in
+// place after the text regions have been laid out.
+
+// GenLinkCall generates a function which calls a function of another text
+// region.
+func GenLinkCall(text *code.Buf, textOffset, funcAddr int32, argCount int) (addr int32) {
+	p := &gen.Prog{Text: *text}
+	asm.AlignFunc(p)
+	addr = p.Text.Addr
+	asm.LinkCall(p, textOffset, funcAddr, argCount)
+	*text = p.Text
+	return
+}
+
+// GenLinkInit generates a function which calls the start functions of other
+// text regions before jumping to the entry function.
+func GenLinkInit(text *code.Buf, textOffsets, funcAddrs []int32, entryAddr int32) (addr int32) {
+	p := &gen.Prog{Text: *text}
+	asm.AlignFunc(p)
+	addr = p.Text.Addr
+	asm.LinkInit(p, textOffsets, funcAddrs, entryAddr)
+	*text = p.Text
+	return
+}
+
+// GenBranch generates a jump to the target address.
+func GenBranch(text *code.Buf, target int32) {
+	p := &gen.Prog{Text: *text}
+	asm.Branch(p, target)
+	*text = p.Text
+}
+
+// PadText until the given address.
+func PadText(text *code.Buf, addr int32) {
+	p := &gen.Prog{Text: *text}
+	asm.PadUntil(p, addr)
+	*text = p.Text
+}
@@ -30,13 +30,15 @@ func GenProgram(
 	m *module.M,
 	eventHandler func(event.Event),
 	initFuncCount int,
+	boundsChecks bool,
 ) {
 	funcStorage := gen.Func{
 		Prog: gen.Prog{
-			Module:    m,
-			Text:      code.Buf{Buffer: text},
-			Map:       objMap,
-			FuncLinks: make([]link.FuncL, len(m.Funcs)),
+			Module:       m,
+			Text:         code.Buf{Buffer: text},
+			Map:          objMap,
+			FuncLinks:    make([]link.FuncL, len(m.Funcs)),
+			BoundsChecks: boundsChecks,
 		},
 	}
 	p := &funcStorage.Prog
@@ -59,6 +61,7 @@ func GenProgram(
 		panic(errors.New("unexpected initial text address"))
 	}
 	asm.JumpToTrapHandler(p, trap.NoFunction)
+	p.Map.PutTrapAddr(trap.NoFunction, abi.TextAddrNoFunction)
 
 	if p.Text.Addr == abi.TextAddrNoFunction || p.Text.Addr > abi.TextAddrResume {
 		panic("bad text address after NoFunction trap handler")
@@ -99,6 +102,7 @@ func GenProgram(
 	for id := trap.NoFunction + 1; id < trap.NumTraps; id++ {
 		asm.AlignFunc(p)
 		p.TrapLinks[id].Addr = p.Text.Addr
+		p.Map.PutTrapAddr(id, uint32(p.Text.Addr))
 
 		switch id {
 		case trap.CallStackExhausted:
@@ -14,3 +14,8 @@ var (
 	asm    x86.MacroAssembler
 	linker x86.Linker
 )
+
+// Target architecture and optional CPU features of generated code.
+const TargetISA = "amd64"
+
+func TargetFeatures() uint64 { return x86.Features() }
@@ -95,6 +95,11 @@ func (f *Func) ValueBecameUnreachable(x operand.O) {
 }
 
 func (f *Func) MapCallAddr(retAddr int32) {
+	f.Map.PutCallSite(uint32(retAddr), f.CallStackOffset())
+}
+
+// CallStackOffset is the stack offset of a call site at the current position.
+func (f *Func) CallStackOffset() int32 {
 	// Add one stack level for link address.
-	f.Map.PutCallSite(uint32(retAddr), int32((f.NumLocals+f.StackDepth+1)*obj.Word))
+	return int32((f.NumLocals + f.StackDepth + 1) * obj.Word)
 }
@@ -19,9 +19,10 @@ const (
 )
 
 type Prog struct {
-	Module    *module.M
-	Text      code.Buf
-	Map       obj.ObjectMapper
-	FuncLinks []link.FuncL
-	TrapLinks [trap.NumTraps]link.L
+	Module       *module.M
+	Text         code.Buf
+	Map          obj.ObjectMapper
+	FuncLinks    []link.FuncL
+	TrapLinks    [trap.NumTraps]link.L
+	BoundsChecks bool
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/tsavola/wag/internal/gen/reg"
 	"github.com/tsavola/wag/internal/gen/storage"
 	"github.com/tsavola/wag/internal/isa/arm/in"
+	"github.com/tsavola/wag/internal/module"
 	"github.com/tsavola/wag/internal/obj"
 	"github.com/tsavola/wag/object/abi"
 	"github.com/tsavola/wag/trap"
@@ -213,6 +214,10 @@ func (MacroAssembler) InitCallEntry(p *gen.Prog) (retAddr int32) {
 	return
 }
 
+func (MacroAssembler) Intrinsic(p *gen.Prog, x module.Intrinsic, argOffset, stackOffset int32) {
+	panic(module.Errorf("intrinsic not supported on this architecture: %s", x))
+}
+
 func (MacroAssembler) JumpToImportFunc(p *gen.Prog, index int, variadic bool, argCount, sigIndex int) {
 	var o output
 
@@ -238,6 +243,66 @@ func (MacroAssembler) JumpToImportFunc(p *gen.Prog, index int, variadic bool, ar
 	o.copy(p.Text.Extend(o.size()))
 }
 
+// LinkCall generates a function which calls a function of another text
+// region.  The arguments are copied, and the text base register is switched
+// for the duration of the call.  textOffset is the other region's position
+// relative to this region.
+func (MacroAssembler) LinkCall(p *gen.Prog, textOffset, funcAddr int32, argCount int) {
+	var o output
+
+	o.uint32(in.PushIntReg(RegLink))
+
+	for i := 0; i < argCount; i++ {
+		o.uint32(in.LDR.RdRnI12(RegScratch, RegFakeSP, uint32(argCount), wa.I64)) // Scaled by 8.
+		o.uint32(in.PushIntReg(RegScratch))
+	}
+
+	o.copy(p.Text.Extend(o.size()))
+
+	linkCall(p, textOffset, funcAddr)
+
+	if argCount != 0 {
+		asm.DropStackValues(p, argCount)
+	}
+	asm.Return(p, 0)
+}
+
+// LinkInit generates a function which calls functions of other text regions
+// (without arguments), and then jumps to the entry function of this region.
+// The result is zero if there is no entry function.
+func (MacroAssembler) LinkInit(p *gen.Prog, textOffsets, funcAddrs []int32, entryAddr int32) {
+	p.Text.PutUint32(in.PushIntReg(RegLink))
+
+	for i, textOffset := range textOffsets {
+		linkCall(p, textOffset, funcAddrs[i])
+	}
+
+	p.Text.PutUint32(in.PopIntReg(RegLink))
+
+	if entryAddr != 0 {
+		asm.Branch(p, entryAddr)
+	} else {
+		asm.ClearIntResultReg(p)
+		p.Text.PutUint32(in.RET.Rn(RegLink))
+	}
+}
+
+// linkCall switches the text base register during the call.  The code size
+// doesn't depend on the offset or address.
+func linkCall(p *gen.Prog, textOffset, funcAddr int32) {
+	addTextOffset(p, textOffset)
+	p.Text.PutUint32(in.BL.I26(in.Int26((textOffset + funcAddr - p.Text.Addr) / 4)))
+	addTextOffset(p, -textOffset)
+}
+
+func addTextOffset(p *gen.Prog, offset int32) {
+	var o output
+	o.uint32(in.MOVZ.RdI16Hw(RegScratch, uint32(uint16(offset)), 0, wa.I64))
+	o.uint32(in.MOVK.RdI16Hw(RegScratch, uint32(uint16(offset>>16)), 1, wa.I64))
+	o.uint32(in.ADDe.RdRnI3ExtRm(RegTextBase, RegTextBase, 0, in.SXTW, RegScratch, wa.I64))
+	o.copy(p.Text.Extend(o.size()))
+}
+
 func (MacroAssembler) JumpToTrapHandler(p *gen.Prog, id trap.ID) {
 	jumpToTrapHandler(p, id)
 }
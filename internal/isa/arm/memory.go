@@ -38,15 +38,20 @@ func (MacroAssembler) Store(f *gen.Func, props uint16, index, x operand.O, align
 	f.Text.PutUint32(op.OpcodeUnscaled().RtRnI9(value, base, disp9))
 }
 
-// checkAccess returns RegMemoryBase or RegScratch as base.
+// checkAccess returns RegMemoryBase or RegScratch as base.  With bounds checks,
+// the access is invalid if its last byte reaches the maximum memory size (the
+// same rule is used by all architectures, as it affects call site mapping).
 func checkAccess(f *gen.Func, sizeReach uint64, index operand.O, offset uint32) (base reg.R, disp9 uint32) {
 	reachOffset := uint64(offset) + sizeReach
 
-	if reachOffset >= 0x80000000 {
+	if reachOffset >= 0x80000000 || (f.BoundsChecks && reachOffset >= uint64(f.Module.MemoryLimitValues.Maximum)) {
 		f.ValueBecameUnreachable(index)
 		return invalidAccess(f)
 	}
 
+	var r reg.R
+	var checked bool
+
 	if index.Storage == storage.Imm {
 		value := uint64(index.ImmValue())
 
@@ -57,33 +62,36 @@ func checkAccess(f *gen.Func, sizeReach uint64, index operand.O, offset uint32)
 		addr := value + uint64(offset)
 		reachAddr := addr + sizeReach
 
-		if reachAddr >= 0x80000000 {
+		if reachAddr >= 0x80000000 || (f.BoundsChecks && reachAddr >= uint64(f.Module.MemoryLimitValues.Maximum)) {
 			return invalidAccess(f)
 		}
 
-		if reachAddr < uint64(f.Module.MemoryLimitValues.Initial) {
+		if reachAddr < uint64(f.Module.MemoryLimitValues.Initial) && addr <= 255 {
 			// Call site is not mapped, so this optimization is part of
 			// portable ABI.
-			if addr <= 255 {
-				base = RegMemoryBase
-				disp9 = uint32(addr)
-			} else {
-				panic(addr)
-			}
+			base = RegMemoryBase
+			disp9 = uint32(addr)
 			return
 		}
 
-		panic(reachAddr)
+		moveIntImm(&f.Text, RegScratch, int64(value))
+		r = RegScratch
+		checked = true // Within maximum memory size.
 	} else {
-		r, _ := getScratchReg(f, index)
-		f.Text.PutUint32(in.ADDe.RdRnI3ExtRm(RegScratch, RegMemoryBase, 0, in.UXTW, r, wa.I64))
-		f.Regs.Free(wa.I32, r)
-
-		var i uint32
-		for imm := reachOffset; imm != 0; imm >>= 12 {
-			f.Text.PutUint32(in.ADDi.RdRnI12S2(RegScratch, RegScratch, in.Uint12(imm), i, wa.I64))
-			i++
-		}
+		r, _ = getScratchReg(f, index)
+	}
+
+	f.Text.PutUint32(in.ADDe.RdRnI3ExtRm(RegScratch, RegMemoryBase, 0, in.UXTW, r, wa.I64))
+	f.Regs.Free(wa.I32, r)
+
+	var i uint32
+	for imm := reachOffset; imm != 0; imm >>= 12 {
+		f.Text.PutUint32(in.ADDi.RdRnI12S2(RegScratch, RegScratch, in.Uint12(imm), i, wa.I64))
+		i++
+	}
+
+	if f.BoundsChecks && !checked {
+		checkBounds(f)
 	}
 
 	base = RegScratch
@@ -91,6 +99,23 @@ func checkAccess(f *gen.Func, sizeReach uint64, index operand.O, offset uint32)
 	return
 }
 
+// checkBounds traps if the access reaches the maximum memory size.  The
+// address of the access's last byte must be in RegScratch.  The link register is used
+// as a temporary: it has been saved by the function prologue, and calls
+// clobber it anyway.
+func checkBounds(f *gen.Func) {
+	moveIntImm(&f.Text, RegLink, int64(f.Module.MemoryLimitValues.Maximum))
+
+	var o output
+	o.uint32(in.ADDs.RdRnI6RmS2(RegLink, RegLink, 0, RegMemoryBase, 0, wa.I64))
+	o.uint32(in.SUBSs.RdRnI6RmS2(RegDiscard, RegScratch, 0, RegLink, 0, wa.I64))
+	o.uint32(in.Bc.CondI19(in.LO, 2)) // Skip trap instruction if below limit.
+	putTrapInsn(&o, f, trap.MemoryAccessOutOfBounds)
+	o.copy(f.Text.Extend(o.size()))
+
+	f.MapCallAddr(f.Text.Addr)
+}
+
 func invalidAccess(f *gen.Func) (base reg.R, disp9 uint32) {
 	asm.Trap(f, trap.MemoryAccessOutOfBounds)
 
@@ -11,6 +11,7 @@ import (
 	"github.com/tsavola/wag/internal/gen/link"
 	"github.com/tsavola/wag/internal/gen/operand"
 	"github.com/tsavola/wag/internal/gen/reg"
+	"github.com/tsavola/wag/internal/module"
 	"github.com/tsavola/wag/trap"
 	"github.com/tsavola/wag/wa"
 )
@@ -126,6 +127,12 @@ type MacroAssembler interface {
 	// insert nop instructions until text address is 16-byte aligned.
 	InitCallEntry(p *gen.Prog) (retAddr int32)
 
+	// Intrinsic may use RegResult and update condition flags.  It may also
+	// clobber other allocatable registers.  The arguments are on the stack;
+	// the last one is at argOffset.  The result is left in the result
+	// register.  Trap call sites are mapped using stackOffset.
+	Intrinsic(p *gen.Prog, x module.Intrinsic, argOffset, stackOffset int32)
+
 	// JumpToImportFunc may use RegResult and update condition flags.
 	//
 	// Void functions must make sure that they don't return any sensitive
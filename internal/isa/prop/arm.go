@@ -11,6 +11,10 @@ import (
 	"github.com/tsavola/wag/internal/isa/arm/in"
 )
 
+// Intrinsics
+
+const Intrinsics = false // MacroAssembler.Intrinsic is not implemented.
+
 // Unary
 
 const (
@@ -11,6 +11,10 @@ import (
 	"github.com/tsavola/wag/internal/isa/x86/in"
 )
 
+// Intrinsics
+
+const Intrinsics = true // MacroAssembler.Intrinsic is implemented.
+
 // Unary
 
 const (
@@ -0,0 +1,27 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x86
+
+// Optional CPU features which affect code generation.  The values are
+// exported by the compile package.
+const (
+	FeatureLZCNT = 1 << iota
+	FeaturePOPCNT
+	FeatureTZCNT
+)
+
+// Features returns the optional CPU features which generated code may use.
+func Features() (mask uint64) {
+	if haveLZCNT() {
+		mask |= FeatureLZCNT
+	}
+	if havePOPCNT() {
+		mask |= FeaturePOPCNT
+	}
+	if haveTZCNT() {
+		mask |= FeatureTZCNT
+	}
+	return
+}
@@ -127,6 +127,16 @@ func (op NPprefix) Simple(text *code.Buf) {
 	o.copy(text.Extend(o.len()))
 }
 
+// NP with two-byte opcode
+
+type NP2 uint16
+
+func (op NP2) Simple(text *code.Buf) {
+	var o output
+	o.word(uint16(op))
+	o.copy(text.Extend(o.len()))
+}
+
 // O
 
 type O byte
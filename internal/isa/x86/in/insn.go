@@ -18,6 +18,7 @@ const (
 	SUB     = RM(0x2b)
 	XOR     = RM(0x33)
 	CMP     = RM(0x3b)
+	RDTSC   = NP2(0x0f<<8 | 0x31)
 	CMOVB   = RM2(0x0f<<8 | 0x42)
 	CMOVAE  = RM2(0x0f<<8 | 0x43)
 	CMOVE   = RM2(0x0f<<8 | 0x44)
@@ -86,6 +87,8 @@ const (
 	SETLE   = Mex2(0x0f<<8 | 0x9e)
 	SETG    = Mex2(0x0f<<8 | 0x9f)
 	CDQ     = NP(0x99)
+	REPMOVS = NPprefix(0xa4) // REP MOVSB
+	REPSTOS = NPprefix(0xaa) // REP STOSB
 	IMUL    = RM2(0x0f<<8 | 0xaf)
 	MOVZX8  = RM2(0x0f<<8 | 0xb6) // RegReg is untested
 	MOVZX16 = RM2(0x0f<<8 | 0xb7) // RegReg is untested
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package x86
+
+import (
+	"github.com/tsavola/wag/internal/gen"
+	"github.com/tsavola/wag/internal/gen/reg"
+	"github.com/tsavola/wag/internal/isa/x86/in"
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/internal/obj"
+	"github.com/tsavola/wag/trap"
+	"github.com/tsavola/wag/wa"
+)
+
+const (
+	regStringSource = reg.R(6) // rsi
+	regStringDest   = reg.R(7) // rdi
+)
+
+func (MacroAssembler) Intrinsic(p *gen.Prog, x module.Intrinsic, argOffset, stackOffset int32) {
+	switch x {
+	case module.IntrinsicMemcpy:
+		in.MOV.RegStackDisp(&p.Text, wa.I32, regStringDest, argOffset+2*obj.Word)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, regStringSource, argOffset+obj.Word)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, RegCount, argOffset)
+		checkStringBounds(p, regStringDest, stackOffset)
+		checkStringBounds(p, regStringSource, stackOffset)
+		in.ADD.RegReg(&p.Text, wa.I64, regStringDest, RegMemoryBase)
+		in.ADD.RegReg(&p.Text, wa.I64, regStringSource, RegMemoryBase)
+		in.REPMOVS.Simple(&p.Text)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, RegResult, argOffset+2*obj.Word)
+
+	case module.IntrinsicMemset:
+		in.MOV.RegStackDisp(&p.Text, wa.I32, regStringDest, argOffset+2*obj.Word)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, RegCount, argOffset)
+		checkStringBounds(p, regStringDest, stackOffset)
+		in.ADD.RegReg(&p.Text, wa.I64, regStringDest, RegMemoryBase)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, RegResult, argOffset+obj.Word)
+		in.REPSTOS.Simple(&p.Text)
+		in.MOV.RegStackDisp(&p.Text, wa.I32, RegResult, argOffset+2*obj.Word)
+
+	case module.IntrinsicSqrtF32, module.IntrinsicSqrtF64:
+		t := x.Type().Result
+		in.MOVDQ.RegStackDisp(&p.Text, t, RegResult, argOffset)
+		in.SQRTSSD.RegReg(&p.Text, t, RegResult, RegResult)
+
+	case module.IntrinsicCycleCount:
+		in.RDTSC.Simple(&p.Text) // Clobbers RegZero.
+		in.SHLi.RegImm8(&p.Text, wa.I64, RegDividendHigh, 32)
+		in.OR.RegReg(&p.Text, wa.I64, RegResult, RegDividendHigh)
+		in.XOR.RegReg(&p.Text, wa.I32, RegZero, RegZero)
+
+	default:
+		panic(x)
+	}
+}
+
+// checkStringBounds traps if the zero-extended address in r plus the count in
+// RegCount exceeds the maximum memory size.  Accesses between the current and
+// maximum memory size are caught by the runtime like ordinary memory accesses.
+func checkStringBounds(p *gen.Prog, r reg.R, stackOffset int32) {
+	in.MOV.RegReg(&p.Text, wa.I64, RegResult, r)
+	in.ADD.RegReg(&p.Text, wa.I64, RegResult, RegCount)
+	in.CMPi.RegImm32(&p.Text, wa.I64, RegResult, int32(p.Module.MemoryLimitValues.Maximum))
+	in.JBEcb.Rel8(&p.Text, in.CALLcd.Size()) // Skip next instruction if within limit (no trap).
+	in.CALLcd.Addr32(&p.Text, p.TrapLinks[trap.MemoryAccessOutOfBounds].Addr)
+	p.Map.PutCallSite(uint32(p.Text.Addr), stackOffset)
+}
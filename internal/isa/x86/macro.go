@@ -314,6 +314,44 @@ func (MacroAssembler) JumpToImportFunc(p *gen.Prog, vecIndex int, variadic bool,
 	in.JMPcd.Addr32(&p.Text, abi.TextAddrRetpoline)
 }
 
+// LinkCall generates a function which calls a function of another text
+// region.  The arguments are copied, and the text base register is switched
+// for the duration of the call.  textOffset is the other region's position
+// relative to this region.
+func (MacroAssembler) LinkCall(p *gen.Prog, textOffset, funcAddr int32, argCount int) {
+	for i := 0; i < argCount; i++ {
+		in.MOV.RegStackDisp(&p.Text, wa.I64, RegScratch, int32(argCount*obj.Word))
+		in.PUSHo.RegScratch(&p.Text)
+	}
+
+	in.ADDi.RegImm32(&p.Text, wa.I64, RegTextBase, textOffset)
+	in.CALLcd.Addr32(&p.Text, textOffset+funcAddr)
+	in.SUBi.RegImm32(&p.Text, wa.I64, RegTextBase, textOffset)
+
+	if argCount != 0 {
+		asm.DropStackValues(p, argCount)
+	}
+	in.RET.Simple(&p.Text)
+}
+
+// LinkInit generates a function which calls functions of other text regions
+// (without arguments), and then jumps to the entry function of this region.
+// The result is zero if there is no entry function.
+func (MacroAssembler) LinkInit(p *gen.Prog, textOffsets, funcAddrs []int32, entryAddr int32) {
+	for i, textOffset := range textOffsets {
+		in.ADDi.RegImm32(&p.Text, wa.I64, RegTextBase, textOffset)
+		in.CALLcd.Addr32(&p.Text, textOffset+funcAddrs[i])
+		in.SUBi.RegImm32(&p.Text, wa.I64, RegTextBase, textOffset)
+	}
+
+	if entryAddr != 0 {
+		in.JMPcd.Addr32(&p.Text, entryAddr)
+	} else {
+		in.XOR.RegReg(&p.Text, wa.I32, RegResult, RegResult)
+		in.RET.Simple(&p.Text)
+	}
+}
+
 func (MacroAssembler) JumpToTrapHandler(p *gen.Prog, id trap.ID) {
 	jumpToTrapHandler(p, id)
 }
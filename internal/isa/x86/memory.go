@@ -77,8 +77,34 @@ var storeImmInsns = [5]memDispImmInsn{
 	prop.IndexFloatStore: opStoreImm{},
 }
 
+// Access sizes of narrow loads and stores.  Zero means the operand type's
+// size.
+
+var loadSizes = [8]uint8{
+	prop.IndexIntLoad8S:  1,
+	prop.IndexIntLoad8U:  1,
+	prop.IndexIntLoad16S: 2,
+	prop.IndexIntLoad16U: 2,
+	prop.IndexIntLoad32S: 4,
+	prop.IndexIntLoad32U: 4,
+}
+
+var storeSizes = [5]uint8{
+	prop.IndexIntStore8:  1,
+	prop.IndexIntStore16: 2,
+	prop.IndexIntStore32: 4,
+}
+
+// sizeReach is the offset of an access's last byte.
+func sizeReach(size uint8, t wa.Type) uint64 {
+	if size == 0 {
+		size = t.Size()
+	}
+	return uint64(size) - 1
+}
+
 func (MacroAssembler) Load(f *gen.Func, props uint16, index operand.O, resultType wa.Type, align, offset uint32) operand.O {
-	base, disp := checkAccess(f, index, offset)
+	base, disp := checkAccess(f, sizeReach(loadSizes[props], resultType), index, offset)
 
 	r := f.Regs.AllocResult(resultType)
 	loadInsns[props].RegMemDisp(&f.Text, resultType, r, base, disp)
@@ -86,7 +112,7 @@ func (MacroAssembler) Load(f *gen.Func, props uint16, index operand.O, resultTyp
 }
 
 func (MacroAssembler) Store(f *gen.Func, props uint16, index, x operand.O, align, offset uint32) {
-	base, disp := checkAccess(f, index, offset)
+	base, disp := checkAccess(f, sizeReach(storeSizes[props], x.Type), index, offset)
 
 	if x.Storage == storage.Imm {
 		storeImmInsns[props].MemDispImm(&f.Text, x.Type, base, disp, x.ImmValue())
@@ -97,9 +123,13 @@ func (MacroAssembler) Store(f *gen.Func, props uint16, index, x operand.O, align
 	}
 }
 
-// checkAccess returns RegMemoryBase or RegScratch as base.
-func checkAccess(f *gen.Func, index operand.O, offset uint32) (base in.BaseReg, disp int32) {
-	if offset >= 0x80000000 {
+// checkAccess returns RegMemoryBase or RegScratch as base.  With bounds checks,
+// the access is invalid if its last byte reaches the maximum memory size (the
+// same rule is used by all architectures, as it affects call site mapping).
+func checkAccess(f *gen.Func, sizeReach uint64, index operand.O, offset uint32) (base in.BaseReg, disp int32) {
+	reachOffset := uint64(offset) + sizeReach
+
+	if offset >= 0x80000000 || (f.BoundsChecks && reachOffset >= uint64(f.Module.MemoryLimitValues.Maximum)) {
 		f.ValueBecameUnreachable(index)
 		return invalidAccess(f)
 	}
@@ -111,12 +141,18 @@ func checkAccess(f *gen.Func, index operand.O, offset uint32) (base in.BaseReg,
 		if value >= 0x80000000 || addr >= 0x80000000 {
 			return invalidAccess(f)
 		}
+		if f.BoundsChecks && addr+sizeReach >= uint64(f.Module.MemoryLimitValues.Maximum) {
+			return invalidAccess(f)
+		}
 
 		base = in.BaseMemory
 		disp = int32(addr)
 
 	default:
 		asm.Move(f, RegScratch, index) // Unconditional 32-bit mask.
+		if f.BoundsChecks {
+			checkBounds(f, reachOffset)
+		}
 		in.ADD.RegReg(&f.Text, wa.I64, RegScratch, RegMemoryBase)
 
 		base = in.BaseScratch
@@ -126,6 +162,16 @@ func checkAccess(f *gen.Func, index operand.O, offset uint32) (base in.BaseReg,
 	return
 }
 
+// checkBounds traps if index+reachOffset reaches the maximum memory size.  The
+// zero-extended index must be in RegScratch, and reachOffset must be below the
+// maximum memory size.
+func checkBounds(f *gen.Func, reachOffset uint64) {
+	in.CMPi.RegImm32(&f.Text, wa.I64, RegScratch, int32(uint32(uint64(f.Module.MemoryLimitValues.Maximum)-reachOffset)))
+	in.JBcb.Rel8(&f.Text, in.CALLcd.Size()) // Skip next instruction if below limit (no trap).
+	in.CALLcd.Addr32(&f.Text, f.TrapLinks[trap.MemoryAccessOutOfBounds].Addr)
+	f.MapCallAddr(f.Text.Addr)
+}
+
 func invalidAccess(f *gen.Func) (base in.BaseReg, disp int32) {
 	asm.Trap(f, trap.MemoryAccessOutOfBounds)
 
@@ -102,8 +102,57 @@ type Import struct {
 
 type ImportFunc struct {
 	Import
-	VecIndex int
-	Variadic bool
+	VecIndex   int
+	Variadic   bool
+	Native     bool   // Call NativeAddr directly instead of via vector.
+	NativeAbs  bool   // NativeAddr is absolute; call sites are relocated.
+	NativeAddr uint64 // Absolute or text-relative address.
+	Intrinsic  Intrinsic
+}
+
+// Intrinsic is an import function implementation which is generated inline.
+type Intrinsic uint8
+
+const (
+	IntrinsicNone       Intrinsic = iota
+	IntrinsicMemcpy               // (dest i32, src i32, n i32) i32
+	IntrinsicMemset               // (dest i32, c i32, n i32) i32
+	IntrinsicSqrtF32              // (f32) f32
+	IntrinsicSqrtF64              // (f64) f64
+	IntrinsicCycleCount           // () i64
+	NumIntrinsics
+)
+
+var intrinsicNames = [NumIntrinsics]string{
+	IntrinsicNone:       "none",
+	IntrinsicMemcpy:     "memcpy",
+	IntrinsicMemset:     "memset",
+	IntrinsicSqrtF32:    "sqrt.f32",
+	IntrinsicSqrtF64:    "sqrt.f64",
+	IntrinsicCycleCount: "cycle_count",
+}
+
+var intrinsicTypes = [NumIntrinsics]wa.FuncType{
+	IntrinsicMemcpy:     {Params: []wa.Type{wa.I32, wa.I32, wa.I32}, Result: wa.I32},
+	IntrinsicMemset:     {Params: []wa.Type{wa.I32, wa.I32, wa.I32}, Result: wa.I32},
+	IntrinsicSqrtF32:    {Params: []wa.Type{wa.F32}, Result: wa.F32},
+	IntrinsicSqrtF64:    {Params: []wa.Type{wa.F64}, Result: wa.F64},
+	IntrinsicCycleCount: {Result: wa.I64},
+}
+
+func (x Intrinsic) String() string {
+	if x < NumIntrinsics {
+		return intrinsicNames[x]
+	}
+	return fmt.Sprintf("<unknown intrinsic %d>", uint8(x))
+}
+
+// Type is the signature which the import function must have.
+func (x Intrinsic) Type() (sig wa.FuncType) {
+	if x < NumIntrinsics {
+		sig = intrinsicTypes[x]
+	}
+	return
 }
 
 type ResizableLimits struct {
@@ -121,13 +170,21 @@ type M struct {
 	Types             []wa.FuncType
 	Funcs             []uint32
 	ImportFuncs       []ImportFunc
+	ImportTable       Import
+	TableImported     bool
 	TableLimitValues  ResizableLimits
+	ImportMemory      Import
+	MemoryImported    bool
 	MemoryLimitValues ResizableLimits
 	Globals           []Global
 	ImportGlobals     []Import
+	GlobalsBefore     int // Words reserved for other modules' globals.
+	GlobalsAfter      int // Words reserved between globals and memory.
 	EntryIndex        uint32
 	EntryDefined      bool
 	ExportFuncs       map[string]uint32
+	ExportTables      []string
+	ExportMemories    []string
 	StartIndex        uint32
 	StartDefined      bool
 	TableFuncs        []uint32
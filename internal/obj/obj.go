@@ -4,6 +4,10 @@
 
 package obj
 
+import (
+	"github.com/tsavola/wag/trap"
+)
+
 const (
 	Word = 8 // stack entry size
 )
@@ -13,6 +17,8 @@ const (
 type ObjectMapper interface {
 	InitObjectMap(numImportFuncs, numOtherFuncs int)
 	PutImportFuncAddr(addr uint32)
+	PutImportReloc(addr uint32, importIndex int, target uint64)
+	PutTrapAddr(id trap.ID, addr uint32)
 	PutFuncAddr(addr uint32)
 	PutCallSite(returnAddr uint32, stackOffset int32)
 	PutInsnAddr(addr uint32)
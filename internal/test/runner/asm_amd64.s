@@ -84,3 +84,14 @@ TEXT ·importSuspendNextCall(SB),$0-8
 	LEAQ	suspend_next_call(SB), AX
 	MOVQ	AX, ret+0(FP)
 	RET
+
+// func importLazyTrap() uint64
+TEXT ·importLazyTrap(SB),$0-8
+	LEAQ	lazyTrap<>(SB), AX
+	MOVQ	AX, ret+0(FP)
+	RET
+
+TEXT lazyTrap<>(SB),NOSPLIT,$0
+	MOVQ	(SP), AX		// return address
+	MOVQ	AX, -96(R15)		// vectorIndexLazyRetAddr
+	JMP	R15			// NoFunction trap routine
@@ -72,3 +72,13 @@ TEXT ·importSnapshot(SB),$0-8
 // func importSuspendNextCall() uint64
 TEXT ·importSuspendNextCall(SB),$0-8
 	B	import_suspend_next_call(SB)
+
+// func importLazyTrap() uint64
+TEXT ·importLazyTrap(SB),$0-8
+	MOVD	$lazyTrap<>(SB), R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+TEXT lazyTrap<>(SB),NOSPLIT|NOFRAME,$0
+	MOVD	R30, -96(R27)		// vectorIndexLazyRetAddr
+	B	(R27)			// NoFunction trap routine
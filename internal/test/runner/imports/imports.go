@@ -19,7 +19,7 @@ type Func struct {
 
 func (impl Func) Implements(signature wa.FuncType) bool {
 	if impl.Variadic {
-		return equalTypesVariadic(impl.FuncType, signature)
+		return impl.FuncType.EqualVariadic(signature)
 	} else {
 		return equalTypes(impl.FuncType, signature)
 	}
@@ -58,16 +58,6 @@ func equalTypes(sig1, sig2 wa.FuncType) bool {
 	return compareTypes(sig1, sig2) == 0
 }
 
-func equalTypesVariadic(partial, complete wa.FuncType) bool {
-	minLen := len(partial.Params)
-
-	if len(complete.Params) < minLen {
-		return false
-	}
-
-	return compareTypePrefixes(partial, complete, minLen) == 0
-}
-
 func compareTypePrefixes(sig1, sig2 wa.FuncType, numParams int) int {
 	for i := 0; i < numParams; i++ {
 		arg1 := sig1.Params[i]
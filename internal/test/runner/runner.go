@@ -27,6 +27,7 @@ import (
 const linearMemoryAddressSpace = 6 * 1024 * 1024 * 1024
 
 const (
+	vectorIndexLazyRetAddr     = -12
 	vectorIndexLastImportFunc  = -5
 	vectorIndexGrowMemoryLimit = -4
 	vectorIndexCurrentMemory   = -3
@@ -42,6 +43,7 @@ func importGrowMemory() uint64
 func importGetArg() uint64
 func importSnapshot() uint64
 func importSuspendNextCall() uint64
+func importLazyTrap() uint64
 func importSpectestPrint() uint64
 func importPutns() uint64
 func importBenchmarkBegin() uint64
@@ -106,6 +108,20 @@ var importFuncs = map[string]map[string]imports.Func{
 	},
 }
 
+// ImportFuncAddr looks up a host function implemented by the runtime.
+func ImportFuncAddr(module, field string) (addr uint64, found bool) {
+	f, found := importFuncs[module][field]
+	addr = f.Addr
+	return
+}
+
+// LazyTrapAddr is the address of a routine which may be used to initialize
+// lazily bound import vector slots.  It raises the NoFunction trap after
+// recording the return address for Runner.NoFunction.
+func LazyTrapAddr() uint64 {
+	return importLazyTrap()
+}
+
 func populateImportVector(b []byte) {
 	// vectorIndexGrowMemoryLimit is initialized later.
 	binary.LittleEndian.PutUint64(b[len(b)+vectorIndexCurrentMemory*8:], importCurrentMemory())
@@ -165,6 +181,7 @@ type runnable interface {
 	getResume() int
 	writeStacktraceTo(w io.Writer, funcs []wa.FuncType, ns *section.NameSection, stack []byte) error
 	exportStack(native []byte) (portable []byte, err error)
+	importStack(portable []byte) (native []byte, err error)
 }
 
 type Program struct {
@@ -209,6 +226,12 @@ func (p *Program) TextAddr() uintptr {
 	return (*reflect.SliceHeader)(unsafe.Pointer(&p.Text)).Data
 }
 
+// ImportVector is addressed from the end.  It may be modified during
+// execution.
+func (p *Program) ImportVector() []byte {
+	return p.vec
+}
+
 func (p *Program) SetData(data []byte, memoryOffset int) {
 	p.data = data
 	p.memoryOffset = memoryOffset
@@ -278,6 +301,13 @@ func (*Program) getResume() int {
 
 type Runner struct {
 	prog runnable
+	vec  []byte
+
+	// NoFunction is invoked when the program calls an import function the
+	// vector slot of which was initialized with LazyTrapAddr.  The call is
+	// retried after it returns.  If it's nil, the NoFunction trap waits for
+	// code generation to complete.
+	NoFunction func(retAddr uint64) error
 
 	resolveEntry func()
 
@@ -301,6 +331,7 @@ func (p *Program) NewRunner(initMemorySize, growMemorySize, stackSize int) (r *R
 	}
 
 	r.resolveEntry = p.resolveEntry
+	r.vec = p.vec
 	return
 }
 
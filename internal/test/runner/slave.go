@@ -35,7 +35,15 @@ func (e *Executor) slave(fd int, sigs []wa.FuncType, printer io.Writer, cont <-c
 			e.runner.snapshot(f, printer)
 
 		case command == -2:
-			<-cont
+			if e.runner.NoFunction != nil {
+				vec := e.runner.vec
+				retAddr := binary.LittleEndian.Uint64(vec[len(vec)+vectorIndexLazyRetAddr*8:])
+				if err := e.runner.NoFunction(retAddr); err != nil {
+					panic(err)
+				}
+			} else {
+				<-cont
+			}
 			if _, err := f.Write([]byte{0}); err != nil {
 				panic(err)
 			}
@@ -83,9 +83,10 @@ func (r *Runner) snapshot(f io.ReadWriter, printer io.Writer) {
 		panic(err)
 	}
 
-	// TODO: importStack()
-	nativeStack := make([]byte, len(liveStack))
-	copy(nativeStack, liveStack)
+	nativeStack, err := r.prog.importStack(portableStack)
+	if err != nil {
+		panic(err)
+	}
 
 	s := &Snapshot{
 		prog:          r.prog,
@@ -139,6 +140,10 @@ func (s *Snapshot) exportStack(native []byte) (portable []byte, err error) {
 	return s.prog.exportStack(native)
 }
 
+func (s *Snapshot) importStack(portable []byte) (native []byte, err error) {
+	return s.prog.importStack(portable)
+}
+
 func (s *Snapshot) NewRunner(growMemorySize, stackSize int) (r *Runner, err error) {
 	memorySize := len(s.data) - s.memoryOffset
 	return newRunner(s, memorySize, growMemorySize, stackSize)
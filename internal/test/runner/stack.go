@@ -12,6 +12,7 @@ import (
 	"sort"
 	"unsafe"
 
+	"github.com/tsavola/wag/object/stack"
 	"github.com/tsavola/wag/section"
 	"github.com/tsavola/wag/wa"
 )
@@ -67,72 +68,13 @@ func (p *Program) CallSites() map[int]callSite {
 }
 
 func (p *Program) exportStack(native []byte) (portable []byte, err error) {
-	portable = make([]byte, len(native))
-	copy(portable, native)
-
 	textAddr := uint64((*reflect.SliceHeader)(unsafe.Pointer(&p.Text)).Data)
-	callSites := p.CallSites()
-
-	buf := portable
-
-	//depth := 0
-	//Q("tracing stack (begin):", depth)
-
-	for len(buf) > 0 {
-		absoluteRetAddr := byteOrder.Uint64(buf[:8])
-
-		//Q("tracing stack:", depth, absoluteRetAddr)
-
-		retAddr := absoluteRetAddr - textAddr
-		if retAddr > 0x7ffffffe {
-			err = errors.New("absolute return address is not in text section")
-			return
-		}
-
-		//Q("tracing stack:", depth, retAddr)
-
-		site, found := callSites[int(retAddr)]
-		if !found {
-			err = errors.New("unknown return address")
-			return
-		}
-
-		_, initial, ok := p.findCaller(int32(retAddr))
-		if !ok {
-			err = errors.New("function not found for return address")
-			return
-		}
-
-		//Q("tracing stack:", depth, initial)
-		//Q("tracing stack:", depth, site.index)
-		//Q("tracing stack:", depth, site.stackOffset)
-
-		if initial {
-			if site.stackOffset != 0 && (site.stackOffset < 8 || (site.stackOffset&7) != 0) {
-				err = errors.New("invalid stack offset")
-				return
-			}
-		} else {
-			if site.stackOffset < 8 || (site.stackOffset&7) != 0 {
-				err = errors.New("invalid stack offset")
-				return
-			}
-		}
-
-		byteOrder.PutUint64(buf[:8], site.index) // native address -> portable index
-
-		if initial {
-			return
-		}
-
-		buf = buf[site.stackOffset:]
-
-		//Q("tracing stack (continuing to next level):", depth)
-		//depth++
-	}
+	return stack.Export(native, textAddr, &p.DebugMap.CallMap)
+}
 
-	err = errors.New("ran out of stack before reaching initial function call")
-	return
+func (p *Program) importStack(portable []byte) (native []byte, err error) {
+	textAddr := uint64((*reflect.SliceHeader)(unsafe.Pointer(&p.Text)).Data)
+	return stack.Import(portable, textAddr, &p.DebugMap.CallMap)
 }
 
 func (p *Program) writeStacktraceTo(w io.Writer, funcs []wa.FuncType, ns *section.NameSection, stack []byte) (err error) {
@@ -0,0 +1,93 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64,!wagarm64
+
+package wag
+
+import (
+	"encoding/binary"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/buffer"
+	"github.com/tsavola/wag/internal/test/runner"
+	"github.com/tsavola/wag/trap"
+	"github.com/tsavola/wag/wa"
+)
+
+// Imports env.memcpy, env.memset and env.sqrt; has one page of memory.  main
+// returns the sum of memcpy's result, an i32 loaded from the copied region and
+// sqrt(144).  oob calls memset beyond the end of memory.
+const testIntrinsicModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x11\x03\x60\x03\x7f\x7f\x7f\x01\x7f\x60\x01\x7c\x01\x7c\x60\x00\x01\x7f\x02\x26\x03\x03\x65\x6e\x76\x06\x6d\x65\x6d\x63\x70\x79\x00\x00\x03\x65\x6e\x76\x06\x6d\x65\x6d\x73\x65\x74\x00\x00\x03\x65\x6e\x76\x04\x73\x71\x72\x74\x00\x01\x03\x03\x02\x02\x02\x05\x04\x01\x01\x01\x01\x07\x0e\x02\x04\x6d\x61\x69\x6e\x00\x03\x03\x6f\x6f\x62\x00\x04\x0a\x35\x02\x26\x00\x41\x20\x41\x07\x41\x04\x10\x01\x1a\x41\x22\x41\x10\x41\x02\x10\x00\x41\x20\x28\x02\x00\x6a\x44\x00\x00\x00\x00\x00\x00\x62\x40\x10\x02\xaa\x6a\x0b\x0c\x00\x41\xfe\xff\x03\x41\x00\x41\x04\x10\x01\x0b\x0b\x0a\x01\x00\x41\x10\x0b\x04\x01\x02\x03\x04"
+
+type intrinsicResolver struct {
+	binding.ImportResolver
+	binding.Intrinsics
+}
+
+func runIntrinsicTest(t *testing.T, entry string) (result int32, err error) {
+	t.Helper()
+
+	p, err := runner.NewProgram(65536, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	config := Config{
+		Text:            buffer.NewStatic(p.Text[:0], len(p.Text)),
+		MemoryAlignment: os.Getpagesize(),
+		Entry:           entry,
+	}
+
+	reso := intrinsicResolver{runner.Resolver, binding.LibcIntrinsics()}
+
+	obj, err := Compile(&config, strings.NewReader(testIntrinsicModule), reso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetEntryAddr(uint32(binary.LittleEndian.Uint64(obj.StackFrame)))
+	p.Seal()
+	p.SetData(obj.GlobalsMemory, obj.MemoryOffset)
+
+	r, err := p.NewRunner(obj.InitialMemorySize, obj.MemorySizeLimit, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	return r.Run(0, nil, nil)
+}
+
+func TestIntrinsics(t *testing.T) {
+	result, err := runIntrinsicTest(t, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := int32(34 + 0x02010707 + 12); result != expect {
+		t.Errorf("result: 0x%x (expected 0x%x)", result, expect)
+	}
+}
+
+func TestIntrinsicOutOfBounds(t *testing.T) {
+	_, err := runIntrinsicTest(t, "oob")
+	if err != trap.MemoryAccessOutOfBounds {
+		t.Error(err)
+	}
+}
+
+func TestIntrinsicSignatureMismatch(t *testing.T) {
+	_, _, err := binding.LibcIntrinsics().ResolveIntrinsicFunc("env", "sqrt", wa.FuncType{Params: []wa.Type{wa.F32}, Result: wa.F32})
+	if err == nil {
+		t.Error("signature mismatch was not detected")
+	}
+}
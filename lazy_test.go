@@ -0,0 +1,111 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build amd64,!wagarm64
+
+package wag
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/buffer"
+	"github.com/tsavola/wag/internal/test/runner"
+)
+
+// Imports wag.get_arg() i64.  main calls it twice and returns the second
+// result wrapped to i32.
+const testLazyModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x09\x02\x60\x00\x01\x7e\x60\x00\x01\x7f\x02\x0f\x01\x03\x77\x61\x67\x07\x67\x65\x74\x5f\x61\x72\x67\x00\x00\x03\x02\x01\x01\x07\x08\x01\x04\x6d\x61\x69\x6e\x00\x01\x0a\x0a\x01\x08\x00\x10\x00\x1a\x10\x00\xa7\x0b"
+
+type testLazyBinder struct {
+	bound []binding.LazyFunc
+}
+
+func (b *testLazyBinder) BindLazyFunc(f binding.LazyFunc) (addr uint64, err error) {
+	b.bound = append(b.bound, f)
+
+	addr, found := runner.ImportFuncAddr(f.Module, f.Field)
+	if !found {
+		err = fmt.Errorf("%s.%s not found", f.Module, f.Field)
+	}
+	return
+}
+
+func TestLazyBinding(t *testing.T) {
+	p, err := runner.NewProgram(65536, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	config := Config{
+		Text:            buffer.NewStatic(p.Text[:0], len(p.Text)),
+		MemoryAlignment: os.Getpagesize(),
+		Entry:           "main",
+	}
+
+	// Below the runner's own import functions.
+	lazy := &binding.Lazy{NextVectorIndex: -16}
+
+	obj, err := Compile(&config, strings.NewReader(testLazyModule), lazy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lazy.Funcs) != 1 || len(lazy.ImportVectorIndexes) != 1 || lazy.ImportVectorIndexes[0] != -16 {
+		t.Fatal(lazy.Funcs, lazy.ImportVectorIndexes)
+	}
+
+	lazy.InitVector(p.ImportVector(), runner.LazyTrapAddr())
+
+	p.SetEntryAddr(uint32(binary.LittleEndian.Uint64(obj.StackFrame)))
+	p.Seal()
+	p.SetData(obj.GlobalsMemory, obj.MemoryOffset)
+
+	r, err := p.NewRunner(obj.InitialMemorySize, obj.MemorySizeLimit, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	binder := new(testLazyBinder)
+	textAddr := uint64(p.TextAddr())
+
+	r.NoFunction = func(retAddr uint64) error {
+		callAddr, err := lazy.BindTrap(binder, &obj.FuncMap, p.Text, p.ImportVector(), uint32(retAddr-textAddr))
+		if err == nil && callAddr != uint32(retAddr-textAddr)-5 {
+			err = fmt.Errorf("call address: 0x%x", callAddr)
+		}
+		return err
+	}
+
+	// The slave goroutine handles NoFunction while the program is running.
+	if runtime.GOMAXPROCS(0) < 2 {
+		defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	const testArg = 0x1234567
+
+	result, err := r.Run(testArg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != testArg {
+		t.Errorf("result: 0x%x", result)
+	}
+	if len(binder.bound) != 1 || binder.bound[0].Field != "get_arg" {
+		t.Error(binder.bound)
+	}
+
+	if _, err := lazy.BindTrap(binder, &obj.FuncMap, p.Text, p.ImportVector(), obj.FuncAddrs[1]); err == nil {
+		t.Error("function entry was accepted as return address")
+	}
+}
@@ -0,0 +1,637 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package link compiles multiple WebAssembly modules into a single program.
+//
+// Each module is compiled into its own text region.  A function import which
+// refers to another module's export is bound to a generated function which
+// switches the text base register and calls the other region directly.  The
+// modules share linear memory and the table if they are exported and imported
+// between the modules.  Every module has its own globals.
+//
+// The first region is at the start of the text; it contains the usual init
+// routines.  Start functions are called in module order.  The import vector
+// must be copied also in front of the other regions (see PutImportVector).
+//
+// Call stacks which span multiple regions cannot be exported (see the
+// object/stack package), and the generated functions don't appear in the call
+// maps.  Import functions must preserve the text base register, as the same
+// import vector may be used from any region.
+package link
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/buffer"
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/internal/code"
+	"github.com/tsavola/wag/internal/gen/codegen"
+	"github.com/tsavola/wag/internal/gen/rodata"
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/object/stack"
+	"github.com/tsavola/wag/section"
+	"github.com/tsavola/wag/wa"
+)
+
+const regionAlignment = 16
+
+// Module to be linked.  Name is the import module name which refers to its
+// exports.
+type Module struct {
+	Name   string
+	Reader compile.Reader
+}
+
+// Config for a single linker invocation.  Zero values are replaced with
+// effective defaults during linking.
+type Config struct {
+	VectorSize      int             // Import vector size in bytes.
+	MemoryAlignment int             // Defaults to minimal valid alignment.
+	Entry           string          // Export of the last module; none by default.
+	EntryPolicy     wag.EntryPolicy // Defaults to binding.GetMainFunc.
+	EntryArgs       []uint64        // Must match entry function's parameters.
+	BoundsChecks    bool            // See compile.CodeConfig.
+}
+
+// Region of text which contains a module's code.
+type Region struct {
+	Name           string
+	TextAddr       int // Position of the region in Program.Text.
+	TextSize       int
+	FuncTypes      []wa.FuncType
+	object.CallMap // Addresses are relative to TextAddr.
+	Names          section.NameSection
+}
+
+// Program consisting of linked modules.
+type Program struct {
+	Regions           []Region
+	InitialMemorySize int    // Current memory allocation.
+	MemorySizeLimit   int    // Maximum valid value if not limited.
+	VectorSize        int    // Space reserved for import vector copies.
+	Text              []byte // Text regions separated by import vector space.
+	MemoryOffset      int    // Threshold between globals and memory.
+	GlobalsMemory     []byte // Globals of all modules and shared memory contents.
+	StackFrame        []byte // Entry function address and arguments.
+}
+
+// PutImportVector copies the import vector in front of the text regions
+// (except the first one).  The vector must not be larger than VectorSize.
+func (p *Program) PutImportVector(vector []byte) {
+	if len(vector) > p.VectorSize {
+		panic("import vector is larger than the reserved space")
+	}
+
+	for _, r := range p.Regions[1:] {
+		copy(p.Text[r.TextAddr-len(vector):r.TextAddr], vector)
+	}
+}
+
+type linkedModule struct {
+	Module
+	mod     compile.Module
+	config  compile.Config
+	region  *Region
+	text    code.Buf
+	globals int
+}
+
+// linkFunc is generated in a region; it calls a function of another region.
+type linkFunc struct {
+	region    int
+	addr      int32
+	target    int
+	funcIndex uint32
+	argCount  int
+}
+
+// Link WebAssembly binary modules into a program.  The modules may import
+// functions from each other, and from the import resolver.  The program is
+// constructed incrementally so that populated fields may be inspected on
+// error.
+func Link(config *Config, modules []Module, imports binding.ImportResolver) (prog *Program, err error) {
+	if config == nil {
+		config = new(Config)
+	}
+	if config.MemoryAlignment == 0 {
+		config.MemoryAlignment = 16 // Minimal valid alignment.
+	}
+
+	prog = &Program{
+		Regions:    make([]Region, len(modules)),
+		VectorSize: config.VectorSize,
+	}
+
+	var (
+		linked = make([]*linkedModule, len(modules))
+		byName = make(map[string]int)
+	)
+
+	for i, m := range modules {
+		if _, dupe := byName[m.Name]; dupe {
+			err = module.Errorf("duplicate module name: %q", m.Name)
+			return
+		}
+		byName[m.Name] = i
+
+		l := &linkedModule{
+			Module: m,
+			region: &prog.Regions[i],
+		}
+		l.region.Name = m.Name
+		l.config.CustomSectionLoader = section.CustomLoaders{
+			section.CustomName: l.region.Names.Load,
+		}.Load
+
+		l.mod, err = compile.LoadInitialSections(&compile.ModuleConfig{
+			Config:               l.config,
+			ImportTableAndMemory: true,
+		}, m.Reader)
+		l.region.FuncTypes = l.mod.FuncTypes()
+		if err != nil {
+			return
+		}
+
+		l.globals = len(l.mod.GlobalTypes())
+		linked[i] = l
+	}
+
+	// Shared memory and table.
+
+	memory, err := linkMemory(linked, byName)
+	if err != nil {
+		return
+	}
+	if memory != nil {
+		prog.InitialMemorySize = memory.mod.InitialMemorySize()
+		prog.MemorySizeLimit = memory.mod.MemorySizeLimit()
+	}
+
+	tableShared, tableElems, err := linkTable(linked, byName)
+	if err != nil {
+		return
+	}
+
+	// Bind function imports to other modules or to the import vector.
+
+	var funcs []linkFunc
+	var importLinks = make([][]int, len(linked)) // Import index -> funcs index.
+
+	variadic, _ := imports.(binding.VariadicImportResolver)
+
+	for i, l := range linked {
+		importLinks[i] = make([]int, l.mod.NumImportFuncs())
+
+		for j := range importLinks[i] {
+			moduleName, field, sig := l.mod.ImportFunc(j)
+
+			if target, found := byName[moduleName]; found {
+				funcIndex, exportSig, found := linked[target].mod.ExportFunc(field)
+				if !found {
+					err = module.Errorf("%s imports %s.%s which is not exported", l.Name, moduleName, field)
+					return
+				}
+				if !exportSig.Equal(sig) {
+					err = module.Errorf("%s imports %s.%s with wrong signature: %s (should be %s)", l.Name, moduleName, field, sig, exportSig)
+					return
+				}
+
+				importLinks[i][j] = len(funcs)
+				funcs = append(funcs, linkFunc{
+					region:    i,
+					target:    target,
+					funcIndex: funcIndex,
+					argCount:  len(sig.Params),
+				})
+
+				l.mod.SetImportFunc(j, binding.VectorIndexTrapHandler) // Trampoline will be replaced.
+			} else {
+				var (
+					index      int
+					isVariadic bool
+				)
+
+				if variadic != nil {
+					isVariadic, index, err = variadic.ResolveVariadicFunc(moduleName, field, sig)
+				} else {
+					index, err = imports.ResolveFunc(moduleName, field, sig)
+				}
+				if err != nil {
+					return
+				}
+
+				importLinks[i][j] = -1
+				if isVariadic {
+					l.mod.SetImportFuncVariadic(j, index)
+				} else {
+					l.mod.SetImportFunc(j, index)
+				}
+			}
+		}
+
+		for j := 0; j < l.mod.NumImportGlobals(); j++ {
+			moduleName, field, t := l.mod.ImportGlobal(j)
+
+			if _, found := byName[moduleName]; found {
+				err = module.Errorf("%s imports global %s.%s from a linked module", l.Name, moduleName, field)
+				return
+			}
+
+			var init uint64
+
+			init, err = imports.ResolveGlobal(moduleName, field, t)
+			if err != nil {
+				return
+			}
+
+			l.mod.SetImportGlobal(j, init)
+		}
+	}
+
+	// Every module has its own globals; the first module's are closest to
+	// memory.
+
+	var globalsTotal int
+	for _, l := range linked {
+		globalsTotal += l.globals
+	}
+
+	var globalsAfter int
+	for _, l := range linked {
+		l.mod.ReserveGlobals(globalsTotal-globalsAfter-l.globals, globalsAfter)
+		globalsAfter += l.globals
+	}
+
+	// Generate code and initial memory contents.  The globals and the memory
+	// are shared, so the modules write to the same data buffer.
+
+	var data []byte
+
+	prog.MemoryOffset = alignSize(linked[0].mod.GlobalsSize(), config.MemoryAlignment)
+
+	for _, l := range linked {
+		var codeConfig = &compile.CodeConfig{
+			Mapper:       &l.region.CallMap,
+			BoundsChecks: config.BoundsChecks,
+			Config:       l.config,
+		}
+
+		err = compile.LoadCodeSection(codeConfig, l.Reader, l.mod)
+		if err != nil {
+			return
+		}
+
+		l.text = code.Buf{
+			Buffer: codeConfig.Text,
+			Addr:   int32(len(codeConfig.Text.Bytes())),
+		}
+
+		var dataConfig = &compile.DataConfig{
+			GlobalsMemory: &sharedData{
+				buf: &data,
+				max: prog.MemoryOffset + prog.InitialMemorySize,
+			},
+			MemoryAlignment: config.MemoryAlignment,
+			Config:          l.config,
+		}
+
+		err = compile.LoadDataSection(dataConfig, l.Reader, l.mod)
+		if err != nil {
+			return
+		}
+
+		err = compile.LoadCustomSections(&l.config, l.Reader)
+		if err != nil {
+			return
+		}
+	}
+
+	prog.GlobalsMemory = data
+
+	// Generate the link functions.  They are regenerated when the region
+	// offsets are known.
+
+	for i := range funcs {
+		f := &funcs[i]
+		f.addr = codegen.GenLinkCall(&linked[f.region].text, 0, 0, f.argCount)
+	}
+
+	for i, l := range linked {
+		for j, k := range importLinks[i] {
+			if k >= 0 {
+				trampoline := l.region.FuncAddrs[j]
+				codegen.GenBranch(staticBuf(l.text.Bytes(), int32(trampoline)), funcs[k].addr)
+			}
+		}
+	}
+
+	// Table elements which refer to other modules' functions are replaced.
+
+	for i, l := range linked {
+		if !tableShared[i] {
+			continue
+		}
+
+		for j, elem := range tableElems {
+			if elem.module < 0 || elem.module == i {
+				continue
+			}
+
+			sig := linked[elem.module].region.FuncTypes[elem.funcIndex]
+
+			var sigIndex = uint32(math.MaxInt32) // No matching signature.
+			for k, t := range l.mod.Types() {
+				if t.Equal(sig) {
+					sigIndex = uint32(k)
+					break
+				}
+			}
+
+			f := linkFunc{
+				region:    i,
+				target:    elem.module,
+				funcIndex: elem.funcIndex,
+				argCount:  len(sig.Params),
+			}
+			f.addr = codegen.GenLinkCall(&l.text, 0, 0, f.argCount)
+			funcs = append(funcs, f)
+
+			offset := rodata.TableAddr + j*8
+			binary.LittleEndian.PutUint64(l.text.Bytes()[offset:], (uint64(sigIndex)<<32)|uint64(f.addr))
+		}
+	}
+
+	// The init function of the first region calls the start functions of
+	// the other regions and the entry function.
+
+	var (
+		entryIndex  uint32
+		entryType   wa.FuncType
+		entryModule = len(linked) - 1
+		entryAddr   int32
+		initAddr    int32
+		startRegion []int
+		startIndex  []uint32
+	)
+
+	if config.Entry != "" {
+		if config.EntryPolicy == nil {
+			config.EntryPolicy = binding.GetMainFunc
+		}
+
+		entryIndex, entryType, err = config.EntryPolicy(&linked[entryModule].mod, config.Entry)
+		if err != nil {
+			return
+		}
+
+		// The policy may be lenient, but the argument count must still match.
+		if len(config.EntryArgs) != len(entryType.Params) {
+			err = &binding.EntryError{
+				Names: []string{config.Entry},
+				Found: true,
+				Sig:   entryType,
+				Args:  append([]uint64{}, config.EntryArgs...),
+			}
+			return
+		}
+
+		if entryModule == 0 {
+			entryAddr = int32(linked[0].region.FuncAddrs[entryIndex])
+		} else {
+			f := linkFunc{
+				target:    entryModule,
+				funcIndex: entryIndex,
+				argCount:  len(entryType.Params),
+			}
+			f.addr = codegen.GenLinkCall(&linked[0].text, 0, 0, f.argCount)
+			funcs = append(funcs, f)
+			entryAddr = f.addr
+		}
+	}
+
+	for i, l := range linked[1:] {
+		if index, defined := l.mod.StartFunc(); defined {
+			startRegion = append(startRegion, i+1)
+			startIndex = append(startIndex, index)
+		}
+	}
+
+	if len(startRegion) > 0 {
+		initAddr = codegen.GenLinkInit(&linked[0].text, make([]int32, len(startRegion)), make([]int32, len(startRegion)), entryAddr)
+	}
+
+	// Lay out the regions.
+
+	var textSize int32
+
+	for i, l := range linked {
+		if i > 0 {
+			textSize = alignAddr(textSize+int32(config.VectorSize), regionAlignment)
+		}
+
+		l.region.TextAddr = int(textSize)
+		l.region.TextSize = len(l.text.Bytes())
+		textSize += int32(l.region.TextSize)
+	}
+
+	text := code.Buf{Buffer: buffer.NewStatic(make([]byte, 0, textSize), int(textSize))}
+
+	for _, l := range linked {
+		codegen.PadText(&text, int32(l.region.TextAddr))
+		copy(text.Extend(l.region.TextSize), l.text.Bytes())
+	}
+
+	prog.Text = text.Bytes()
+
+	for _, f := range funcs {
+		var (
+			region = linked[f.region].region
+			target = linked[f.target].region
+			offset = int32(target.TextAddr - region.TextAddr)
+		)
+
+		codegen.GenLinkCall(regionBuf(prog.Text, region, f.addr), offset, int32(target.FuncAddrs[f.funcIndex]), f.argCount)
+	}
+
+	if initAddr != 0 {
+		var (
+			offsets = make([]int32, len(startRegion))
+			addrs   = make([]int32, len(startRegion))
+		)
+
+		for i, k := range startRegion {
+			offsets[i] = int32(linked[k].region.TextAddr)
+			addrs[i] = int32(linked[k].region.FuncAddrs[startIndex[i]])
+		}
+
+		codegen.GenLinkInit(regionBuf(prog.Text, &prog.Regions[0], initAddr), offsets, addrs, entryAddr)
+		entryAddr = initAddr
+	}
+
+	// Form a stack frame for the init routine.
+
+	var entryArgs []uint64
+
+	if config.Entry != "" {
+		entryArgs = config.EntryArgs
+	}
+
+	prog.StackFrame = stack.EntryFrame(uint32(entryAddr), entryArgs)
+	return
+}
+
+// linkMemory checks that the modules don't have multiple memories.  The module
+// which defines the memory (or imports it from the runtime) is returned.
+func linkMemory(linked []*linkedModule, byName map[string]int) (provider *linkedModule, err error) {
+	for _, l := range linked {
+		moduleName, field, imported := l.mod.ImportMemory()
+		if imported {
+			if target, found := byName[moduleName]; found {
+				if !linked[target].mod.ExportMemory(field) {
+					err = module.Errorf("%s imports memory %s.%s which is not exported", l.Name, moduleName, field)
+					return
+				}
+				continue
+			}
+		} else if l.mod.MemorySizeLimit() == 0 {
+			continue // No memory.
+		}
+
+		if provider != nil {
+			err = module.Errorf("%s and %s have separate memories", provider.Name, l.Name)
+			return
+		}
+		provider = l
+	}
+
+	for _, l := range linked {
+		if l != provider && l.mod.InitialMemorySize() > 0 {
+			if provider == nil || l.mod.InitialMemorySize() > provider.mod.InitialMemorySize() {
+				err = module.Errorf("%s imports memory which is smaller than its initial size", l.Name)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+type tableElem struct {
+	module    int // Negative if not initialized.
+	funcIndex uint32
+}
+
+// linkTable finds the modules which share a table.  The shared table's
+// elements are initialized by the modules in order; later modules may
+// override earlier modules' elements.  The modules' tables are resized to
+// match.
+func linkTable(linked []*linkedModule, byName map[string]int) (shared []bool, elems []tableElem, err error) {
+	var owner = -1
+
+	shared = make([]bool, len(linked))
+
+	for i, l := range linked {
+		moduleName, field, imported := l.mod.ImportTable()
+		if !imported {
+			continue
+		}
+
+		target, found := byName[moduleName]
+		if !found {
+			continue
+		}
+
+		if !linked[target].mod.ExportTable(field) {
+			err = module.Errorf("%s imports table %s.%s which is not exported", l.Name, moduleName, field)
+			return
+		}
+		if _, _, imported := linked[target].mod.ImportTable(); imported {
+			err = module.Errorf("%s imports table %s.%s which is imported by %s", l.Name, moduleName, field, moduleName)
+			return
+		}
+		if owner >= 0 && owner != target {
+			err = module.Errorf("%s imports table from %s, but another table is shared by %s", l.Name, moduleName, linked[owner].Name)
+			return
+		}
+
+		owner = target
+		shared[i] = true
+	}
+
+	if owner < 0 {
+		return
+	}
+	shared[owner] = true
+
+	for i, l := range linked {
+		if !shared[i] {
+			continue
+		}
+
+		for j, funcIndex := range l.mod.TableFuncs() {
+			for len(elems) <= j {
+				elems = append(elems, tableElem{module: -1})
+			}
+			if funcIndex < uint32(len(l.region.FuncTypes)) {
+				elems[j] = tableElem{i, funcIndex}
+			}
+		}
+	}
+
+	for i, l := range linked {
+		if shared[i] {
+			l.mod.ResizeTable(len(elems))
+		}
+	}
+
+	return
+}
+
+// sharedData is a view of a data buffer which is shared by the modules.  It
+// doesn't discard contents when it's resized.
+type sharedData struct {
+	buf *[]byte
+	len int
+	max int
+}
+
+func (d *sharedData) Bytes() []byte {
+	return (*d.buf)[:d.len]
+}
+
+func (d *sharedData) ResizeBytes(n int) []byte {
+	if n > d.max {
+		panic(buffer.ErrSizeLimit)
+	}
+	if n > len(*d.buf) {
+		*d.buf = append(*d.buf, make([]byte, n-len(*d.buf))...)
+	}
+	d.len = n
+	return (*d.buf)[:n]
+}
+
+// staticBuf for overwriting code at the given address.
+func staticBuf(text []byte, addr int32) *code.Buf {
+	return &code.Buf{
+		Buffer: buffer.NewStatic(text[addr:addr], len(text)-int(addr)),
+		Addr:   addr,
+	}
+}
+
+// regionBuf for overwriting code at the given region-relative address.
+func regionBuf(text []byte, r *Region, addr int32) *code.Buf {
+	return staticBuf(text[r.TextAddr:], addr)
+}
+
+func alignSize(size, alignment int) int {
+	return (size + (alignment - 1)) &^ (alignment - 1)
+}
+
+func alignAddr(addr, alignment int32) int32 {
+	return (addr + (alignment - 1)) &^ (alignment - 1)
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package link
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/wa"
+)
+
+// Exports memory and f(i32) i32; has one global.
+const testLib = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x06\x01\x60\x01\x7f\x01\x7f\x03\x02\x01\x00\x05\x03\x01\x00\x01\x06\x06\x01\x7f\x01\x41\x01\x0b\x07\x0e\x02\x06\x6d\x65\x6d\x6f\x72\x79\x02\x00\x01\x66\x00\x00\x0a\x09\x01\x07\x00\x20\x00\x41\x02\x6c\x0b"
+
+// Imports memory and f(i32) i32 from lib; has one global; exports main.
+const testApp = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0a\x02\x60\x01\x7f\x01\x7f\x60\x00\x01\x7f\x02\x17\x02\x03\x6c\x69\x62\x01\x66\x00\x00\x03\x6c\x69\x62\x06\x6d\x65\x6d\x6f\x72\x79\x02\x00\x01\x03\x02\x01\x01\x06\x06\x01\x7f\x01\x41\x02\x0b\x07\x08\x01\x04\x6d\x61\x69\x6e\x00\x01\x0a\x08\x01\x06\x00\x41\x03\x10\x00\x0b"
+
+// Like testApp, but imports f(i64) i32.
+const testAppBadSig = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x0a\x02\x60\x01\x7e\x01\x7f\x60\x00\x01\x7f\x02\x17\x02\x03\x6c\x69\x62\x01\x66\x00\x00\x03\x6c\x69\x62\x06\x6d\x65\x6d\x6f\x72\x79\x02\x00\x01\x03\x02\x01\x01\x06\x06\x01\x7f\x01\x41\x02\x0b\x07\x08\x01\x04\x6d\x61\x69\x6e\x00\x01\x0a\x08\x01\x06\x00\x41\x03\x10\x00\x0b"
+
+type testResolver struct{}
+
+func (testResolver) ResolveFunc(module, field string, sig wa.FuncType) (int, error) {
+	panic(module + "." + field)
+}
+
+func (testResolver) ResolveGlobal(module, field string, t wa.Type) (uint64, error) {
+	panic(module + "." + field)
+}
+
+func testModules(app string) []Module {
+	return []Module{
+		{"lib", strings.NewReader(testLib)},
+		{"app", strings.NewReader(app)},
+	}
+}
+
+func TestLink(t *testing.T) {
+	const vectorSize = 256
+
+	config := &Config{
+		VectorSize: vectorSize,
+		Entry:      "main",
+	}
+
+	prog, err := Link(config, testModules(testApp), testResolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lib := prog.Regions[0]
+	app := prog.Regions[1]
+
+	if lib.TextAddr != 0 || lib.TextSize == 0 {
+		t.Errorf("lib region: 0x%x (%d bytes)", lib.TextAddr, lib.TextSize)
+	}
+	if app.TextAddr < lib.TextSize+vectorSize || app.TextAddr%regionAlignment != 0 || app.TextAddr+app.TextSize != len(prog.Text) {
+		t.Errorf("app region: 0x%x (%d bytes)", app.TextAddr, app.TextSize)
+	}
+
+	vector := make([]byte, vectorSize)
+	for i := range vector {
+		vector[i] = 0xee
+	}
+	prog.PutImportVector(vector)
+	for _, b := range prog.Text[app.TextAddr-vectorSize : app.TextAddr] {
+		if b != 0xee {
+			t.Fatal("import vector was not copied")
+		}
+	}
+
+	if prog.InitialMemorySize != wa.PageSize {
+		t.Errorf("initial memory size: %d", prog.InitialMemorySize)
+	}
+
+	// Lib's global is closest to memory.
+	globals := prog.GlobalsMemory[:prog.MemoryOffset]
+	if x := binary.LittleEndian.Uint64(globals[len(globals)-8:]); x != 1 {
+		t.Errorf("lib global: %d", x)
+	}
+	if x := binary.LittleEndian.Uint64(globals[len(globals)-16:]); x != 2 {
+		t.Errorf("app global: %d", x)
+	}
+
+	// Entry function is called via a function in the first region.
+	entryAddr := binary.LittleEndian.Uint64(prog.StackFrame)
+	if entryAddr == 0 || entryAddr >= uint64(lib.TextSize) {
+		t.Errorf("entry address: 0x%x", entryAddr)
+	}
+}
+
+func TestLinkSignatureMismatch(t *testing.T) {
+	_, err := Link(nil, testModules(testAppBadSig), testResolver{})
+	if err == nil || !strings.Contains(err.Error(), "wrong signature") {
+		t.Error(err)
+	}
+}
+
+func TestLinkEntryArgsMismatch(t *testing.T) {
+	config := &Config{
+		VectorSize: 256,
+		Entry:      "main",
+		EntryArgs:  []uint64{1},
+	}
+
+	_, err := Link(config, testModules(testApp), testResolver{})
+	if e, ok := err.(*binding.EntryError); !ok || len(e.Args) != 1 {
+		t.Error(err)
+	}
+}
+
+func TestCompileMemoryImport(t *testing.T) {
+	// Only the linker binds memory imports.
+	_, err := wag.Compile(nil, strings.NewReader(testApp), testResolver{})
+	if err == nil || !strings.Contains(err.Error(), "import kind not supported") {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+// Package memory manages the address space of globals and linear memory.
+//
+// Address space is reserved for the maximum memory size up front, and pages
+// are made accessible as the memory grows.  The reservation is followed by a
+// guard region.  By default it is large enough for the virtual memory
+// hardware to catch all out-of-bounds accesses made by code which has been
+// compiled without explicit bounds checks.  A smaller guard region may be
+// used with code which has been compiled with bounds checks (see
+// wag.Config.BoundsChecks).
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+
+	"github.com/tsavola/wag/wa"
+)
+
+// UncheckedAddressSpace is reserved for linear memory (excluding globals) if
+// guard size is not specified.  It covers the address range reachable by
+// 32-bit index and 31-bit offset.
+const UncheckedAddressSpace = 8 * 1024 * 1024 * 1024
+
+// ErrSizeLimit is returned by Grow.
+var ErrSizeLimit = errors.New("memory size limit exceeded")
+
+// Memory is a reserved address space for globals and linear memory.
+type Memory struct {
+	space        []byte
+	memoryOffset int
+	size         int
+	sizeLimit    int
+}
+
+// Reserve address space for globals and linear memory.  Memory offset is the
+// size of the globals region (see wag.Object.MemoryOffset); it must be a
+// multiple of the page size.  Initial size bytes of memory are made
+// accessible.  Size limit is the maximum memory size (see
+// wag.Object.MemorySizeLimit).  If guard size is zero, UncheckedAddressSpace
+// is reserved for memory.  Otherwise the guard size must be at least one
+// page; it is rounded up to page size.
+func Reserve(memoryOffset, initialSize, sizeLimit, guardSize int) (mem *Memory, err error) {
+	pageSize := os.Getpagesize()
+
+	if memoryOffset&(pageSize-1) != 0 {
+		err = fmt.Errorf("memory offset %d is not a multiple of page size %d", memoryOffset, pageSize)
+		return
+	}
+
+	if initialSize&(wa.PageSize-1) != 0 || sizeLimit&(wa.PageSize-1) != 0 {
+		err = errors.New("memory size is not a multiple of WebAssembly page size")
+		return
+	}
+
+	if initialSize > sizeLimit {
+		err = fmt.Errorf("initial memory size %d exceeds memory size limit %d", initialSize, sizeLimit)
+		return
+	}
+
+	var spaceSize int
+
+	switch {
+	case guardSize == 0:
+		spaceSize = memoryOffset + UncheckedAddressSpace
+
+	case guardSize < pageSize:
+		err = fmt.Errorf("guard size %d is less than page size %d", guardSize, pageSize)
+		return
+
+	default:
+		spaceSize = memoryOffset + sizeLimit + alignSize(guardSize, pageSize)
+	}
+
+	mem = &Memory{
+		memoryOffset: memoryOffset,
+		sizeLimit:    sizeLimit,
+	}
+
+	mem.space, err = syscall.Mmap(-1, 0, spaceSize, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS|syscall.MAP_NORESERVE)
+	if err != nil {
+		mem = nil
+		return
+	}
+
+	if memoryOffset > 0 {
+		if err = syscall.Mprotect(mem.space[:memoryOffset], syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+			mem.Close()
+			mem = nil
+			return
+		}
+	}
+
+	if err = mem.Grow(initialSize); err != nil {
+		mem.Close()
+		mem = nil
+		return
+	}
+
+	return
+}
+
+// GlobalsMemory gets the globals and the currently accessible linear memory.
+// The memory is preceded by the globals; the threshold is the memory offset.
+func (mem *Memory) GlobalsMemory() []byte {
+	return mem.space[:mem.memoryOffset+mem.size]
+}
+
+// MemoryAddr is the absolute address of the linear memory.
+func (mem *Memory) MemoryAddr() uintptr {
+	return (*reflect.SliceHeader)(unsafe.Pointer(&mem.space)).Data + uintptr(mem.memoryOffset)
+}
+
+// Size of the accessible linear memory in bytes.
+func (mem *Memory) Size() int {
+	return mem.size
+}
+
+// SizeLimit is the maximum linear memory size in bytes.
+func (mem *Memory) SizeLimit() int {
+	return mem.sizeLimit
+}
+
+// Grow the accessible linear memory by increment bytes.  It must be a
+// multiple of WebAssembly page size.  ErrSizeLimit is returned if the memory
+// would exceed the size limit.
+func (mem *Memory) Grow(increment int) (err error) {
+	if increment&(wa.PageSize-1) != 0 {
+		panic(fmt.Errorf("memory size increment %d is not a multiple of WebAssembly page size", increment))
+	}
+
+	if increment > mem.sizeLimit-mem.size {
+		err = ErrSizeLimit
+		return
+	}
+
+	if increment == 0 {
+		return
+	}
+
+	offset := mem.memoryOffset + mem.size
+
+	if err = syscall.Mprotect(mem.space[offset:offset+increment], syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+		return
+	}
+
+	mem.size += increment
+	return
+}
+
+// Close unmaps the address space.
+func (mem *Memory) Close() (err error) {
+	if mem.space != nil {
+		err = syscall.Munmap(mem.space)
+		mem.space = nil
+	}
+	return
+}
+
+func alignSize(size, alignment int) int {
+	return (size + (alignment - 1)) &^ (alignment - 1)
+}
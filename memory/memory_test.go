@@ -0,0 +1,51 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package memory
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tsavola/wag/wa"
+)
+
+func TestGrow(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	mem, err := Reserve(pageSize, wa.PageSize, 3*wa.PageSize, pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mem.Close()
+
+	data := mem.GlobalsMemory()
+	if len(data) != pageSize+wa.PageSize {
+		t.Fatal(len(data))
+	}
+	data[0] = 1
+	data[len(data)-1] = 2
+
+	if err := mem.Grow(2 * wa.PageSize); err != nil {
+		t.Fatal(err)
+	}
+
+	data = mem.GlobalsMemory()
+	if len(data) != pageSize+3*wa.PageSize || mem.Size() != 3*wa.PageSize {
+		t.Fatal(len(data))
+	}
+	if data[0] != 1 || data[pageSize+wa.PageSize-1] != 2 {
+		t.Error("contents")
+	}
+	data[len(data)-1] = 3
+
+	if err := mem.Grow(wa.PageSize); err != ErrSizeLimit {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if mem.Size() != 3*wa.PageSize {
+		t.Error(mem.Size())
+	}
+}
@@ -0,0 +1,489 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cache implements a versioned storage format for compiled objects.
+//
+// The file starts with a fixed-size header which identifies the compiler
+// version, target architecture and CPU features.  It is followed by metadata
+// and machine code.  The text is aligned so that it can be mapped directly
+// from the file.
+//
+// Custom sections (such as DWARF) are not stored.
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/compile"
+	"github.com/tsavola/wag/internal/errorpanic"
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/object/debug"
+	"github.com/tsavola/wag/section"
+	"github.com/tsavola/wag/wa"
+)
+
+const (
+	FormatVersion = 1
+
+	HeaderSize    = 64
+	TextAlignment = 65536 // Largest supported page size.
+)
+
+var magic = [8]byte{'\x00', 'w', 'a', 'g', 'o', 'b', 'j', '\x00'}
+
+var errCorrupt = errors.New("cached object is corrupt")
+
+// IncompatibleError is returned if a cached object has been compiled by a
+// different compiler version, or for a different target.  The module needs
+// to be recompiled.
+type IncompatibleError struct {
+	Reason string
+}
+
+func (e *IncompatibleError) Error() string {
+	return "cached object is incompatible: " + e.Reason
+}
+
+// Header of a cached object.
+type Header struct {
+	FormatVersion uint32
+	ObjectVersion uint32
+	ISA           string
+	Features      uint64
+	MetadataSize  uint64
+	TextOffset    uint64 // Multiple of TextAlignment.
+	TextSize      uint64
+}
+
+// ParseHeader decodes and checks the header.  The buffer must contain at
+// least HeaderSize bytes.
+func ParseHeader(b []byte) (h Header, err error) {
+	if len(b) < HeaderSize || string(b[:8]) != string(magic[:]) {
+		err = errors.New("not a cached object")
+		return
+	}
+
+	h.FormatVersion = binary.LittleEndian.Uint32(b[8:])
+	h.ObjectVersion = binary.LittleEndian.Uint32(b[12:])
+	h.ISA = string(trimZeros(b[16:24]))
+	h.Features = binary.LittleEndian.Uint64(b[24:])
+	h.MetadataSize = binary.LittleEndian.Uint64(b[32:])
+	h.TextOffset = binary.LittleEndian.Uint64(b[40:])
+	h.TextSize = binary.LittleEndian.Uint64(b[48:])
+
+	switch {
+	case h.FormatVersion != FormatVersion:
+		err = &IncompatibleError{fmt.Sprintf("format version %d", h.FormatVersion)}
+
+	case h.ObjectVersion != compile.ObjectVersion:
+		err = &IncompatibleError{fmt.Sprintf("object version %d", h.ObjectVersion)}
+
+	case h.ISA != compile.TargetISA():
+		err = &IncompatibleError{fmt.Sprintf("target ISA %q", h.ISA)}
+
+	case h.Features != compile.TargetFeatures():
+		err = &IncompatibleError{fmt.Sprintf("CPU features 0x%x (current CPU has 0x%x)", h.Features, compile.TargetFeatures())}
+
+	case h.TextOffset%TextAlignment != 0 || h.TextOffset < HeaderSize || h.MetadataSize > h.TextOffset-HeaderSize:
+		err = errCorrupt
+	}
+	return
+}
+
+func (h *Header) put(b []byte) {
+	copy(b, magic[:])
+	binary.LittleEndian.PutUint32(b[8:], h.FormatVersion)
+	binary.LittleEndian.PutUint32(b[12:], h.ObjectVersion)
+	copy(b[16:24], h.ISA)
+	binary.LittleEndian.PutUint64(b[24:], h.Features)
+	binary.LittleEndian.PutUint64(b[32:], h.MetadataSize)
+	binary.LittleEndian.PutUint64(b[40:], h.TextOffset)
+	binary.LittleEndian.PutUint64(b[48:], h.TextSize)
+}
+
+// Write an object which has been compiled in this process.
+func Write(w io.Writer, o *wag.Object) (err error) {
+	meta := encodeMetadata(o)
+
+	h := Header{
+		FormatVersion: FormatVersion,
+		ObjectVersion: compile.ObjectVersion,
+		ISA:           compile.TargetISA(),
+		Features:      compile.TargetFeatures(),
+		MetadataSize:  uint64(len(meta)),
+		TextOffset:    alignSize(uint64(HeaderSize+len(meta)), TextAlignment),
+		TextSize:      uint64(len(o.Text)),
+	}
+
+	buf := make([]byte, h.TextOffset)
+	h.put(buf)
+	copy(buf[HeaderSize:], meta)
+
+	if _, err = w.Write(buf); err != nil {
+		return
+	}
+
+	_, err = w.Write(o.Text)
+	return
+}
+
+// Read an object.  The whole file is read into memory.
+func Read(r io.Reader) (o *wag.Object, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	return Load(data)
+}
+
+// Load an object from a buffer which holds the whole file.  The object's Text
+// refers to the buffer.  The buffer may be a memory mapping of the file; the
+// text region (see Header) can be remapped with execute permission.
+func Load(data []byte) (o *wag.Object, err error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return
+	}
+
+	if h.TextOffset+h.TextSize > uint64(len(data)) || h.TextOffset+h.TextSize < h.TextOffset {
+		err = errCorrupt
+		return
+	}
+
+	o, err = decodeMetadata(data[HeaderSize : HeaderSize+h.MetadataSize])
+	if err != nil {
+		return
+	}
+
+	o.Text = data[h.TextOffset : h.TextOffset+h.TextSize : h.TextOffset+h.TextSize]
+	return
+}
+
+func encodeMetadata(o *wag.Object) []byte {
+	var e encoder
+
+	e.uint(uint64(len(o.FuncTypes)))
+	for _, sig := range o.FuncTypes {
+		e.funcType(sig)
+	}
+
+	e.int(int64(o.InitialMemorySize))
+	e.int(int64(o.MemorySizeLimit))
+
+	e.uint(uint64(len(o.FuncAddrs)))
+	for _, addr := range o.FuncAddrs {
+		e.uint(uint64(addr))
+	}
+
+	e.uint(uint64(o.NumImportFuncs))
+
+	e.uint(uint64(len(o.TrapAddrs)))
+	for _, addr := range o.TrapAddrs {
+		e.uint(uint64(addr))
+	}
+
+	e.uint(uint64(len(o.Relocs)))
+	for _, r := range o.Relocs {
+		e.uint(uint64(r.Addr))
+		e.uint(uint64(r.Import))
+		e.uint(r.Target)
+	}
+
+	e.uint(uint64(len(o.CallSites)))
+	for _, site := range o.CallSites {
+		e.uint(uint64(site.RetAddr))
+		e.int(int64(site.StackOffset))
+	}
+
+	e.uint(uint64(len(o.Insns)))
+	for _, insn := range o.Insns {
+		e.uint(uint64(insn.ObjectPos))
+		e.uint(uint64(insn.SourcePos))
+		e.int(int64(insn.BlockLen))
+	}
+
+	e.int(int64(o.MemoryOffset))
+	e.bytes(o.GlobalsMemory)
+
+	names := make([]string, 0, len(o.ExportFuncs))
+	for name := range o.ExportFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		f := o.ExportFuncs[name]
+		e.string(name)
+		e.uint(uint64(f.Index))
+		e.funcType(f.FuncType)
+	}
+
+	e.bytes(o.StackFrame)
+
+	names = names[:0]
+	for name := range o.EntryFrames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	e.uint(uint64(len(names)))
+	for _, name := range names {
+		e.string(name)
+		e.bytes(o.EntryFrames[name])
+	}
+
+	e.string(o.Names.ModuleName)
+	e.uint(uint64(len(o.Names.FuncNames)))
+	for _, f := range o.Names.FuncNames {
+		e.string(f.FuncName)
+		e.uint(uint64(len(f.LocalNames)))
+		for _, name := range f.LocalNames {
+			e.string(name)
+		}
+	}
+
+	return e.buf
+}
+
+func decodeMetadata(b []byte) (o *wag.Object, err error) {
+	defer func() {
+		if x := recover(); x != nil {
+			o = nil
+			err = errorpanic.Handle(x)
+		}
+	}()
+
+	d := decoder{b}
+	o = new(wag.Object)
+
+	o.FuncTypes = make([]wa.FuncType, d.count())
+	for i := range o.FuncTypes {
+		o.FuncTypes[i] = d.funcType()
+	}
+
+	o.InitialMemorySize = int(d.int())
+	o.MemorySizeLimit = int(d.int())
+
+	o.FuncAddrs = make([]uint32, d.count())
+	for i := range o.FuncAddrs {
+		o.FuncAddrs[i] = d.uint32()
+	}
+
+	o.NumImportFuncs = int(d.uint32())
+
+	if n := d.count(); n > 0 {
+		o.TrapAddrs = make([]uint32, n)
+		for i := range o.TrapAddrs {
+			o.TrapAddrs[i] = d.uint32()
+		}
+	}
+
+	if n := d.count(); n > 0 {
+		o.Relocs = make([]object.Reloc, n)
+		for i := range o.Relocs {
+			o.Relocs[i] = object.Reloc{
+				Addr:   d.uint32(),
+				Import: d.uint32(),
+				Target: d.uint(),
+			}
+		}
+	}
+
+	o.CallSites = make([]object.CallSite, d.count())
+	for i := range o.CallSites {
+		o.CallSites[i] = object.CallSite{
+			RetAddr:     d.uint32(),
+			StackOffset: d.int32(),
+		}
+	}
+
+	if n := d.count(); n > 0 {
+		o.Insns = make([]debug.InsnMapping, n)
+		for i := range o.Insns {
+			o.Insns[i] = debug.InsnMapping{
+				ObjectPos: d.uint32(),
+				SourcePos: d.uint32(),
+				BlockLen:  d.int32(),
+			}
+		}
+	}
+
+	o.MemoryOffset = int(d.int())
+	o.GlobalsMemory = d.bytes()
+
+	o.ExportFuncs = make(map[string]wag.ExportFunc)
+	for n := d.count(); n > 0; n-- {
+		name := d.string()
+		index := d.uint32()
+		o.ExportFuncs[name] = wag.ExportFunc{Index: index, FuncType: d.funcType()}
+	}
+
+	o.StackFrame = d.bytes()
+
+	if n := d.count(); n > 0 {
+		o.EntryFrames = make(map[string][]byte)
+		for ; n > 0; n-- {
+			name := d.string()
+			o.EntryFrames[name] = d.bytes()
+		}
+	}
+
+	o.Names.ModuleName = d.string()
+	if n := d.count(); n > 0 {
+		o.Names.FuncNames = make([]section.FuncName, n)
+		for i := range o.Names.FuncNames {
+			f := &o.Names.FuncNames[i]
+			f.FuncName = d.string()
+			if n := d.count(); n > 0 {
+				f.LocalNames = make([]string, n)
+				for j := range f.LocalNames {
+					f.LocalNames[j] = d.string()
+				}
+			}
+		}
+	}
+
+	if len(d.buf) != 0 {
+		panic(errCorrupt)
+	}
+	return
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(x uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, tmp[:binary.PutUvarint(tmp[:], x)]...)
+}
+
+func (e *encoder) int(x int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, tmp[:binary.PutVarint(tmp[:], x)]...)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) funcType(sig wa.FuncType) {
+	e.uint(uint64(len(sig.Params)))
+	for _, t := range sig.Params {
+		e.uint(uint64(t))
+	}
+	e.uint(uint64(sig.Result))
+}
+
+// decoder panics with errCorrupt if data is truncated or invalid.
+type decoder struct {
+	buf []byte
+}
+
+func (d *decoder) uint() uint64 {
+	x, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		panic(errCorrupt)
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *decoder) int() int64 {
+	x, n := binary.Varint(d.buf)
+	if n <= 0 {
+		panic(errCorrupt)
+	}
+	d.buf = d.buf[n:]
+	return x
+}
+
+func (d *decoder) uint32() uint32 {
+	x := d.uint()
+	if x > 0xffffffff {
+		panic(errCorrupt)
+	}
+	return uint32(x)
+}
+
+func (d *decoder) int32() int32 {
+	x := d.int()
+	if int64(int32(x)) != x {
+		panic(errCorrupt)
+	}
+	return int32(x)
+}
+
+// count of items, each of which takes at least one byte.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		panic(errCorrupt)
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	b := make([]byte, n)
+	copy(b, d.buf)
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) funcType() (sig wa.FuncType) {
+	if n := d.count(); n > 0 {
+		sig.Params = make([]wa.Type, n)
+		for i := range sig.Params {
+			sig.Params[i] = d.valueType()
+		}
+	}
+	if sig.Result = wa.Type(d.uint()); sig.Result != wa.Void {
+		sig.Result = checkType(sig.Result)
+	}
+	return
+}
+
+func (d *decoder) valueType() wa.Type {
+	return checkType(wa.Type(d.uint()))
+}
+
+func checkType(t wa.Type) wa.Type {
+	switch t {
+	case wa.I32, wa.I64, wa.F32, wa.F64:
+		return t
+	}
+	panic(errCorrupt)
+}
+
+func trimZeros(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
+
+func alignSize(size, alignment uint64) uint64 {
+	return (size + (alignment - 1)) &^ (alignment - 1)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+)
+
+func compileTestObject(t *testing.T) *wag.Object {
+	t.Helper()
+
+	data, err := ioutil.ReadFile("../../testdata/nqueens.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &wag.Config{
+		Entry:     "benchmark_main",
+		DebugInfo: true,
+	}
+
+	obj, err := wag.Compile(config, bytes.NewReader(data), &binding.Lazy{NextVectorIndex: binding.VectorIndexLastImport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj.Debug.Sections = nil // Not stored.
+	return obj
+}
+
+func TestRoundTrip(t *testing.T) {
+	obj := compileTestObject(t)
+
+	buf := new(bytes.Buffer)
+	if err := Write(buf, obj); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ParseHeader(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.TextOffset%TextAlignment != 0 || h.TextSize != uint64(len(obj.Text)) || uint64(buf.Len()) != h.TextOffset+h.TextSize {
+		t.Errorf("%#v", h)
+	}
+
+	loaded, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkEqual(t, obj, loaded)
+	if len(loaded.Insns) == 0 || len(loaded.Names.FuncNames) == 0 || len(loaded.ExportFuncs) == 0 {
+		t.Error("metadata is missing")
+	}
+}
+
+// checkEqual compares the stored fields, treating nil and empty slices as
+// equal.
+func checkEqual(t *testing.T, a, b *wag.Object) {
+	t.Helper()
+
+	if len(a.FuncTypes) != len(b.FuncTypes) {
+		t.Error("FuncTypes")
+	} else {
+		for i := range a.FuncTypes {
+			if !a.FuncTypes[i].Equal(b.FuncTypes[i]) {
+				t.Error("FuncTypes", i)
+			}
+		}
+	}
+
+	if len(a.ExportFuncs) != len(b.ExportFuncs) {
+		t.Error("ExportFuncs")
+	} else {
+		for name, f := range a.ExportFuncs {
+			if g := b.ExportFuncs[name]; g.Index != f.Index || !g.Equal(f.FuncType) {
+				t.Error("ExportFuncs", name)
+			}
+		}
+	}
+
+	for _, x := range []struct {
+		name string
+		a, b interface{}
+	}{
+		{"InitialMemorySize", a.InitialMemorySize, b.InitialMemorySize},
+		{"MemorySizeLimit", a.MemorySizeLimit, b.MemorySizeLimit},
+		{"Text", a.Text, b.Text},
+		{"FuncAddrs", a.FuncAddrs, b.FuncAddrs},
+		{"NumImportFuncs", a.NumImportFuncs, b.NumImportFuncs},
+		{"TrapAddrs", a.TrapAddrs, b.TrapAddrs},
+		{"Relocs", a.Relocs, b.Relocs},
+		{"CallSites", a.CallSites, b.CallSites},
+		{"Insns", a.Insns, b.Insns},
+		{"MemoryOffset", a.MemoryOffset, b.MemoryOffset},
+		{"GlobalsMemory", a.GlobalsMemory, b.GlobalsMemory},
+		{"StackFrame", a.StackFrame, b.StackFrame},
+		{"EntryFrames", a.EntryFrames, b.EntryFrames},
+		{"Names", a.Names, b.Names},
+	} {
+		if !reflect.DeepEqual(x.a, x.b) {
+			t.Error(x.name)
+		}
+	}
+}
+
+func TestReject(t *testing.T) {
+	obj := compileTestObject(t)
+
+	buf := new(bytes.Buffer)
+	if err := Write(buf, obj); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	for i, patch := range []func(b []byte){
+		func(b []byte) { binary.LittleEndian.PutUint32(b[8:], FormatVersion+1) },
+		func(b []byte) { binary.LittleEndian.PutUint32(b[12:], 0xffffffff) },
+		func(b []byte) { copy(b[16:24], "sparc\x00\x00\x00") },
+		func(b []byte) { b[24] ^= 1 },
+	} {
+		b := append([]byte(nil), data...)
+		patch(b)
+
+		if _, err := Load(b); err == nil {
+			t.Errorf("patch #%d: mismatch not detected", i)
+		} else if _, ok := err.(*IncompatibleError); !ok {
+			t.Errorf("patch #%d: %v", i, err)
+		}
+	}
+
+	for _, n := range []int{0, HeaderSize, len(data) - 1} {
+		if _, err := Load(data[:n]); err == nil {
+			t.Errorf("truncated to %d bytes: no error", n)
+		}
+	}
+
+	b := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint64(b[32:], 3) // Truncate metadata.
+	if _, err := Load(b); err == nil {
+		t.Error("corrupt metadata not detected")
+	}
+}
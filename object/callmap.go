@@ -44,6 +44,16 @@ func (m *CallMap) PutCallSite(retAddr uint32, stackOffset int32) {
 	m.CallSites = append(m.CallSites, CallSite{retAddr, stackOffset})
 }
 
+// NumCallSites returns the number of call sites.
+func (m *CallMap) NumCallSites() int {
+	return len(m.CallSites)
+}
+
+// CallSite returns a call site by its index.
+func (m *CallMap) CallSite(i int) CallSite {
+	return m.CallSites[i]
+}
+
 func (m CallMap) FindAddr(retAddr uint32) (funcIndex, callIndex, _ uint32, stackOffset int32, initial, ok bool) {
 	funcIndex, _, _, _, initial, funcOk := m.FuncMap.FindAddr(retAddr)
 	if !funcOk {
@@ -0,0 +1,63 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package object
+
+import (
+	"github.com/tsavola/wag/object/internal/compact"
+)
+
+// CompactCallMap is a read-only representation of CallMap which uses less
+// memory.  Call sites are delta-encoded using variable-length integers, and
+// a sparse index provides random access.
+type CompactCallMap struct {
+	FuncMap
+	callSites compact.Seq
+}
+
+// Compact encodes the call sites.  The function addresses are shared.
+func (m *CallMap) Compact() (c CompactCallMap) {
+	var b compact.Builder
+
+	for _, site := range m.CallSites {
+		b.Append(site.RetAddr, int64(site.StackOffset))
+	}
+
+	c.FuncMap = m.FuncMap
+	c.callSites = b.Seq
+	return
+}
+
+// NumCallSites returns the number of call sites.
+func (m *CompactCallMap) NumCallSites() int {
+	return m.callSites.Len
+}
+
+// CallSite decodes a call site.
+func (m *CompactCallMap) CallSite(i int) CallSite {
+	var values [1]int64
+	retAddr := m.callSites.Get(i, values[:])
+	return CallSite{retAddr, int32(values[0])}
+}
+
+// CallSitesSize returns the size of the encoded call sites in bytes.
+func (m *CompactCallMap) CallSitesSize() int {
+	return m.callSites.Size()
+}
+
+func (m CompactCallMap) FindAddr(retAddr uint32) (funcIndex, callIndex, _ uint32, stackOffset int32, initial, ok bool) {
+	funcIndex, _, _, _, initial, funcOk := m.FuncMap.FindAddr(retAddr)
+	if !funcOk {
+		return
+	}
+
+	var values [1]int64
+	i, siteAddr := m.callSites.Search(retAddr, values[:])
+	if i < m.callSites.Len && siteAddr == retAddr {
+		callIndex = uint32(i)
+		stackOffset = int32(values[0])
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/object/internal/compact"
+)
+
+// CompactInsnMap is a read-only representation of InsnMap which uses less
+// memory.  Call sites and instruction mappings are delta-encoded using
+// variable-length integers, and sparse indexes provide random access.
+type CompactInsnMap struct {
+	object.CompactCallMap
+	insns compact.Seq
+}
+
+// Compact encodes the call sites and instruction mappings.  The function
+// addresses are shared.
+func (m *InsnMap) Compact() (c CompactInsnMap) {
+	var b compact.Builder
+
+	for _, insn := range m.Insns {
+		b.Append(insn.ObjectPos, int64(insn.SourcePos), int64(insn.BlockLen))
+	}
+
+	c.CompactCallMap = m.CallMap.Compact()
+	c.insns = b.Seq
+	return
+}
+
+// NumInsns returns the number of instruction mappings.
+func (m *CompactInsnMap) NumInsns() int {
+	return m.insns.Len
+}
+
+// Insn decodes an instruction mapping.
+func (m *CompactInsnMap) Insn(i int) InsnMapping {
+	var values [2]int64
+	objectPos := m.insns.Get(i, values[:])
+	return InsnMapping{objectPos, uint32(values[0]), int32(values[1])}
+}
+
+// InsnsSize returns the size of the encoded instruction mappings in bytes.
+func (m *CompactInsnMap) InsnsSize() int {
+	return m.insns.Size()
+}
+
+func (m CompactInsnMap) FindAddr(retAddr uint32) (funcIndex, callIndex, retInsnPos uint32, stackOffset int32, initial, ok bool) {
+	funcIndex, callIndex, _, stackOffset, initial, siteOk := m.CompactCallMap.FindAddr(retAddr)
+	if !siteOk {
+		return
+	}
+
+	if initial {
+		ok = true
+		return
+	}
+
+	var values [2]int64
+	retIndex, _ := m.insns.Search(retAddr, values[:])
+
+	if retIndex > 0 && retIndex < m.insns.Len {
+		retInsnPos = uint32(values[0])
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+)
+
+func TestCompactInsnMap(t *testing.T) {
+	data, err := ioutil.ReadFile("../../testdata/nqueens.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &wag.Config{DebugInfo: true}
+
+	obj, err := wag.Compile(config, bytes.NewReader(data), &binding.Lazy{NextVectorIndex: binding.VectorIndexLastImport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := obj.InsnMap
+	c := m.Compact()
+
+	if c.NumCallSites() != len(m.CallSites) || c.NumInsns() != len(m.Insns) {
+		t.Fatal(c.NumCallSites(), c.NumInsns())
+	}
+	for i, site := range m.CallSites {
+		if x := c.CallSite(i); x != site {
+			t.Errorf("call site #%d: %v != %v", i, x, site)
+		}
+	}
+	for i, insn := range m.Insns {
+		if x := c.Insn(i); x != insn {
+			t.Errorf("insn #%d: %v != %v", i, x, insn)
+		}
+	}
+
+	for addr := uint32(0); addr <= uint32(len(obj.Text)); addr++ {
+		f1, c1, p1, s1, i1, ok1 := m.FindAddr(addr)
+		f2, c2, p2, s2, i2, ok2 := c.FindAddr(addr)
+		if f1 != f2 || c1 != c2 || p1 != p2 || s1 != s2 || i1 != i2 || ok1 != ok2 {
+			t.Fatalf("address 0x%x: %v %v %v %v %v %v != %v %v %v %v %v %v", addr, f1, c1, p1, s1, i1, ok1, f2, c2, p2, s2, i2, ok2)
+		}
+	}
+
+	plain := len(m.CallSites)*8 + len(m.Insns)*12
+	encoded := c.CallSitesSize() + c.InsnsSize()
+	t.Logf("%d bytes -> %d bytes", plain, encoded)
+	if encoded*2 > plain {
+		t.Error("encoding is not compact")
+	}
+}
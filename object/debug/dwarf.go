@@ -0,0 +1,317 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/tsavola/wag/section"
+)
+
+// DWARF line number program parameters.
+const (
+	lineBase   = -5
+	lineRange  = 14
+	opcodeBase = 13
+)
+
+type sourceLine struct {
+	addr uint64
+	file string
+	line int
+	end  bool
+}
+
+// NativeDWARF composes the instruction map with the WebAssembly module's DWARF
+// line information.  The returned .debug_abbrev, .debug_info and .debug_line
+// sections describe the machine code located at textAddr.  The compile unit
+// contains a subprogram entry for each function defined in the module; they
+// are named after the name section (if any).
+//
+// The WebAssembly DWARF addresses are expected to correspond to the
+// instruction map's source positions, i.e. code section offsets.  Only line
+// information is translated: variable locations and types are not available.
+func (m *InsnMap) NativeDWARF(textAddr uint64, textSize int, names *section.NameSection, wasm *dwarf.Data) (sections map[string][]byte, err error) {
+	lines, err := readLines(wasm)
+	if err != nil {
+		return
+	}
+
+	var (
+		fileIndexes = make(map[string]int)
+		fileNames   []string
+		prog        bytes.Buffer
+		prevAddr    uint64
+		prevFile    = 1
+		prevLine    = 1
+		started     bool
+	)
+
+	for _, insn := range m.Insns {
+		if insn.SourcePos == 0 {
+			continue
+		}
+
+		i := sort.Search(len(lines), func(i int) bool {
+			return lines[i].addr > uint64(insn.SourcePos)
+		}) - 1
+		if i < 0 || lines[i].end {
+			continue
+		}
+		l := lines[i]
+
+		file := fileIndexes[l.file]
+		if file == 0 {
+			fileNames = append(fileNames, l.file)
+			file = len(fileNames)
+			fileIndexes[l.file] = file
+		}
+
+		if started && file == prevFile && l.line == prevLine {
+			continue
+		}
+
+		addr := textAddr + uint64(insn.ObjectPos)
+
+		if !started {
+			prog.WriteByte(0) // Extended opcode
+			prog.WriteByte(9)
+			prog.WriteByte(2) // DW_LNE_set_address
+			binary.Write(&prog, binary.LittleEndian, addr)
+			started = true
+		} else {
+			prog.WriteByte(2) // DW_LNS_advance_pc
+			putUleb128(&prog, addr-prevAddr)
+		}
+
+		if file != prevFile {
+			prog.WriteByte(4) // DW_LNS_set_file
+			putUleb128(&prog, uint64(file))
+		}
+
+		if l.line != prevLine {
+			prog.WriteByte(3) // DW_LNS_advance_line
+			putSleb128(&prog, int64(l.line-prevLine))
+		}
+
+		prog.WriteByte(1) // DW_LNS_copy
+
+		prevAddr = addr
+		prevFile = file
+		prevLine = l.line
+	}
+
+	if started {
+		if end := textAddr + uint64(textSize); end > prevAddr {
+			prog.WriteByte(2) // DW_LNS_advance_pc
+			putUleb128(&prog, end-prevAddr)
+		}
+
+		prog.WriteByte(0) // Extended opcode
+		prog.WriteByte(1)
+		prog.WriteByte(1) // DW_LNE_end_sequence
+	}
+
+	sections = map[string][]byte{
+		".debug_abbrev": debugAbbrev(),
+		".debug_info":   m.debugInfo(textAddr, textSize, names),
+		".debug_line":   debugLine(fileNames, prog.Bytes()),
+	}
+	return
+}
+
+func readLines(data *dwarf.Data) (lines []sourceLine, err error) {
+	r := data.Reader()
+
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			break
+		}
+
+		if e.Tag != dwarf.TagCompileUnit {
+			if e.Children {
+				r.SkipChildren()
+			}
+			continue
+		}
+
+		lr, err := data.LineReader(e)
+		if err != nil {
+			return nil, err
+		}
+		if lr == nil {
+			continue
+		}
+
+		var le dwarf.LineEntry
+
+		for {
+			if err := lr.Next(&le); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return nil, err
+			}
+
+			l := sourceLine{addr: le.Address, end: le.EndSequence}
+			if le.File != nil {
+				l.file = le.File.Name
+			}
+			l.line = le.Line
+			lines = append(lines, l)
+		}
+
+		if e.Children {
+			r.SkipChildren()
+		}
+	}
+
+	// An end of sequence precedes a row at the same address.
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].addr == lines[j].addr {
+			return lines[i].end && !lines[j].end
+		}
+		return lines[i].addr < lines[j].addr
+	})
+	return
+}
+
+// Abbreviation codes.
+const (
+	abbrevCompileUnit = 1
+	abbrevSubprogram  = 2
+)
+
+func debugAbbrev() []byte {
+	return []byte{
+		abbrevCompileUnit,
+		0x11,       // DW_TAG_compile_unit
+		1,          // DW_CHILDREN_yes
+		0x25, 0x08, // DW_AT_producer, DW_FORM_string
+		0x10, 0x06, // DW_AT_stmt_list, DW_FORM_data4
+		0x11, 0x01, // DW_AT_low_pc, DW_FORM_addr
+		0x12, 0x01, // DW_AT_high_pc, DW_FORM_addr
+		0, 0,
+
+		abbrevSubprogram,
+		0x2e,       // DW_TAG_subprogram
+		0,          // DW_CHILDREN_no
+		0x03, 0x08, // DW_AT_name, DW_FORM_string
+		0x11, 0x01, // DW_AT_low_pc, DW_FORM_addr
+		0x12, 0x01, // DW_AT_high_pc, DW_FORM_addr
+		0, 0,
+
+		0,
+	}
+}
+
+func (m *InsnMap) debugInfo(textAddr uint64, textSize int, names *section.NameSection) []byte {
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // unit_length placeholder
+	binary.Write(&b, binary.LittleEndian, uint16(2)) // version
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // debug_abbrev_offset
+	b.WriteByte(8)                                   // address_size
+
+	putUleb128(&b, abbrevCompileUnit)
+	b.WriteString("wag\x00")
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // .debug_line offset
+	binary.Write(&b, binary.LittleEndian, textAddr)
+	binary.Write(&b, binary.LittleEndian, textAddr+uint64(textSize))
+
+	for i, addr := range m.FuncAddrs {
+		if i < m.NumImportFuncs {
+			continue
+		}
+
+		var name string
+		if names != nil && i < len(names.FuncNames) {
+			name = names.FuncNames[i].FuncName
+		}
+		if name == "" {
+			name = fmt.Sprintf("func.%d", i)
+		}
+
+		end := uint32(textSize)
+		if i+1 < len(m.FuncAddrs) {
+			end = m.FuncAddrs[i+1]
+		}
+
+		putUleb128(&b, abbrevSubprogram)
+		b.WriteString(name)
+		b.WriteByte(0)
+		binary.Write(&b, binary.LittleEndian, textAddr+uint64(addr))
+		binary.Write(&b, binary.LittleEndian, textAddr+uint64(end))
+	}
+
+	b.WriteByte(0) // End of children
+
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data, uint32(len(data)-4))
+	return data
+}
+
+func debugLine(fileNames []string, prog []byte) []byte {
+	var header bytes.Buffer
+
+	header.WriteByte(1) // minimum_instruction_length
+	header.WriteByte(1) // default_is_stmt
+	header.WriteByte(byte(lineBase & 0xff))
+	header.WriteByte(lineRange)
+	header.WriteByte(opcodeBase)
+	header.Write([]byte{0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1}) // standard_opcode_lengths
+	header.WriteByte(0)                                      // include_directories
+
+	for _, name := range fileNames {
+		header.WriteString(name)
+		header.WriteByte(0)
+		header.Write([]byte{0, 0, 0}) // Directory, modification time, length.
+	}
+	header.WriteByte(0)
+
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.LittleEndian, uint32(2+4+header.Len()+len(prog))) // unit_length
+	binary.Write(&b, binary.LittleEndian, uint16(2))                          // version
+	binary.Write(&b, binary.LittleEndian, uint32(header.Len()))               // header_length
+	b.Write(header.Bytes())
+	b.Write(prog)
+	return b.Bytes()
+}
+
+func putUleb128(b *bytes.Buffer, x uint64) {
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if x != 0 {
+			c |= 0x80
+		}
+		b.WriteByte(c)
+		if x == 0 {
+			return
+		}
+	}
+}
+
+func putSleb128(b *bytes.Buffer, x int64) {
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if (x == 0 && c&0x40 == 0) || (x == -1 && c&0x40 != 0) {
+			b.WriteByte(c)
+			return
+		}
+		b.WriteByte(c | 0x80)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package debug_test
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/object/debug"
+	wagelf "github.com/tsavola/wag/object/file/elf"
+)
+
+const testTextAddr = 0x7f0000000000
+
+// testSourceLine is the line number which the synthetic WebAssembly DWARF
+// assigns to a source position.
+func testSourceLine(pos uint32) int {
+	return int(pos/4) + 1
+}
+
+func TestNativeDWARF(t *testing.T) {
+	data, err := ioutil.ReadFile("../../testdata/nqueens.wasm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &wag.Config{DebugInfo: true}
+
+	obj, err := wag.Compile(config, bytes.NewReader(data), &binding.Lazy{NextVectorIndex: binding.VectorIndexLastImport})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wasm, err := dwarf.New(wasmDebugAbbrev(), nil, nil, wasmDebugInfo(), wasmDebugLine(obj.Insns), nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sections, err := obj.InsnMap.NativeDWARF(testTextAddr, len(obj.Text), &obj.Names, wasm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	df := &wagelf.DebugFile{
+		TextAddr:       testTextAddr,
+		TextSize:       len(obj.Text),
+		FuncAddrs:      obj.FuncAddrs,
+		NumImportFuncs: obj.NumImportFuncs,
+		TrapAddrs:      obj.TrapAddrs,
+		Names:          &obj.Names,
+		DebugSections:  sections,
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := df.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if s := f.Section(".text"); s == nil || s.Type != elf.SHT_NOBITS || s.Addr != testTextAddr {
+		t.Errorf("text section: %v", s)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(syms) < len(obj.FuncAddrs) {
+		t.Errorf("%d symbols", len(syms))
+	}
+
+	native, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, funcs := readNativeDWARF(t, native)
+
+	for i, insn := range obj.Insns {
+		if insn.SourcePos == 0 {
+			continue
+		}
+
+		addr := testTextAddr + uint64(insn.ObjectPos)
+
+		j := sort.Search(len(rows), func(j int) bool {
+			return rows[j].Address > addr
+		}) - 1
+		if j < 0 || rows[j].EndSequence {
+			t.Fatalf("instruction #%d at 0x%x has no line", i, addr)
+		}
+
+		if rows[j].File.Name != "nqueens.c" || rows[j].Line != testSourceLine(insn.SourcePos) {
+			t.Errorf("instruction #%d at 0x%x: %s:%d", i, addr, rows[j].File.Name, rows[j].Line)
+		}
+	}
+
+	for i := obj.NumImportFuncs; i < len(obj.FuncAddrs); i++ {
+		var name string
+		if i < len(obj.Names.FuncNames) {
+			name = obj.Names.FuncNames[i].FuncName
+		}
+		if name == "" {
+			name = fmt.Sprintf("func.%d", i)
+		}
+
+		if addr, found := funcs[name]; !found || addr != testTextAddr+uint64(obj.FuncAddrs[i]) {
+			t.Errorf("function #%d (%s) subprogram: 0x%x %v", i, name, addr, found)
+		}
+	}
+}
+
+func readNativeDWARF(t *testing.T, data *dwarf.Data) (rows []dwarf.LineEntry, funcs map[string]uint64) {
+	t.Helper()
+
+	funcs = make(map[string]uint64)
+
+	r := data.Reader()
+
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			break
+		}
+
+		switch e.Tag {
+		case dwarf.TagCompileUnit:
+			lr, err := data.LineReader(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var le dwarf.LineEntry
+
+			for {
+				if err := lr.Next(&le); err != nil {
+					if err == io.EOF {
+						break
+					}
+					t.Fatal(err)
+				}
+				rows = append(rows, le)
+			}
+
+		case dwarf.TagSubprogram:
+			name, _ := e.Val(dwarf.AttrName).(string)
+			addr, _ := e.Val(dwarf.AttrLowpc).(uint64)
+			funcs[name] = addr
+		}
+	}
+
+	return
+}
+
+func wasmDebugAbbrev() []byte {
+	return []byte{
+		1,
+		0x11,       // DW_TAG_compile_unit
+		0,          // DW_CHILDREN_no
+		0x03, 0x08, // DW_AT_name, DW_FORM_string
+		0x10, 0x06, // DW_AT_stmt_list, DW_FORM_data4
+		0, 0,
+		0,
+	}
+}
+
+func wasmDebugInfo() []byte {
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // unit_length placeholder
+	binary.Write(&b, binary.LittleEndian, uint16(2)) // version
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // debug_abbrev_offset
+	b.WriteByte(4)                                   // address_size
+	b.WriteByte(1)                                   // Abbreviation code
+	b.WriteString("nqueens.c\x00")
+	binary.Write(&b, binary.LittleEndian, uint32(0)) // .debug_line offset
+
+	data := b.Bytes()
+	binary.LittleEndian.PutUint32(data, uint32(len(data)-4))
+	return data
+}
+
+// wasmDebugLine assigns a line to every source position which has been mapped
+// to machine code.
+func wasmDebugLine(insns []debug.InsnMapping) []byte {
+	var positions []uint32
+	for _, insn := range insns {
+		if insn.SourcePos != 0 {
+			positions = append(positions, insn.SourcePos)
+		}
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	var prog bytes.Buffer
+
+	line := 1
+
+	for _, pos := range positions {
+		prog.Write([]byte{0, 5, 2}) // DW_LNE_set_address
+		binary.Write(&prog, binary.LittleEndian, pos)
+
+		prog.WriteByte(3) // DW_LNS_advance_line
+		putSleb128(&prog, int64(testSourceLine(pos)-line))
+		line = testSourceLine(pos)
+
+		prog.WriteByte(1) // DW_LNS_copy
+	}
+
+	prog.Write([]byte{2, 1})    // DW_LNS_advance_pc
+	prog.Write([]byte{0, 1, 1}) // DW_LNE_end_sequence
+
+	header := []byte{
+		1,    // minimum_instruction_length
+		1,    // default_is_stmt
+		0xfb, // line_base
+		14,   // line_range
+		13,   // opcode_base
+		0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1,
+		0, // include_directories
+	}
+	header = append(header, "nqueens.c\x00\x00\x00\x00\x00"...)
+
+	var b bytes.Buffer
+
+	binary.Write(&b, binary.LittleEndian, uint32(2+4+len(header)+prog.Len())) // unit_length
+	binary.Write(&b, binary.LittleEndian, uint16(2))                          // version
+	binary.Write(&b, binary.LittleEndian, uint32(len(header)))                // header_length
+	b.Write(header)
+	b.Write(prog.Bytes())
+	return b.Bytes()
+}
+
+func putSleb128(b *bytes.Buffer, x int64) {
+	for {
+		c := byte(x & 0x7f)
+		x >>= 7
+		if (x == 0 && c&0x40 == 0) || (x == -1 && c&0x40 != 0) {
+			b.WriteByte(c)
+			return
+		}
+		b.WriteByte(c | 0x80)
+	}
+}
@@ -10,4 +10,10 @@ import (
 	"debug/elf"
 )
 
-const elfMachine = elf.EM_AARCH64
+const (
+	elfMachine = elf.EM_AARCH64
+
+	relocAbs64      = elf.R_AARCH64_ABS64
+	relocCall       = elf.R_AARCH64_CALL26
+	relocCallAddend = 0
+)
@@ -0,0 +1,86 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"io"
+
+	"github.com/tsavola/wag/section"
+)
+
+// DebugFile describes machine code which has been loaded at TextAddr by some
+// other means, such as a JIT runtime.  It can be registered with a debugger
+// (e.g. via GDB's JIT interface) or loaded as a separate symbol file.
+//
+// The text itself is not included: the .text section has no contents in the
+// file.  The symbol table is included if FuncAddrs or TrapAddrs is specified.
+// DebugSections (e.g. from debug.InsnMap.NativeDWARF) should describe the
+// machine code at TextAddr.
+type DebugFile struct {
+	TextAddr       uint64
+	TextSize       int
+	FuncAddrs      []uint32             // Function addresses within text.
+	NumImportFuncs int                  // Leading FuncAddrs are import trampolines.
+	TrapAddrs      []uint32             // Trap handler addresses by trap ID.
+	Names          *section.NameSection // Function names.
+	DebugSections  map[string][]byte
+}
+
+// WriteTo writes the contents of a debug information file.
+func (f *DebugFile) WriteTo(w io.Writer) (n int64, err error) {
+	var b bytes.Buffer
+	f.writeTo(&b)
+	m, err := w.Write(b.Bytes())
+	n = int64(m)
+	return
+}
+
+func (f *DebugFile) writeTo(b *bytes.Buffer) {
+	sections := newSectionTable(64)
+
+	textIndex := sections.add(".text", elf.Section64{
+		Type:      uint32(elf.SHT_NOBITS),
+		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+		Addr:      f.TextAddr,
+		Off:       64,
+		Size:      uint64(f.TextSize),
+		Addralign: 16,
+	})
+
+	info := symbolInfo{f.FuncAddrs, f.NumImportFuncs, f.TrapAddrs, f.Names}
+	sections.addSymbols(info.symbols(f.TextAddr, f.TextSize, textIndex))
+	sections.addDebug(f.DebugSections)
+	sectionHeadersOffset := sections.finish()
+
+	// File header
+	binary.Write(b, binary.LittleEndian, elf.Header64{
+		Ident: [elf.EI_NIDENT]byte{
+			0:              0x7f,
+			1:              'E',
+			2:              'L',
+			3:              'F',
+			elf.EI_CLASS:   byte(elf.ELFCLASS64),
+			elf.EI_DATA:    byte(elf.ELFDATA2LSB),
+			elf.EI_VERSION: 1,
+		},
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elfMachine),
+		Version:   1,
+		Shoff:     uint64(sectionHeadersOffset),
+		Ehsize:    64,
+		Phentsize: 56,
+		Shentsize: 64,
+		Shnum:     uint16(len(sections.headers)),
+		Shstrndx:  uint16(len(sections.headers) - 1),
+	})
+
+	// Symbols, debug information and section headers
+	if sections.writeTo(b) != sectionHeadersOffset {
+		panic(b.Len())
+	}
+}
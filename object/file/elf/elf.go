@@ -24,6 +24,19 @@ const (
 	maxMemorySize = 0x80000000
 )
 
+// TextAddr is the address at which a File's text is mapped.  Debug
+// information sections must describe the machine code at this address.
+const TextAddr = textAddr
+
+// File is an executable program.  The segments are mapped at fixed addresses.
+// The stack segment contains the size of the entry frame (a 64-bit word), the
+// frame and the runtime data; it is writable.  Linear memory is accessible up
+// to InitialMemorySize (or the maximum size), preceded by the globals.
+//
+// Section headers describe the text, the import vector (.rodata) and the
+// initial globals and memory contents (.data).  If FuncAddrs or TrapAddrs is
+// specified, a symbol table is included.  DebugSections are included as
+// non-allocated sections.
 type File internal.File
 
 // WriteTo writes the contents of an executable program.
@@ -37,19 +50,37 @@ func (f *File) WriteTo(w io.Writer) (n int64, err error) {
 
 func (f *File) writeTo(b *bytes.Buffer) {
 	stackFrame := stack.EntryFrame(f.EntryAddr, f.EntryArgs)
-	stackData := make([]byte, 8+len(stackFrame))
+	stackData := make([]byte, 8+len(stackFrame)+len(f.RuntimeData))
 	binary.LittleEndian.PutUint64(stackData, uint64(len(stackFrame)))
 	copy(stackData[8:], stackFrame)
+	copy(stackData[8+len(stackFrame):], f.RuntimeData)
+
+	phnum := 6
+	if len(f.ImportVector) > 0 {
+		phnum++
+	}
+
+	entry := f.RuntimeEntry
+	if entry == 0 {
+		entry = f.RuntimeAddr
+	}
+
+	memoryMapSize := f.InitialMemorySize
+	if memoryMapSize == 0 {
+		memoryMapSize = maxMemorySize
+	}
 
 	var (
-		phnum           = 6
 		headersSize     = roundSize(64+56*phnum, pageSize)
 		runtimePageAddr = f.RuntimeAddr &^ (pageSize - 1)
 		runtimePadding  = int(f.RuntimeAddr - runtimePageAddr)
 		runtimeSize     = roundSize(runtimePadding+len(f.Runtime), pageSize)
 		runtimeOffset   = headersSize
+		vectorSize      = roundSize(len(f.ImportVector), pageSize)
+		vectorPadding   = vectorSize - len(f.ImportVector)
+		vectorOffset    = runtimeOffset + runtimeSize
 		textSize        = roundSize(len(f.Text), pageSize)
-		textOffset      = runtimeOffset + runtimeSize
+		textOffset      = vectorOffset + vectorSize
 		stackSize       = roundSize(len(stackData), pageSize)
 		stackOffset     = textOffset + textSize
 		globalsSize     = roundSize(f.MemoryOffset, pageSize)
@@ -58,8 +89,45 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		dataAddr        = memoryAddr - globalsSize
 		dataOffset      = stackOffset + stackSize
 		dataSize        = globalsSize + memorySize
+		symbolsOffset   = dataOffset + dataSize
 	)
 
+	// Non-allocated sections follow the segments.
+	sections := newSectionTable(symbolsOffset)
+
+	textIndex := sections.add(".text", elf.Section64{
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+		Addr:      textAddr,
+		Off:       uint64(textOffset),
+		Size:      uint64(len(f.Text)),
+		Addralign: 16,
+	})
+
+	if len(f.ImportVector) > 0 {
+		sections.add(".rodata", elf.Section64{
+			Type:      uint32(elf.SHT_PROGBITS),
+			Flags:     uint64(elf.SHF_ALLOC),
+			Addr:      uint64(textAddr - len(f.ImportVector)),
+			Off:       uint64(vectorOffset + vectorPadding),
+			Size:      uint64(len(f.ImportVector)),
+			Addralign: 8,
+		})
+	}
+
+	sections.add(".data", elf.Section64{
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_WRITE),
+		Addr:      uint64(dataAddr + globalsPadding),
+		Off:       uint64(dataOffset + globalsPadding),
+		Size:      uint64(len(f.GlobalsMemory)),
+		Addralign: 8,
+	})
+
+	sections.addSymbols(f.symbolInfo().symbols(textAddr, len(f.Text), textIndex))
+	sections.addDebug(f.DebugSections)
+	sectionHeadersOffset := sections.finish()
+
 	// File header
 	binary.Write(b, binary.LittleEndian, elf.Header64{
 		Ident: [elf.EI_NIDENT]byte{
@@ -74,18 +142,18 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		Type:      uint16(elf.ET_EXEC),
 		Machine:   uint16(elfMachine),
 		Version:   1,
-		Entry:     f.RuntimeAddr,
+		Entry:     entry,
 		Phoff:     64,
-		Shoff:     0,
+		Shoff:     uint64(sectionHeadersOffset),
 		Ehsize:    64,
 		Phentsize: 56,
 		Phnum:     uint16(phnum),
 		Shentsize: 64,
-		Shnum:     0,
-		Shstrndx:  0,
+		Shnum:     uint16(len(sections.headers)),
+		Shstrndx:  uint16(len(sections.headers) - 1),
 	})
 
-	// Program header #0
+	// Program header: program headers
 	writeBinaryArray(b, []interface{}{
 		uint32(elf.PT_PHDR),      // type
 		uint32(elf.PF_R),         // flags
@@ -97,7 +165,7 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		uint64(pageSize),         // align
 	})
 
-	// Program header #1: load headers
+	// Program header: load headers
 	writeBinaryArray(b, []interface{}{
 		uint32(elf.PT_LOAD), // type
 		uint32(elf.PF_R),    // flags
@@ -109,7 +177,7 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		uint64(pageSize),    // align
 	})
 
-	// Program header #2: load runtime
+	// Program header: load runtime
 	writeBinaryArray(b, []interface{}{
 		uint32(elf.PT_LOAD),         // type
 		uint32(elf.PF_R | elf.PF_X), // flags
@@ -121,7 +189,21 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		uint64(pageSize),            // align
 	})
 
-	// Program header #3: load text
+	// Program header: load import vector
+	if vectorSize > 0 {
+		writeBinaryArray(b, []interface{}{
+			uint32(elf.PT_LOAD),           // type
+			uint32(elf.PF_R),              // flags
+			uint64(vectorOffset),          // offset
+			uint64(textAddr - vectorSize), // vaddr
+			uint64(textAddr - vectorSize), // paddr
+			uint64(vectorSize),            // filesz
+			uint64(vectorSize),            // memsz
+			uint64(pageSize),              // align
+		})
+	}
+
+	// Program header: load text
 	writeBinaryArray(b, []interface{}{
 		uint32(elf.PT_LOAD),         // type
 		uint32(elf.PF_R | elf.PF_X), // flags
@@ -133,19 +215,19 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		uint64(pageSize),            // align
 	})
 
-	// Program header #4: stack entry frame contents
+	// Program header: stack entry frame contents and runtime data
 	writeBinaryArray(b, []interface{}{
-		uint32(elf.PT_LOAD), // type
-		uint32(elf.PF_R),    // flags
-		uint64(stackOffset), // offset
-		uint64(stackAddr),   // vaddr
-		uint64(stackAddr),   // paddr
-		uint64(stackSize),   // filesz
-		uint64(stackSize),   // memsz
-		uint64(pageSize),    // align
+		uint32(elf.PT_LOAD),         // type
+		uint32(elf.PF_R | elf.PF_W), // flags
+		uint64(stackOffset),         // offset
+		uint64(stackAddr),           // vaddr
+		uint64(stackAddr),           // paddr
+		uint64(stackSize),           // filesz
+		uint64(stackSize),           // memsz
+		uint64(pageSize),            // align
 	})
 
-	// Program header #5: load globals and linear memory data
+	// Program header: load globals and linear memory data
 	writeBinaryArray(b, []interface{}{
 		uint32(elf.PT_LOAD),                 // type
 		uint32(elf.PF_R | elf.PF_W),         // flags
@@ -153,7 +235,7 @@ func (f *File) writeTo(b *bytes.Buffer) {
 		uint64(dataAddr),                    // vaddr
 		uint64(dataAddr),                    // paddr
 		uint64(dataSize),                    // filesz
-		uint64(globalsSize + maxMemorySize), // memsz
+		uint64(globalsSize + memoryMapSize), // memsz
 		uint64(pageSize),                    // align
 	})
 
@@ -170,6 +252,15 @@ func (f *File) writeTo(b *bytes.Buffer) {
 
 	align(b, pageSize)
 
+	// Import vector
+	if b.Len() != vectorOffset {
+		panic(b.Len())
+	}
+	for i := 0; i < vectorPadding; i++ {
+		b.WriteByte(0)
+	}
+	b.Write(f.ImportVector)
+
 	// Text
 	if b.Len() != textOffset {
 		panic(b.Len())
@@ -196,6 +287,18 @@ func (f *File) writeTo(b *bytes.Buffer) {
 	b.Write(f.GlobalsMemory)
 
 	align(b, pageSize)
+
+	// Symbols, debug information and section headers
+	if b.Len() != symbolsOffset {
+		panic(b.Len())
+	}
+	if sections.writeTo(b) != sectionHeadersOffset {
+		panic(b.Len())
+	}
+}
+
+func (f *File) symbolInfo() symbolInfo {
+	return symbolInfo{f.FuncAddrs, f.NumImportFuncs, f.TrapAddrs, f.Names}
 }
 
 func writeBinaryArray(b *bytes.Buffer, fields []interface{}) {
@@ -17,6 +17,7 @@ import (
 	"testing"
 
 	"github.com/tsavola/wag/internal/test/runner"
+	"github.com/tsavola/wag/section"
 )
 
 var testGlobals = []byte{
@@ -39,6 +40,8 @@ func TestELF(t *testing.T) {
 		Text:          text,
 		GlobalsMemory: append(append([]byte{}, testGlobals...), testMemory...),
 		MemoryOffset:  len(testGlobals),
+		FuncAddrs:     []uint32{0},
+		Names:         &section.NameSection{FuncNames: []section.FuncName{{FuncName: "test"}}},
 	}
 
 	var buf bytes.Buffer
@@ -71,7 +74,18 @@ func TestELF(t *testing.T) {
 		t.Errorf("ImportedLibraries: %v", x)
 	}
 
-	if x, err := f.Symbols(); err == nil {
+	for _, name := range []string{".text", ".data", ".symtab", ".strtab"} {
+		if f.Section(name) == nil {
+			t.Errorf("section %s not found", name)
+		}
+	}
+	if x := f.Section(".text"); x != nil && (x.Addr != textAddr || x.Size != uint64(len(text))) {
+		t.Errorf(".text: %#v", x.SectionHeader)
+	}
+
+	if x, err := f.Symbols(); err != nil {
+		t.Error(err)
+	} else if len(x) != 1 || x[0].Name != "test" || x[0].Value != textAddr || x[0].Size != uint64(len(text)) || x[0].Section != 1 {
 		t.Errorf("Symbols: %v", x)
 	}
 
@@ -0,0 +1,272 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/object/abi"
+	"github.com/tsavola/wag/section"
+)
+
+// DefaultSymbolPrefix is used for the global symbols of a Relocatable file.
+const DefaultSymbolPrefix = "wag_"
+
+// Relocatable is an object file (ET_REL) which can be linked into a host
+// program using the system linker.  The wag.h header describes the symbols and
+// the ABI to C code.
+//
+// The import vector and the text are placed consecutively in the .text
+// section.  ImportVector lists the symbols which the vector slots refer to, in
+// memory order: the last one is the trap handler slot (vector index -1), which
+// is immediately before the text.  Empty names leave slots uninitialized.  The
+// slots are initialized with absolute address relocations, so the text section
+// gets relocations when linking a position-independent executable.
+//
+// Relocs are resolved as direct calls to ImportFuncSymbols (by import function
+// index).
+//
+// Global symbols are defined for the text address (prefix + "text"), the
+// resume, start and enter routines (e.g. "wag_enter"), and the export
+// functions (e.g. "wag_export_main").  Characters which are not valid in C
+// identifiers are replaced with underscores.  The globals and initial linear
+// memory contents, the entry stack frame, and their sizes are in .rodata.
+// Other functions and trap handlers get local symbols.
+type Relocatable struct {
+	SymbolPrefix      string   // Defaults to DefaultSymbolPrefix.
+	ImportVector      []string // Symbol names.
+	Text              []byte
+	Relocs            []object.Reloc
+	ImportFuncSymbols []string // Indexed by import function index.
+
+	FuncAddrs      []uint32             // Function addresses within text.
+	NumImportFuncs int                  // Leading FuncAddrs are import trampolines.
+	TrapAddrs      []uint32             // Trap handler addresses by trap ID.
+	Names          *section.NameSection // Function names.
+	ExportFuncs    map[string]uint32    // Function indexes by export name.
+
+	GlobalsMemory     []byte
+	MemoryOffset      int    // Size of globals.
+	InitialMemorySize int    // Accessible memory (excluding globals).
+	EntryFrame        []byte // Entry function address and arguments.
+}
+
+// WriteTo writes the contents of a relocatable object file.  An error is
+// returned if a relocation's import function doesn't have a symbol name, or if
+// multiple export functions map to the same symbol name.
+func (f *Relocatable) WriteTo(w io.Writer) (n int64, err error) {
+	var b bytes.Buffer
+	if err = f.writeTo(&b); err != nil {
+		return
+	}
+	m, err := w.Write(b.Bytes())
+	n = int64(m)
+	return
+}
+
+func (f *Relocatable) writeTo(b *bytes.Buffer) error {
+	prefix := f.SymbolPrefix
+	if prefix == "" {
+		prefix = DefaultSymbolPrefix
+	}
+
+	var (
+		vectorSize    = len(f.ImportVector) * 8
+		vectorPadding = roundSize(vectorSize, 16) - vectorSize
+		textOffset    = vectorPadding + vectorSize // Within section.
+	)
+
+	textData := make([]byte, textOffset+len(f.Text))
+	copy(textData[textOffset:], f.Text)
+
+	// Read-only data: sizes, entry frame, globals and memory.
+
+	var (
+		frameOffset   = 4 * 8
+		globalsOffset = roundSize(frameOffset+len(f.EntryFrame), 16)
+	)
+
+	rodata := make([]byte, globalsOffset+len(f.GlobalsMemory))
+	binary.LittleEndian.PutUint64(rodata[0:], uint64(len(f.GlobalsMemory)))
+	binary.LittleEndian.PutUint64(rodata[8:], uint64(f.MemoryOffset))
+	binary.LittleEndian.PutUint64(rodata[16:], uint64(f.InitialMemorySize))
+	binary.LittleEndian.PutUint64(rodata[24:], uint64(len(f.EntryFrame)))
+	copy(rodata[frameOffset:], f.EntryFrame)
+	copy(rodata[globalsOffset:], f.GlobalsMemory)
+
+	sections := newSectionTable(64)
+
+	textIndex := sections.addData(".text", elf.Section64{
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+		Addralign: 16,
+	}, textData)
+
+	rodataIndex := sections.addData(".rodata", elf.Section64{
+		Type:      uint32(elf.SHT_PROGBITS),
+		Flags:     uint64(elf.SHF_ALLOC),
+		Addralign: 16,
+	}, rodata)
+
+	// Symbols
+
+	symbols := newSymbolTable()
+
+	info := symbolInfo{f.FuncAddrs, f.NumImportFuncs, f.TrapAddrs, f.Names}
+	info.addTo(symbols, uint64(textOffset), len(f.Text), textIndex)
+	numLocal := len(symbols.syms)
+
+	addGlobal := func(name string, typ elf.SymType, shndx int, value, size int) {
+		symbols.add(prefix+name, elf.Sym64{
+			Info:  elf.ST_INFO(elf.STB_GLOBAL, typ),
+			Shndx: uint16(shndx),
+			Value: uint64(value),
+			Size:  uint64(size),
+		})
+	}
+
+	addGlobal("text", elf.STT_NOTYPE, textIndex, textOffset, 0)
+	addGlobal("resume", elf.STT_FUNC, textIndex, textOffset+abi.TextAddrResume, 0)
+	addGlobal("start", elf.STT_FUNC, textIndex, textOffset+abi.TextAddrStart, 0)
+	addGlobal("enter", elf.STT_FUNC, textIndex, textOffset+abi.TextAddrEnter, 0)
+
+	var exportNames []string
+	for name := range f.ExportFuncs {
+		exportNames = append(exportNames, name)
+	}
+	sort.Strings(exportNames)
+
+	exportSymbols := make(map[string]string)
+
+	for _, name := range exportNames {
+		if i := f.ExportFuncs[name]; int(i) < len(f.FuncAddrs) {
+			symbol := "export_" + cIdentifier(name)
+			if other, found := exportSymbols[symbol]; found {
+				return fmt.Errorf("export functions %q and %q have the same symbol name %s", other, name, prefix+symbol)
+			}
+			exportSymbols[symbol] = name
+
+			addGlobal(symbol, elf.STT_FUNC, textIndex, textOffset+int(f.FuncAddrs[i]), 0)
+		}
+	}
+
+	addGlobal("globals_memory_size", elf.STT_OBJECT, rodataIndex, 0, 8)
+	addGlobal("memory_offset", elf.STT_OBJECT, rodataIndex, 8, 8)
+	addGlobal("memory_size", elf.STT_OBJECT, rodataIndex, 16, 8)
+	addGlobal("entry_frame_size", elf.STT_OBJECT, rodataIndex, 24, 8)
+	addGlobal("entry_frame", elf.STT_OBJECT, rodataIndex, frameOffset, len(f.EntryFrame))
+	addGlobal("globals_memory", elf.STT_OBJECT, rodataIndex, globalsOffset, len(f.GlobalsMemory))
+
+	// Undefined symbols and relocations
+
+	undefined := make(map[string]uint32)
+
+	undefinedSymbol := func(name string) uint32 {
+		index, found := undefined[name]
+		if !found {
+			index = symbols.add(name, elf.Sym64{
+				Info: elf.ST_INFO(elf.STB_GLOBAL, elf.STT_NOTYPE),
+			})
+			undefined[name] = index
+		}
+		return index
+	}
+
+	var relocs []elf.Rela64
+
+	for i, name := range f.ImportVector {
+		if name != "" {
+			relocs = append(relocs, elf.Rela64{
+				Off:  uint64(vectorPadding + i*8),
+				Info: elf.R_INFO(undefinedSymbol(name), uint32(relocAbs64)),
+			})
+		}
+	}
+
+	for _, r := range f.Relocs {
+		if int(r.Import) >= len(f.ImportFuncSymbols) || f.ImportFuncSymbols[r.Import] == "" {
+			return fmt.Errorf("no symbol name for import function #%d", r.Import)
+		}
+
+		relocs = append(relocs, elf.Rela64{
+			Off:    uint64(textOffset + int(r.Addr) - 4),
+			Info:   elf.R_INFO(undefinedSymbol(f.ImportFuncSymbols[r.Import]), uint32(relocCall)),
+			Addend: relocCallAddend,
+		})
+	}
+
+	symtab, strtab := symbols.encode()
+	symtabIndex := sections.addSymbols(symtab, strtab, numLocal)
+
+	if len(relocs) > 0 {
+		var rela bytes.Buffer
+		binary.Write(&rela, binary.LittleEndian, relocs)
+
+		sections.addData(".rela.text", elf.Section64{
+			Type:      uint32(elf.SHT_RELA),
+			Flags:     uint64(elf.SHF_INFO_LINK),
+			Link:      uint32(symtabIndex),
+			Info:      uint32(textIndex),
+			Addralign: 8,
+			Entsize:   24,
+		}, rela.Bytes())
+	}
+
+	// Non-executable stack.
+	sections.addData(".note.GNU-stack", elf.Section64{
+		Type:      uint32(elf.SHT_PROGBITS),
+		Addralign: 1,
+	}, nil)
+
+	sectionHeadersOffset := sections.finish()
+
+	// File header
+	binary.Write(b, binary.LittleEndian, elf.Header64{
+		Ident: [elf.EI_NIDENT]byte{
+			0:              0x7f,
+			1:              'E',
+			2:              'L',
+			3:              'F',
+			elf.EI_CLASS:   byte(elf.ELFCLASS64),
+			elf.EI_DATA:    byte(elf.ELFDATA2LSB),
+			elf.EI_VERSION: 1,
+		},
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(elfMachine),
+		Version:   1,
+		Shoff:     uint64(sectionHeadersOffset),
+		Ehsize:    64,
+		Shentsize: 64,
+		Shnum:     uint16(len(sections.headers)),
+		Shstrndx:  uint16(len(sections.headers) - 1),
+	})
+
+	// Section contents and headers
+	if sections.writeTo(b) != sectionHeadersOffset {
+		panic(b.Len())
+	}
+
+	return nil
+}
+
+// cIdentifier replaces characters which are not valid in C identifiers.
+func cIdentifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !wagamd64,!wagarm64
+
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/wa"
+)
+
+// testRelocModule imports add(i32, i32) i32 and twice(i32) i32 from env, and
+// exports main() i32 which returns twice(add(load(0), 2)).  The initial memory
+// contains 19 at address 0.
+const testRelocModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x10\x03\x60\x02\x7f\x7f\x01\x7f\x60\x01\x7f\x01\x7f\x60\x00\x01\x7f\x02\x17\x02\x03\x65\x6e\x76\x03\x61\x64\x64\x00\x00\x03\x65\x6e\x76\x05\x74\x77\x69\x63\x65\x00\x01\x03\x02\x01\x02\x05\x03\x01\x00\x01\x07\x08\x01\x04\x6d\x61\x69\x6e\x00\x02\x0a\x0f\x01\x0d\x00\x41\x00\x28\x02\x00\x41\x02\x10\x00\x10\x01\x0b\x0b\x0a\x01\x00\x41\x00\x0b\x04\x13\x00\x00\x00"
+
+// testRelocResolver binds add via the import vector, and twice directly to an
+// absolute native address.
+type testRelocResolver struct{}
+
+func (testRelocResolver) ResolveFunc(module, field string, sig wa.FuncType) (int, error) {
+	if module == "env" && field == "add" {
+		return binding.VectorIndexLastImport, nil
+	}
+	return 0, &binding.NotFoundError{Module: module, Field: field}
+}
+
+func (testRelocResolver) ResolveGlobal(module, field string, t wa.Type) (uint64, error) {
+	return 0, &binding.NotFoundError{Module: module, Field: field, Global: true}
+}
+
+func (testRelocResolver) ResolveNativeFunc(module, field string, sig wa.FuncType) (addr binding.NativeAddr, found bool, err error) {
+	if module == "env" && field == "twice" {
+		addr.Addr = 0x1000 // Placeholder.
+		found = true
+	}
+	return
+}
+
+func TestRelocatable(t *testing.T) {
+	obj, err := wag.Compile(&wag.Config{Entry: "main"}, strings.NewReader(testRelocModule), testRelocResolver{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obj.Relocs) == 0 {
+		t.Fatal("no relocations")
+	}
+
+	exports := make(map[string]uint32)
+	for name, f := range obj.ExportFuncs {
+		exports[name] = f.Index
+	}
+
+	rf := &Relocatable{
+		ImportVector:      []string{"host_add", "host_current_memory", "host_grow_memory", "host_trap"},
+		Text:              obj.Text,
+		Relocs:            obj.Relocs,
+		ImportFuncSymbols: []string{"", "host_twice"},
+		FuncAddrs:         obj.FuncAddrs,
+		NumImportFuncs:    obj.NumImportFuncs,
+		TrapAddrs:         obj.TrapAddrs,
+		Names:             &obj.Names,
+		ExportFuncs:       exports,
+		GlobalsMemory:     obj.GlobalsMemory,
+		MemoryOffset:      obj.MemoryOffset,
+		InitialMemorySize: obj.InitialMemorySize,
+		EntryFrame:        obj.StackFrame,
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := rf.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if f.Type != elf.ET_REL {
+		t.Errorf("type: %v", f.Type)
+	}
+
+	syms, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	globals := make(map[string]elf.Symbol)
+	for _, sym := range syms {
+		if elf.ST_BIND(sym.Info) == elf.STB_GLOBAL {
+			globals[sym.Name] = sym
+		}
+	}
+
+	text := globals["wag_text"]
+	if main, found := globals["wag_export_main"]; !found || main.Value-text.Value != uint64(obj.FuncAddrs[2]) {
+		t.Errorf("export symbol: %v", main)
+	}
+	for _, name := range []string{"host_add", "host_twice", "host_trap", "wag_entry_frame", "wag_globals_memory"} {
+		if _, found := globals[name]; !found {
+			t.Errorf("symbol %s not found", name)
+		}
+	}
+
+	if s := f.Section(".rela.text"); s == nil || s.Size != uint64(24*(len(rf.ImportVector)+len(obj.Relocs))) {
+		t.Errorf("relocation section: %v", s)
+	}
+
+	t.Run("Collision", func(t *testing.T) {
+		colliding := *rf
+		colliding.ExportFuncs = map[string]uint32{"a-b": 2, "a_b": 2}
+
+		if _, err := colliding.WriteTo(ioutil.Discard); err == nil {
+			t.Error("export symbol collision was not detected")
+		} else {
+			t.Log(err)
+		}
+	})
+
+	t.Run("Link", func(t *testing.T) {
+		if runtime.GOARCH != "amd64" {
+			t.Skip("host program is implemented for amd64")
+		}
+
+		cc, err := exec.LookPath("cc")
+		if err != nil {
+			t.Skip(err)
+		}
+
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		var (
+			objFile = filepath.Join(dir, "wag.o")
+			exeFile = filepath.Join(dir, "host")
+		)
+
+		if err := ioutil.WriteFile(objFile, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if output, err := exec.Command(cc, "-no-pie", "-o", exeFile, "testdata/host.c", objFile).CombinedOutput(); err != nil {
+			t.Fatalf("%v: %s", err, output)
+		}
+
+		output, err := exec.Command(exeFile).CombinedOutput()
+		if err != nil {
+			t.Fatalf("%v: %s", err, output)
+		}
+		if s := string(output); s != "0 42\n" {
+			t.Errorf("output: %q", s)
+		}
+	})
+}
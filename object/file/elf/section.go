@@ -0,0 +1,252 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsavola/wag/object/abi"
+	"github.com/tsavola/wag/section"
+	"github.com/tsavola/wag/trap"
+)
+
+// sectionTable builds section headers.  The contents of sections added with
+// addData (e.g. non-allocated sections) are written after the other file
+// contents, followed by the section headers.
+type sectionTable struct {
+	headers    []elf.Section64
+	names      stringTable
+	shstrtab   []byte
+	dataOffset int
+	data       [][]byte
+}
+
+func newSectionTable(dataOffset int) *sectionTable {
+	return &sectionTable{
+		headers:    []elf.Section64{{}},
+		names:      stringTable{"": 0},
+		shstrtab:   []byte{0},
+		dataOffset: dataOffset,
+	}
+}
+
+func (t *sectionTable) add(name string, h elf.Section64) int {
+	h.Name = t.names.add(&t.shstrtab, name)
+	t.headers = append(t.headers, h)
+	return len(t.headers) - 1
+}
+
+// addData adds a section the contents of which are written after the other
+// file contents.  The file offset is aligned according to Addralign.
+func (t *sectionTable) addData(name string, h elf.Section64, data []byte) int {
+	if h.Addralign > 1 {
+		if n := roundSize(t.dataOffset, int(h.Addralign)) - t.dataOffset; n > 0 {
+			t.data = append(t.data, make([]byte, n))
+			t.dataOffset += n
+		}
+	}
+
+	h.Off = uint64(t.dataOffset)
+	h.Size = uint64(len(data))
+	t.dataOffset += len(data)
+	t.data = append(t.data, data)
+	return t.add(name, h)
+}
+
+// addSymbols adds the symbol table and its string table, unless they are
+// empty.  The local symbols must precede the others.
+func (t *sectionTable) addSymbols(symtab, strtab []byte, numLocal int) (symtabIndex int) {
+	if len(symtab) == 0 {
+		return
+	}
+
+	symtabIndex = t.addData(".symtab", elf.Section64{
+		Type:      uint32(elf.SHT_SYMTAB),
+		Link:      uint32(len(t.headers) + 1), // .strtab
+		Info:      uint32(numLocal),
+		Addralign: 8,
+		Entsize:   24,
+	}, symtab)
+
+	t.addData(".strtab", elf.Section64{
+		Type:      uint32(elf.SHT_STRTAB),
+		Addralign: 1,
+	}, strtab)
+	return
+}
+
+// addDebug adds debug information sections (such as .debug_line) in name
+// order.
+func (t *sectionTable) addDebug(sections map[string][]byte) {
+	var names []string
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t.addData(name, elf.Section64{
+			Type:      uint32(elf.SHT_PROGBITS),
+			Addralign: 1,
+		}, sections[name])
+	}
+}
+
+// finish adds the section name table as the last section.  It returns the
+// file offset of the section headers.
+func (t *sectionTable) finish() (headersOffset int) {
+	t.names.add(&t.shstrtab, ".shstrtab") // Before size is known.
+
+	t.addData(".shstrtab", elf.Section64{
+		Type:      uint32(elf.SHT_STRTAB),
+		Addralign: 1,
+	}, t.shstrtab)
+
+	return roundSize(t.dataOffset, 8)
+}
+
+// writeTo writes the contents of the sections added with addData, and the
+// section headers.
+// It returns the file offset of the section headers.
+func (t *sectionTable) writeTo(b *bytes.Buffer) (headersOffset int) {
+	for _, data := range t.data {
+		b.Write(data)
+	}
+
+	align(b, 8)
+
+	headersOffset = b.Len()
+	binary.Write(b, binary.LittleEndian, t.headers)
+	return
+}
+
+// symbolInfo describes the routines and functions located in text.
+type symbolInfo struct {
+	funcAddrs      []uint32
+	numImportFuncs int
+	trapAddrs      []uint32
+	names          *section.NameSection
+}
+
+type symbol struct {
+	name string
+	addr uint32
+	fn   bool
+}
+
+// symbols encodes the symbol table and its string table.  They are empty if
+// there is no symbol information.  All symbols are local.
+func (info symbolInfo) symbols(textAddr uint64, textSize int, textIndex int) (symtab, strtab []byte, numLocal int) {
+	t := newSymbolTable()
+	info.addTo(t, textAddr, textSize, textIndex)
+	if len(t.syms) > 1 {
+		symtab, strtab = t.encode()
+		numLocal = len(t.syms)
+	}
+	return
+}
+
+// addTo adds local function symbols in address order.
+func (info symbolInfo) addTo(t *symbolTable, textAddr uint64, textSize int, textIndex int) {
+	var syms []symbol
+
+	if len(info.trapAddrs) > 0 {
+		syms = append(syms,
+			symbol{"resume", abi.TextAddrResume, true},
+			symbol{"start", abi.TextAddrStart, true},
+			symbol{"enter", abi.TextAddrEnter, true},
+		)
+
+		for id, addr := range info.trapAddrs {
+			if trap.ID(id) != trap.Exit {
+				name := strings.Replace(trap.ID(id).String(), " ", "_", -1)
+				syms = append(syms, symbol{"trap." + name, addr, true})
+			}
+		}
+	}
+
+	for i, addr := range info.funcAddrs {
+		syms = append(syms, symbol{info.funcName(i), addr, true})
+	}
+
+	sort.SliceStable(syms, func(i, j int) bool {
+		return syms[i].addr < syms[j].addr
+	})
+
+	for i, sym := range syms {
+		end := uint32(textSize)
+		for _, next := range syms[i+1:] {
+			if next.addr > sym.addr {
+				end = next.addr
+				break
+			}
+		}
+
+		t.add(sym.name, elf.Sym64{
+			Info:  elf.ST_INFO(elf.STB_LOCAL, elf.STT_FUNC),
+			Shndx: uint16(textIndex),
+			Value: textAddr + uint64(sym.addr),
+			Size:  uint64(end - sym.addr),
+		})
+	}
+}
+
+func (info symbolInfo) funcName(i int) (name string) {
+	if info.names != nil && i < len(info.names.FuncNames) {
+		name = info.names.FuncNames[i].FuncName
+	}
+	if name == "" {
+		name = fmt.Sprintf("func.%d", i)
+	}
+	if i < info.numImportFuncs {
+		name = "import." + name
+	}
+	return
+}
+
+// symbolTable builds a symbol table and its string table.
+type symbolTable struct {
+	syms   []elf.Sym64
+	names  stringTable
+	strtab []byte
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{
+		syms:   []elf.Sym64{{}},
+		names:  stringTable{"": 0},
+		strtab: []byte{0},
+	}
+}
+
+func (t *symbolTable) add(name string, sym elf.Sym64) (index uint32) {
+	sym.Name = t.names.add(&t.strtab, name)
+	t.syms = append(t.syms, sym)
+	return uint32(len(t.syms) - 1)
+}
+
+func (t *symbolTable) encode() (symtab, strtab []byte) {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, t.syms)
+	return b.Bytes(), t.strtab
+}
+
+// stringTable maps strings to their offsets in an ELF string table.
+type stringTable map[string]uint32
+
+func (t stringTable) add(buf *[]byte, s string) uint32 {
+	offset, found := t[s]
+	if !found {
+		offset = uint32(len(*buf))
+		*buf = append(append(*buf, s...), 0)
+		t[s] = offset
+	}
+	return offset
+}
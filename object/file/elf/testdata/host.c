@@ -0,0 +1,124 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Host program for TestRelocatable (x86-64).  Prints the trap ID and the
+// result of the entry function.
+
+#include <stdint.h>
+#include <stdio.h>
+#include <string.h>
+
+#include <sys/mman.h>
+
+#include "../wag.h"
+
+WAG_EXPORT(main);
+
+#define PAGE_SIZE 4096
+#define STACK_SIZE 65536
+#define STACK_RESERVE 8192
+
+uint64_t host_run(const char *text, char *memory, char *stack_limit, char *stack_ptr, const char *routine);
+
+// host_run saves the callee-saved registers and enters the program.  The trap
+// handler restores them and returns from host_run.  The import functions
+// follow the wag ABI.
+__asm__(
+	"	.text\n"
+	"	.globl host_run\n"
+	"host_run:\n"
+	"	push %rbx\n"
+	"	push %rbp\n"
+	"	push %r12\n"
+	"	push %r13\n"
+	"	push %r14\n"
+	"	push %r15\n"
+	"	mov %rsp, host_saved_sp(%rip)\n"
+	"	mov %rdi, %r15\n"
+	"	mov %rsi, %r14\n"
+	"	mov %rdx, %rbx\n"
+	"	mov %rcx, %rsp\n"
+	"	xor %eax, %eax\n"
+	"	xor %ecx, %ecx\n"
+	"	xor %edx, %edx\n"
+	"	xor %ebp, %ebp\n"
+	"	xor %esi, %esi\n"
+	"	xor %edi, %edi\n"
+	"	xor %r9d, %r9d\n"
+	"	xor %r10d, %r10d\n"
+	"	xor %r11d, %r11d\n"
+	"	xor %r12d, %r12d\n"
+	"	xor %r13d, %r13d\n"
+	"	jmp *%r8\n"
+	"\n"
+	"	.globl host_trap\n"
+	"host_trap:\n"
+	"	mov host_saved_sp(%rip), %rsp\n"
+	"	pop %r15\n"
+	"	pop %r14\n"
+	"	pop %r13\n"
+	"	pop %r12\n"
+	"	pop %rbp\n"
+	"	pop %rbx\n"
+	"	ret\n"
+	"\n"
+	"	.globl host_add\n"
+	"host_add:\n"
+	"	mov 16(%rsp), %eax\n"
+	"	add 8(%rsp), %eax\n"
+	"	lea 16(%r15), %rdx\n"
+	"	jmp *%rdx\n"
+	"\n"
+	"	.globl host_twice\n"
+	"host_twice:\n"
+	"	mov 8(%rsp), %eax\n"
+	"	add %eax, %eax\n"
+	"	lea 16(%r15), %rdx\n"
+	"	jmp *%rdx\n"
+	"\n"
+	"	.globl host_current_memory\n"
+	"host_current_memory:\n"
+	"	mov $1, %eax\n"
+	"	lea 16(%r15), %rdx\n"
+	"	jmp *%rdx\n"
+	"\n"
+	"	.globl host_grow_memory\n"
+	"host_grow_memory:\n"
+	"	mov $-1, %eax\n"
+	"	lea 16(%r15), %rdx\n"
+	"	jmp *%rdx\n"
+	"\n"
+	"	.data\n"
+	"host_saved_sp:\n"
+	"	.quad 0\n"
+	"	.text\n");
+
+static char stack[STACK_SIZE] __attribute__((aligned(PAGE_SIZE)));
+
+int main(void)
+{
+	if (WAG_ENTRY_FRAME_SIZE != 8 || WAG_ENTRY_FRAME[0] != WAG_EXPORT_ADDR(main)) {
+		fprintf(stderr, "unexpected entry frame\n");
+		return 1;
+	}
+
+	size_t globals_size = (WAG_MEMORY_OFFSET + PAGE_SIZE - 1) & ~(PAGE_SIZE - 1);
+
+	char *mem = mmap(NULL, globals_size + WAG_MEMORY_SIZE, PROT_READ | PROT_WRITE, MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+	if (mem == MAP_FAILED) {
+		perror("mmap");
+		return 1;
+	}
+
+	char *memory = mem + globals_size;
+	memcpy(memory - WAG_MEMORY_OFFSET, WAG_GLOBALS_MEMORY, WAG_GLOBALS_MEMORY_SIZE);
+
+	char *stack_ptr = stack + STACK_SIZE - WAG_ENTRY_FRAME_SIZE;
+	memcpy(stack_ptr, WAG_ENTRY_FRAME, WAG_ENTRY_FRAME_SIZE);
+
+	uint64_t result = host_run(WAG_TEXT, memory, stack + STACK_RESERVE, stack_ptr, WAG_ENTER);
+
+	printf("%u %u\n", (uint32_t) result, (uint32_t) (result >> 32));
+	return 0;
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Interface to a WebAssembly program which has been compiled with wag and
+// written as a relocatable object file (elf.Relocatable), for C host programs.
+//
+// Define WAG_PREFIX before including this header if the object was written
+// with a non-default symbol prefix.  Export functions are declared by the host
+// program using WAG_EXPORT(name).
+//
+// The generated code doesn't follow the C calling convention; it must be
+// entered and exited via assembly routines.  Register usage on x86-64:
+//
+//   r15  text base
+//   r14  memory base
+//   rbx  stack limit
+//   rsp  stack pointer
+//   rdx  zero
+//   rax  result
+//   rcx  scratch
+//   rbp  variadic import function argument count and signature index
+//
+// (ARM64 support is incomplete; see cmd/wasys/exec_arm64.s for its
+// conventions.)
+//
+// The text base is the address of WAG_TEXT.  The memory base is the start of
+// linear memory; the globals are located immediately before it (see
+// WAG_MEMORY_OFFSET).  The globals and linear memory are initialized by
+// copying WAG_GLOBALS_MEMORY so that the first WAG_MEMORY_OFFSET bytes end up
+// below the memory base.  Memory must be accessible up to WAG_MEMORY_SIZE, and
+// inaccessible beyond the current size up to the maximum addressable range
+// (4 GB index plus 2 GB offset, unless explicit bounds checks were enabled).
+//
+// Stack layout (from smaller to larger address):
+//
+//   0. 16 bytes for variables (current memory pages; 4 bytes).
+//   1. Signal stack (size must be multiple of 16 bytes).
+//   2. 128 bytes for use by trap handler and import function implementations.
+//   3. 16 bytes for function call and stack check trap handler call.
+//   4. Call stack (size must be multiple of 8 bytes).
+//   5. Entry function address (text offset; 8 bytes).
+//   6. Entry function arguments (8 bytes each; the first one is at the highest
+//      address).
+//
+// The stack limit is the address between 3 and 4.  Setting rbx to
+// 0x7fffffffffffffff (asynchronously) requests suspension: the program traps
+// with WAG_TRAP_SUSPENDED at the next function call or loop iteration.
+//
+// WAG_ENTRY_FRAME contains items 5 and 6 for the entry function which was
+// chosen during compilation (if any); it should be copied to the top of the
+// stack.  Alternatively, the host may form the frame for an export function
+// using its offset from WAG_TEXT.
+//
+// Execution is started by pointing the stack pointer at item 5 and jumping to
+// WAG_ENTER (or WAG_START, which also calls the start function).  The entry
+// function's address and the arguments are popped from the stack.  Other
+// general-purpose registers should be zeroed so that host data doesn't leak
+// to the program.
+//
+// The program finishes by jumping to the trap handler (the last import vector
+// slot).  The result register contains the trap ID in the low 32 bits.  If the
+// ID is WAG_TRAP_EXIT, the high 32 bits contain the entry function's result.
+// The stack pointer is left as it was at the trap location; the trap handler
+// doesn't return.  A program which has been stopped with a recoverable trap
+// (e.g. WAG_TRAP_CALL_STACK_EXHAUSTED after the stack limit was adjusted) may
+// be resumed by jumping to WAG_RESUME with the same stack pointer.
+//
+// Import functions are invoked via the import vector with the return address
+// on top of the stack, followed by the arguments (8 bytes each; the last one
+// is closest to the return address).  The result is returned in the result
+// register.  Import functions (and the current memory and grow memory
+// routines) may clobber registers other than the text base, memory base, stack
+// limit and stack pointer.  They return by jumping to WAG_RESUME, which zeroes
+// the zero register and returns to the caller.
+//
+// The grow memory routine receives the increment (in pages) in the result
+// register, and returns the previous memory size in pages, or -1 if memory
+// could not be grown.  The current memory routine returns the memory size in
+// pages.
+
+#ifndef WAG_H
+#define WAG_H
+
+#include <stdint.h>
+
+#ifndef WAG_PREFIX
+#define WAG_PREFIX wag_
+#endif
+
+#define WAG_CONCAT_(a, b) a##b
+#define WAG_CONCAT(a, b) WAG_CONCAT_(a, b)
+#define WAG_SYMBOL(name) WAG_CONCAT(WAG_PREFIX, name)
+
+// Routine offsets within text.
+#define WAG_TEXT_ADDR_NO_FUNCTION 0x00
+#define WAG_TEXT_ADDR_RESUME 0x10
+#define WAG_TEXT_ADDR_START 0x20
+#define WAG_TEXT_ADDR_ENTER 0x30
+
+// Well-known import vector indexes.  The vector is located immediately before
+// text; index -1 is the last slot.  Import function slots precede these.
+#define WAG_VECTOR_INDEX_LAST_IMPORT -4
+#define WAG_VECTOR_INDEX_CURRENT_MEMORY -3
+#define WAG_VECTOR_INDEX_GROW_MEMORY -2
+#define WAG_VECTOR_INDEX_TRAP_HANDLER -1
+
+#define WAG_PAGE_SIZE 65536
+
+enum wag_trap {
+	WAG_TRAP_EXIT = 0,
+	WAG_TRAP_NO_FUNCTION = 1,
+	WAG_TRAP_SUSPENDED = 2,
+	WAG_TRAP_UNREACHABLE = 3,
+	WAG_TRAP_CALL_STACK_EXHAUSTED = 4,
+	WAG_TRAP_MEMORY_ACCESS_OUT_OF_BOUNDS = 5,
+	WAG_TRAP_INDIRECT_CALL_INDEX_OUT_OF_BOUNDS = 6,
+	WAG_TRAP_INDIRECT_CALL_SIGNATURE_MISMATCH = 7,
+	WAG_TRAP_INTEGER_DIVIDE_BY_ZERO = 8,
+	WAG_TRAP_INTEGER_OVERFLOW = 9,
+};
+
+// Text routines.  They must not be called using the C calling convention.
+extern const char WAG_SYMBOL(text)[];
+extern const char WAG_SYMBOL(resume)[];
+extern const char WAG_SYMBOL(start)[];
+extern const char WAG_SYMBOL(enter)[];
+
+#define WAG_TEXT WAG_SYMBOL(text)
+#define WAG_RESUME WAG_SYMBOL(resume)
+#define WAG_START WAG_SYMBOL(start)
+#define WAG_ENTER WAG_SYMBOL(enter)
+
+// WAG_EXPORT(name) declares an export function at file scope, and
+// WAG_EXPORT_ADDR(name) is its address for an entry stack frame.  Characters
+// which are not valid in C identifiers are replaced with underscores in export
+// names.
+#define WAG_EXPORT(name) extern const char WAG_CONCAT(WAG_SYMBOL(export_), name)[]
+#define WAG_EXPORT_ADDR(name) ((uint64_t) (WAG_CONCAT(WAG_SYMBOL(export_), name) - WAG_TEXT))
+
+// Initial contents of globals and linear memory.
+extern const uint64_t WAG_SYMBOL(globals_memory_size);
+extern const uint64_t WAG_SYMBOL(memory_offset);
+extern const uint64_t WAG_SYMBOL(memory_size);
+extern const unsigned char WAG_SYMBOL(globals_memory)[];
+
+#define WAG_GLOBALS_MEMORY_SIZE WAG_SYMBOL(globals_memory_size)
+#define WAG_MEMORY_OFFSET WAG_SYMBOL(memory_offset)
+#define WAG_MEMORY_SIZE WAG_SYMBOL(memory_size)
+#define WAG_GLOBALS_MEMORY WAG_SYMBOL(globals_memory)
+
+// Stack frame for the entry function (items 5 and 6 of the stack layout).
+extern const uint64_t WAG_SYMBOL(entry_frame_size);
+extern const uint64_t WAG_SYMBOL(entry_frame)[];
+
+#define WAG_ENTRY_FRAME_SIZE WAG_SYMBOL(entry_frame_size)
+#define WAG_ENTRY_FRAME WAG_SYMBOL(entry_frame)
+
+#endif
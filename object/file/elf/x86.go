@@ -10,4 +10,10 @@ import (
 	"debug/elf"
 )
 
-const elfMachine = elf.EM_X86_64
+const (
+	elfMachine = elf.EM_X86_64
+
+	relocAbs64      = elf.R_X86_64_64
+	relocCall       = elf.R_X86_64_PLT32
+	relocCallAddend = -4 // Displacement is relative to the next instruction.
+)
@@ -4,13 +4,30 @@
 
 package internal
 
+import (
+	"github.com/tsavola/wag/section"
+)
+
 // File represents a standalone executable program.
 type File struct {
-	Runtime       []byte
-	RuntimeAddr   uint64
-	EntryAddr     uint32
-	EntryArgs     []uint64
-	Text          []byte
-	GlobalsMemory []byte
-	MemoryOffset  int
+	Runtime           []byte
+	RuntimeAddr       uint64
+	RuntimeEntry      uint64 // Defaults to RuntimeAddr.
+	EntryAddr         uint32
+	EntryArgs         []uint64
+	ImportVector      []byte // Mapped immediately before text.
+	Text              []byte
+	GlobalsMemory     []byte
+	MemoryOffset      int
+	InitialMemorySize int    // Accessible memory; maximum if zero.
+	RuntimeData       []byte // Writable; follows the stack frame data.
+
+	// Optional symbol information.
+	FuncAddrs      []uint32             // Function addresses within text.
+	NumImportFuncs int                  // Leading FuncAddrs are import trampolines.
+	TrapAddrs      []uint32             // Trap handler addresses by trap ID.
+	Names          *section.NameSection // Function names.
+
+	// Optional debug information sections, such as .debug_line.
+	DebugSections map[string][]byte
 }
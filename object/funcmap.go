@@ -7,15 +7,22 @@ package object
 import (
 	"math"
 	"sort"
+
+	"github.com/tsavola/wag/trap"
 )
 
 // FuncMap implements compile.ObjectMapper.  It stores all function addresses,
 // but no call or instruction information.
 //
 // FuncAddrs may be preallocated by initializing the field with a non-nil,
-// empty array.
+// empty array.  The first NumImportFuncs addresses are those of the import
+// function trampolines.  TrapAddrs is indexed by trap ID.  Relocs is populated
+// only if import functions are bound to absolute native addresses.
 type FuncMap struct {
-	FuncAddrs []uint32
+	FuncAddrs      []uint32
+	NumImportFuncs int
+	TrapAddrs      []uint32
+	Relocs         []Reloc
 }
 
 func (m *FuncMap) InitObjectMap(numImportFuncs, numOtherFuncs int) {
@@ -26,12 +33,25 @@ func (m *FuncMap) InitObjectMap(numImportFuncs, numOtherFuncs int) {
 	if num := numImportFuncs + numOtherFuncs; cap(m.FuncAddrs) < num {
 		m.FuncAddrs = make([]uint32, 0, num)
 	}
+
+	m.NumImportFuncs = numImportFuncs
 }
 
 func (m *FuncMap) PutImportFuncAddr(addr uint32) {
 	m.PutFuncAddr(addr)
 }
 
+func (m *FuncMap) PutImportReloc(addr uint32, importIndex int, target uint64) {
+	m.Relocs = append(m.Relocs, Reloc{addr, uint32(importIndex), target})
+}
+
+func (m *FuncMap) PutTrapAddr(id trap.ID, addr uint32) {
+	if m.TrapAddrs == nil {
+		m.TrapAddrs = make([]uint32, trap.NumTraps)
+	}
+	m.TrapAddrs[id] = addr
+}
+
 func (m *FuncMap) PutFuncAddr(addr uint32) {
 	m.FuncAddrs = append(m.FuncAddrs, addr)
 }
@@ -70,3 +90,24 @@ func (m FuncMap) FindAddr(retAddr uint32) (funcIndex, _, _ uint32, _ int32, init
 	}
 	return
 }
+
+// FindCall finds the function which is called by the direct call instruction
+// which precedes retAddr.  Import functions are identified by their
+// trampolines, so their indexes are below the number of import functions.
+// callAddr is the address of the call instruction.
+func (m FuncMap) FindCall(text []byte, retAddr uint32) (funcIndex int, callAddr uint32, ok bool) {
+	callAddr, target, ok := callTarget(text, retAddr)
+	if !ok {
+		return
+	}
+
+	for i, addr := range m.FuncAddrs {
+		if addr == target {
+			funcIndex = i
+			return
+		}
+	}
+
+	ok = false
+	return
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package object_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+)
+
+// Imports env.f() i32 and calls it twice from main.
+const testNativeModule = "\x00\x61\x73\x6d\x01\x00\x00\x00\x01\x05\x01\x60\x00\x01\x7f\x02\x09\x01\x03\x65\x6e\x76\x01\x66\x00\x00\x03\x02\x01\x00\x07\x08\x01\x04\x6d\x61\x69\x6e\x00\x01\x0a\x09\x01\x07\x00\x10\x00\x1a\x10\x00\x0b"
+
+func TestFindCallLazy(t *testing.T) {
+	lazy := &binding.Lazy{NextVectorIndex: binding.VectorIndexLastImport}
+
+	obj, err := wag.Compile(nil, strings.NewReader(testNativeModule), lazy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(lazy.Funcs) != 1 || lazy.Funcs[0].Field != "f" || lazy.Funcs[0].VectorIndex != binding.VectorIndexLastImport {
+		t.Fatal(lazy.Funcs)
+	}
+
+	var found int
+
+	for _, site := range obj.CallSites {
+		funcIndex, callAddr, ok := obj.FindCall(obj.Text, site.RetAddr)
+		if !ok || funcIndex != 0 {
+			continue
+		}
+		if callAddr >= site.RetAddr || callAddr < obj.FuncAddrs[1] {
+			t.Errorf("call site 0x%x: call address 0x%x", site.RetAddr, callAddr)
+		}
+		found++
+	}
+
+	if found != 2 {
+		t.Errorf("%d calls to import function found", found)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package compact implements delta-encoded record sequences with a sparse
+// index.
+package compact
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// BlockLen is the number of records per index entry.
+const BlockLen = 32
+
+// Block is an index entry.
+type Block struct {
+	Key    uint32 // Key of the first record.
+	Offset uint32 // Data offset of the first record.
+}
+
+// Seq is a sequence of records sorted by key.  Each record consists of a key
+// and a fixed number of signed values.  Keys are encoded as unsigned deltas
+// and values as signed deltas, using variable-length integers.  Delta
+// encoding restarts at each block.
+type Seq struct {
+	Len    int
+	Blocks []Block
+	Data   []byte
+}
+
+// Size of the encoded representation in bytes.
+func (s *Seq) Size() int {
+	return len(s.Blocks)*8 + len(s.Data)
+}
+
+// Builder appends records to a sequence.
+type Builder struct {
+	Seq
+	key  uint32
+	prev []int64
+}
+
+// Append a record.  The key must not be less than the previous one, and the
+// number of values must be the same for all records.
+func (b *Builder) Append(key uint32, values ...int64) {
+	if b.prev == nil {
+		b.prev = make([]int64, len(values))
+	}
+
+	if b.Len%BlockLen == 0 {
+		b.Blocks = append(b.Blocks, Block{key, uint32(len(b.Data))})
+		b.key = key
+		for i := range b.prev {
+			b.prev[i] = 0
+		}
+	}
+
+	var tmp [binary.MaxVarintLen64]byte
+
+	b.Data = append(b.Data, tmp[:binary.PutUvarint(tmp[:], uint64(key-b.key))]...)
+	b.key = key
+
+	for i, x := range values {
+		b.Data = append(b.Data, tmp[:binary.PutVarint(tmp[:], x-b.prev[i])]...)
+		b.prev[i] = x
+	}
+
+	b.Len++
+}
+
+// Get the record at the given index.  The values slice receives the values.
+func (s *Seq) Get(index int, values []int64) (key uint32) {
+	r := s.block(index/BlockLen, values)
+	for i := index % BlockLen; i >= 0; i-- {
+		r.next(values)
+	}
+	return r.key
+}
+
+// Search for the first record with a key which is greater than or equal to
+// the given key.  The values slice receives its values.  Len is returned as
+// the index if there is no such record.
+func (s *Seq) Search(key uint32, values []int64) (index int, recordKey uint32) {
+	// Records with equal keys may straddle a block boundary, so start from
+	// the block preceding the first one which may contain the key.
+	b := sort.Search(len(s.Blocks), func(i int) bool {
+		return s.Blocks[i].Key >= key
+	}) - 1
+	if b < 0 {
+		b = 0
+	}
+
+	for ; b < len(s.Blocks); b++ {
+		r := s.block(b, values)
+
+		end := (b + 1) * BlockLen
+		if end > s.Len {
+			end = s.Len
+		}
+
+		for index = b * BlockLen; index < end; index++ {
+			r.next(values)
+			if r.key >= key {
+				recordKey = r.key
+				return
+			}
+		}
+	}
+
+	index = s.Len
+	return
+}
+
+type decoder struct {
+	data []byte
+	key  uint32
+}
+
+// block starts decoding the block.  The values are reset.
+func (s *Seq) block(b int, values []int64) decoder {
+	for i := range values {
+		values[i] = 0
+	}
+	return decoder{s.Data[s.Blocks[b].Offset:], s.Blocks[b].Key}
+}
+
+// next decodes a record.
+func (d *decoder) next(values []int64) {
+	x, n := binary.Uvarint(d.data)
+	d.data = d.data[n:]
+	d.key += uint32(x)
+
+	for i := range values {
+		y, n := binary.Varint(d.data)
+		d.data = d.data[n:]
+		values[i] += y
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compact
+
+import (
+	"testing"
+)
+
+func TestSearchEqualKeysAcrossBlocks(t *testing.T) {
+	var b Builder
+
+	for i := 0; i < BlockLen-2; i++ {
+		b.Append(uint32(i), int64(i))
+	}
+	for i := 0; i < 4; i++ {
+		b.Append(100, int64(1000+i))
+	}
+
+	values := make([]int64, 1)
+
+	index, key := b.Search(100, values)
+	if index != BlockLen-2 || key != 100 || values[0] != 1000 {
+		t.Errorf("index %d, key %d, value %d", index, key, values[0])
+	}
+
+	index, key = b.Search(5, values)
+	if index != 5 || key != 5 || values[0] != 5 {
+		t.Errorf("index %d, key %d, value %d", index, key, values[0])
+	}
+
+	if index, _ = b.Search(101, values); index != b.Len {
+		t.Errorf("index %d", index)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package object
+
+import (
+	"fmt"
+)
+
+// Reloc represents a position within the text section where an import
+// function's absolute native address is referenced by a direct call or jump
+// instruction.
+//
+// The struct size or layout will not change between minor versions.
+type Reloc struct {
+	Addr   uint32 // The address immediately after the call or jump instruction
+	Import uint32 // Import function index
+	Target uint64 // Absolute native address of the function
+}
+
+// Relocate updates the call and jump instructions to reach their targets when
+// the text is located at textAddr.  The Target fields may be modified before
+// calling this, e.g. if the native functions reside at different addresses
+// than during compilation.
+//
+// An error is returned if a target is out of range of a direct branch
+// instruction.  The text may have been partially modified in that case.
+func Relocate(text []byte, textAddr uintptr, relocs []Reloc) error {
+	for _, r := range relocs {
+		disp := int64(r.Target - (uint64(textAddr) + uint64(r.Addr)))
+		if !relocate(text, r.Addr, disp) {
+			return fmt.Errorf("import function #%d address 0x%x is out of range of text address 0x%x", r.Import, r.Target, textAddr)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build wagarm64 arm64,!wagamd64
+
+package object
+
+import (
+	"encoding/binary"
+)
+
+// relocate the 26-bit immediate of a BL or B instruction.
+func relocate(text []byte, addr uint32, disp int64) bool {
+	disp += 4 // Relative to the instruction instead of the next one.
+
+	if disp < -(1<<27) || disp >= 1<<27 {
+		return false
+	}
+
+	insn := text[addr-4 : addr]
+	x := binary.LittleEndian.Uint32(insn)
+	x = x&^0x3ffffff | uint32(disp>>2)&0x3ffffff
+	binary.LittleEndian.PutUint32(insn, x)
+	return true
+}
+
+// callTarget decodes a BL instruction which precedes retAddr.
+func callTarget(text []byte, retAddr uint32) (callAddr, target uint32, ok bool) {
+	if retAddr < 4 || int(retAddr) > len(text) {
+		return
+	}
+
+	x := binary.LittleEndian.Uint32(text[retAddr-4:])
+	if x&0xfc000000 != 0x94000000 {
+		return
+	}
+
+	disp := int32(x<<6) >> 4 // Sign-extended imm26 * 4.
+	callAddr = retAddr - 4
+	target = uint32(int32(callAddr) + disp)
+	ok = true
+	return
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build wagamd64 amd64,!wagarm64
+
+package object
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// relocate the 32-bit displacement of a CALL or JMP instruction.
+func relocate(text []byte, addr uint32, disp int64) bool {
+	if disp < math.MinInt32 || disp > math.MaxInt32 {
+		return false
+	}
+
+	binary.LittleEndian.PutUint32(text[addr-4:], uint32(disp))
+	return true
+}
+
+// callTarget decodes a direct CALL instruction (E8 rel32) which ends at
+// retAddr.
+func callTarget(text []byte, retAddr uint32) (callAddr, target uint32, ok bool) {
+	if retAddr < 5 || int(retAddr) > len(text) || text[retAddr-5] != 0xe8 {
+		return
+	}
+
+	disp := int32(binary.LittleEndian.Uint32(text[retAddr-4:]))
+	callAddr = retAddr - 5
+	target = uint32(int32(retAddr) + disp)
+	ok = true
+	return
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build wagamd64 amd64,!wagarm64
+
+package object_test
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/binding"
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/wa"
+)
+
+type nativeResolver binding.NativeAddr
+
+func (r nativeResolver) ResolveNativeFunc(module, field string, sig wa.FuncType) (binding.NativeAddr, bool, error) {
+	return binding.NativeAddr(r), true, nil
+}
+
+func (nativeResolver) ResolveFunc(module, field string, sig wa.FuncType) (int, error) {
+	panic(module + "." + field)
+}
+
+func (nativeResolver) ResolveGlobal(module, field string, t wa.Type) (uint64, error) {
+	panic(module + "." + field)
+}
+
+func callDisp(text []byte, retAddr uint32) int64 {
+	return int64(int32(binary.LittleEndian.Uint32(text[retAddr-4:])))
+}
+
+func TestRelocateAbsolute(t *testing.T) {
+	const target = 0x7f0000001000
+
+	obj, err := wag.Compile(nil, strings.NewReader(testNativeModule), nativeResolver{Addr: target})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Trampoline and two call sites.
+	if len(obj.Relocs) != 3 {
+		t.Fatal(obj.Relocs)
+	}
+	for i, r := range obj.Relocs {
+		if r.Import != 0 || r.Target != target {
+			t.Errorf("reloc #%d: %v", i, r)
+		}
+		if i > 0 && r.Addr <= obj.Relocs[i-1].Addr {
+			t.Errorf("reloc #%d is out of order: %v", i, r)
+		}
+	}
+	if obj.Relocs[0].Addr > obj.FuncAddrs[1] {
+		t.Errorf("first reloc is not in trampoline: %v", obj.Relocs[0])
+	}
+
+	const textAddr = target - 0x10000000
+
+	if err := object.Relocate(obj.Text, textAddr, obj.Relocs); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range obj.Relocs {
+		if disp := callDisp(obj.Text, r.Addr); textAddr+uintptr(r.Addr)+uintptr(disp) != target {
+			t.Errorf("reloc at 0x%x: displacement 0x%x", r.Addr, disp)
+		}
+	}
+
+	if err := object.Relocate(obj.Text, 0x1000, obj.Relocs); err == nil {
+		t.Error("out-of-range relocation succeeded")
+	}
+}
+
+func TestNativeRelative(t *testing.T) {
+	var offset int64 = -0x1000
+
+	obj, err := wag.Compile(nil, strings.NewReader(testNativeModule), nativeResolver{Addr: uint64(offset), Relative: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(obj.Relocs) != 0 {
+		t.Error(obj.Relocs)
+	}
+
+	if len(obj.CallSites) < 2 {
+		t.Fatal(obj.CallSites)
+	}
+	for _, site := range obj.CallSites[len(obj.CallSites)-2:] {
+		if disp := callDisp(obj.Text, site.RetAddr); int64(site.RetAddr)+disp != offset {
+			t.Errorf("call at 0x%x: displacement 0x%x", site.RetAddr, disp)
+		}
+	}
+}
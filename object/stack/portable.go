@@ -0,0 +1,220 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/section"
+	"github.com/tsavola/wag/wa"
+)
+
+// CallSiteMap provides call site information for stack conversion.  It is
+// implemented by *object.CallMap and *object.CompactCallMap, and by the
+// instruction maps of the debug package which embed them.
+type CallSiteMap interface {
+	TextMap
+	NumCallSites() int
+	CallSite(i int) object.CallSite
+}
+
+// InitFuncIndex is the function index of the init routine's call sites in a
+// portable stack.
+const InitFuncIndex = math.MaxUint32
+
+// Export a native call stack into a portable representation.  Return
+// addresses are replaced with (function index, call index) pairs, encoded as
+// 64-bit words with the function index in the high half.  The call index is
+// relative to the function's first call site, except for the init routine
+// (see InitFuncIndex).  Other stack contents are copied as is.
+//
+// The portable stack can be imported using the call map of the same module
+// compiled with a different compiler version or for a different target
+// architecture.
+func Export(native []byte, textAddr uint64, callMap CallSiteMap) (portable []byte, err error) {
+	if n := len(native); n == 0 || n&7 != 0 {
+		err = fmt.Errorf("invalid stack size %d", n)
+		return
+	}
+
+	portable = make([]byte, len(native))
+	copy(portable, native)
+
+	for b := portable; len(b) > 0; {
+		absRetAddr := binary.LittleEndian.Uint64(b[:8])
+
+		retAddr := absRetAddr - textAddr
+		if retAddr > math.MaxUint32 {
+			err = fmt.Errorf("return address 0x%x is not in text section", absRetAddr)
+			return
+		}
+
+		funcIndex, callIndex, _, stackOffset, initial, ok := callMap.FindAddr(uint32(retAddr))
+		if !ok {
+			err = fmt.Errorf("call instruction not found for return address 0x%x", retAddr)
+			return
+		}
+
+		if initial {
+			binary.LittleEndian.PutUint64(b[:8], uint64(InitFuncIndex)<<32|uint64(callIndex))
+			return
+		}
+
+		if stackOffset == 0 || stackOffset&7 != 0 {
+			err = fmt.Errorf("invalid stack offset %d", stackOffset)
+			return
+		}
+
+		callIndex -= uint32(funcCallBase(callMap, funcIndex))
+		binary.LittleEndian.PutUint64(b[:8], uint64(funcIndex)<<32|uint64(callIndex))
+
+		if int(stackOffset) > len(b) {
+			break
+		}
+		b = b[stackOffset:]
+	}
+
+	err = errors.New("ran out of stack before initial call")
+	return
+}
+
+// Import a portable call stack into native representation.  It reverses
+// Export; see its documentation.
+func Import(portable []byte, textAddr uint64, callMap CallSiteMap) (native []byte, err error) {
+	return importStack(portable, textAddr, callMap, nil)
+}
+
+// SwapError is returned by ImportSwap if a function which has been changed is
+// active on the call stack.
+type SwapError struct {
+	FuncIndex uint32
+	Depth     int // Call stack depth of the innermost frame of the function.
+}
+
+func (e *SwapError) Error() string {
+	return fmt.Sprintf("function %d has been changed but it is active on the call stack (frame #%d)", e.FuncIndex, e.Depth)
+}
+
+// ImportSwap is like Import, but the portable call stack may have been
+// exported from a different version of the module (which has the same
+// function indexes).  The changed callback reports if a function's body or
+// signature differs between the versions.  Frames of unchanged functions are
+// remapped through call indexes.  *SwapError is returned if a changed
+// function has a frame on the call stack.
+func ImportSwap(portable []byte, textAddr uint64, callMap CallSiteMap, changed func(funcIndex uint32) bool) (native []byte, err error) {
+	if changed == nil {
+		panic("changed function predicate is nil")
+	}
+
+	return importStack(portable, textAddr, callMap, changed)
+}
+
+// ChangedFuncs returns a predicate for ImportSwap.  A function is considered
+// changed if its signature or body digest differs between the old and the new
+// module version, or if it exists in only one of them.  (See
+// section.LoadCodeDigests.)
+func ChangedFuncs(oldSigs, newSigs []wa.FuncType, oldDigests, newDigests []section.Digest) func(funcIndex uint32) bool {
+	var (
+		oldImports = len(oldSigs) - len(oldDigests)
+		newImports = len(newSigs) - len(newDigests)
+	)
+
+	return func(funcIndex uint32) bool {
+		i := int(funcIndex)
+
+		if i >= len(oldSigs) || i >= len(newSigs) || !oldSigs[i].Equal(newSigs[i]) {
+			return true
+		}
+
+		if i < oldImports || i < newImports {
+			return oldImports != newImports
+		}
+
+		return oldDigests[i-oldImports] != newDigests[i-newImports]
+	}
+}
+
+func importStack(portable []byte, textAddr uint64, callMap CallSiteMap, changed func(uint32) bool) (native []byte, err error) {
+	if n := len(portable); n == 0 || n&7 != 0 {
+		err = fmt.Errorf("invalid stack size %d", n)
+		return
+	}
+
+	native = make([]byte, len(portable))
+	copy(native, portable)
+
+	for depth, b := 0, native; len(b) > 0; depth++ {
+		pair := binary.LittleEndian.Uint64(b[:8])
+		funcIndex := uint32(pair >> 32)
+		callIndex := uint32(pair)
+
+		if funcIndex == InitFuncIndex {
+			if !isInitCall(callMap, callIndex) {
+				err = fmt.Errorf("init routine call site #%d not found", callIndex)
+				return
+			}
+
+			site := callMap.CallSite(int(callIndex))
+			binary.LittleEndian.PutUint64(b[:8], textAddr+uint64(site.RetAddr))
+			return
+		}
+
+		if changed != nil && changed(funcIndex) {
+			err = &SwapError{funcIndex, depth}
+			return
+		}
+
+		i := funcCallBase(callMap, funcIndex) + int(callIndex)
+		if i >= callMap.NumCallSites() || callOwner(callMap, i) != funcIndex {
+			err = fmt.Errorf("function %d call site #%d not found", funcIndex, callIndex)
+			return
+		}
+
+		site := callMap.CallSite(i)
+		binary.LittleEndian.PutUint64(b[:8], textAddr+uint64(site.RetAddr))
+
+		if site.StackOffset == 0 || site.StackOffset&7 != 0 {
+			err = fmt.Errorf("invalid stack offset %d", site.StackOffset)
+			return
+		}
+
+		if int(site.StackOffset) > len(b) {
+			break
+		}
+		b = b[site.StackOffset:]
+	}
+
+	err = errors.New("ran out of stack before initial call")
+	return
+}
+
+// funcCallBase finds the index of the function's first call site.  Init
+// routine's call sites precede all functions.
+func funcCallBase(callMap CallSiteMap, funcIndex uint32) int {
+	return sort.Search(callMap.NumCallSites(), func(i int) bool {
+		_, _, _, _, initial, _ := callMap.FindAddr(callMap.CallSite(i).RetAddr)
+		return !initial && callOwner(callMap, i) >= funcIndex
+	})
+}
+
+// callOwner returns the index of the function which contains the call site.
+func callOwner(callMap CallSiteMap, callIndex int) uint32 {
+	funcIndex, _, _, _, _, _ := callMap.FindAddr(callMap.CallSite(callIndex).RetAddr)
+	return funcIndex
+}
+
+func isInitCall(callMap CallSiteMap, callIndex uint32) bool {
+	if callIndex >= uint32(callMap.NumCallSites()) {
+		return false
+	}
+
+	_, _, _, _, initial, ok := callMap.FindAddr(callMap.CallSite(int(callIndex)).RetAddr)
+	return initial && ok
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stack
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/tsavola/wag/object"
+	"github.com/tsavola/wag/section"
+	"github.com/tsavola/wag/wa"
+)
+
+func testCallMap(shift uint32) *object.CallMap {
+	return &object.CallMap{
+		FuncMap: object.FuncMap{
+			FuncAddrs: []uint32{0x100 + shift, 0x200 + shift},
+		},
+		CallSites: []object.CallSite{
+			{RetAddr: 0x20, StackOffset: 16},
+			{RetAddr: 0x30, StackOffset: 16},
+			{RetAddr: 0x38, StackOffset: 8},
+			{RetAddr: 0x100 + shift, StackOffset: 16},
+			{RetAddr: 0x150 + shift, StackOffset: 24},
+			{RetAddr: 0x180 + shift, StackOffset: 16},
+			{RetAddr: 0x210 + shift, StackOffset: 16},
+		},
+	}
+}
+
+func testStack(textAddr uint64, retAddrs ...uint64) []byte {
+	b := make([]byte, 6*8)
+	for i, addr := range retAddrs {
+		binary.LittleEndian.PutUint64(b[i*16:], textAddr+addr)
+		binary.LittleEndian.PutUint64(b[i*16+8:], uint64(100+i))
+	}
+	return b
+}
+
+func TestPortable(t *testing.T) {
+	const (
+		textAddr1 = 0x10000
+		textAddr2 = 0x50000
+		shift     = 0x1000
+	)
+
+	native1 := testStack(textAddr1, 0x210, 0x180, 0x38)
+
+	portable, err := Export(native1, textAddr1, testCallMap(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []uint64{1<<32 | 0, 100, 0<<32 | 2, 101, InitFuncIndex<<32 | 2, 102}
+	for i, x := range expect {
+		if y := binary.LittleEndian.Uint64(portable[i*8:]); y != x {
+			t.Errorf("portable word #%d: 0x%x (expected 0x%x)", i, y, x)
+		}
+	}
+
+	native2, err := Import(portable, textAddr2, testCallMap(shift))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(native2) != string(testStack(textAddr2, 0x210+shift, 0x180+shift, 0x38)) {
+		t.Errorf("imported stack: %x", native2)
+	}
+}
+
+func TestPortableCompact(t *testing.T) {
+	const textAddr = 0x10000
+
+	native := testStack(textAddr, 0x210, 0x180, 0x38)
+
+	callMap := testCallMap(0).Compact()
+
+	portable, err := Export(native, textAddr, &callMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect, err := Export(native, textAddr, testCallMap(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(portable) != string(expect) {
+		t.Errorf("portable stack: %x", portable)
+	}
+
+	imported, err := Import(portable, textAddr, &callMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(imported) != string(native) {
+		t.Errorf("imported stack: %x", imported)
+	}
+}
+
+func TestImportMissingCall(t *testing.T) {
+	portable := make([]byte, 16)
+	binary.LittleEndian.PutUint64(portable, 1<<32|1)
+
+	if _, err := Import(portable, 0, testCallMap(0)); err == nil {
+		t.Error("missing call site was not detected")
+	}
+}
+
+func TestImportSwap(t *testing.T) {
+	native := testStack(0, 0x210, 0x180, 0x38)
+
+	portable, err := Export(native, 0, testCallMap(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigs := make([]wa.FuncType, 3)
+
+	var (
+		oldDigests = []section.Digest{{1}, {2}, {3}}
+		newDigests = []section.Digest{{1}, {2}, {4}}
+	)
+
+	changed := ChangedFuncs(sigs, sigs, oldDigests, newDigests)
+
+	if _, err := ImportSwap(portable, 0, testCallMap(0x1000), changed); err != nil {
+		t.Fatal(err)
+	}
+
+	newDigests[0][0] = 5
+
+	_, err = ImportSwap(portable, 0, testCallMap(0x1000), changed)
+	if e, ok := err.(*SwapError); !ok || e.FuncIndex != 0 || e.Depth != 1 {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+// Package pool implements fast instantiation of a compiled program.
+//
+// The initial globals and linear memory contents are kept in a memory file,
+// which is mapped privately (copy-on-write) into each instance.  Resetting an
+// instance discards its private pages instead of copying the initial contents.
+// All instances share a single read-only mapping of the import vector and the
+// program text.
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/tsavola/wag"
+	"golang.org/x/sys/unix"
+)
+
+// LinearMemoryAddressSpace is reserved for globals and linear memory of each
+// instance.  Out-of-bounds memory accesses are detected by the virtual memory
+// hardware.
+const LinearMemoryAddressSpace = 8 * 1024 * 1024 * 1024
+
+// Pool of instances of a program.
+type Pool struct {
+	vecText []byte
+	vecSize int
+
+	imageFd      int
+	imageSize    int
+	memoryOffset int
+	memorySize   int
+
+	mu   sync.Mutex
+	free []*Instance
+}
+
+// New pool for the object.  The import vector will be mapped immediately
+// before the text.  Object's memory offset must be a multiple of the page
+// size (see wag.Config.MemoryAlignment).
+func New(obj *wag.Object, importVector []byte) (p *Pool, err error) {
+	pageSize := os.Getpagesize()
+
+	if obj.MemoryOffset&(pageSize-1) != 0 {
+		err = fmt.Errorf("memory offset %d is not a multiple of page size %d", obj.MemoryOffset, pageSize)
+		return
+	}
+
+	p = &Pool{
+		vecSize:      alignSize(len(importVector), pageSize),
+		imageFd:      -1,
+		imageSize:    alignSize(len(obj.GlobalsMemory), pageSize),
+		memoryOffset: obj.MemoryOffset,
+		memorySize:   obj.InitialMemorySize,
+	}
+
+	if p.imageSize > p.memoryOffset+p.memorySize {
+		err = errors.New("initial memory contents exceed initial memory size")
+		return
+	}
+
+	p.vecText, err = syscall.Mmap(-1, 0, p.vecSize+alignSize(len(obj.Text), pageSize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+	if err != nil {
+		p.Close()
+		return
+	}
+
+	copy(p.vecText[p.vecSize-len(importVector):], importVector)
+	copy(p.vecText[p.vecSize:], obj.Text)
+
+	if err = syscall.Mprotect(p.vecText[:p.vecSize], syscall.PROT_READ); err != nil {
+		p.Close()
+		return
+	}
+
+	if err = syscall.Mprotect(p.vecText[p.vecSize:], syscall.PROT_READ|syscall.PROT_EXEC); err != nil {
+		p.Close()
+		return
+	}
+
+	if p.imageSize > 0 {
+		p.imageFd, err = unix.MemfdCreate("wag-pool", unix.MFD_CLOEXEC)
+		if err != nil {
+			p.Close()
+			return
+		}
+
+		if err = syscall.Ftruncate(p.imageFd, int64(p.imageSize)); err != nil {
+			p.Close()
+			return
+		}
+
+		if _, err = syscall.Pwrite(p.imageFd, obj.GlobalsMemory, 0); err != nil {
+			p.Close()
+			return
+		}
+	}
+
+	return
+}
+
+// Text gets the shared read-only mapping of the program text.
+func (p *Pool) Text() []byte {
+	return p.vecText[p.vecSize:]
+}
+
+// TextAddr is the absolute address of the shared program text.
+func (p *Pool) TextAddr() uintptr {
+	return memAddr(p.vecText) + uintptr(p.vecSize)
+}
+
+// Get an instance in its initial state.  A new instance is created if there
+// are no free ones.
+func (p *Pool) Get() (inst *Instance, err error) {
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		inst = p.free[n-1]
+		p.free = p.free[:n-1]
+	}
+	p.mu.Unlock()
+
+	if inst != nil {
+		return
+	}
+
+	return p.newInstance()
+}
+
+// Put an instance back into the pool.  It is reset to its initial state.  The
+// instance is closed if the reset fails.
+func (p *Pool) Put(inst *Instance) (err error) {
+	if inst.pool != p {
+		panic("instance belongs to another pool")
+	}
+
+	if err = inst.Reset(); err != nil {
+		inst.Close()
+		return
+	}
+
+	p.mu.Lock()
+	p.free = append(p.free, inst)
+	p.mu.Unlock()
+	return
+}
+
+// Close the pool and its free instances.  Instances which are in use must be
+// closed separately.
+func (p *Pool) Close() (first error) {
+	p.mu.Lock()
+	free := p.free
+	p.free = nil
+	p.mu.Unlock()
+
+	for _, inst := range free {
+		if err := inst.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+
+	if p.imageFd >= 0 {
+		if err := syscall.Close(p.imageFd); err != nil && first == nil {
+			first = err
+		}
+		p.imageFd = -1
+	}
+
+	if p.vecText != nil {
+		if err := syscall.Munmap(p.vecText); err != nil && first == nil {
+			first = err
+		}
+		p.vecText = nil
+	}
+
+	return
+}
+
+// Instance has private globals and linear memory.
+type Instance struct {
+	pool  *Pool
+	space []byte
+}
+
+func (p *Pool) newInstance() (inst *Instance, err error) {
+	inst = &Instance{pool: p}
+
+	inst.space, err = syscall.Mmap(-1, 0, p.memoryOffset+LinearMemoryAddressSpace, syscall.PROT_NONE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS|syscall.MAP_NORESERVE)
+	if err != nil {
+		return
+	}
+
+	if err = inst.Reset(); err != nil {
+		inst.Close()
+		return
+	}
+
+	return
+}
+
+// GlobalsMemory gets the globals and the initially allocated linear memory.
+// The memory is preceded by the globals; the threshold is the object's memory
+// offset.
+func (inst *Instance) GlobalsMemory() []byte {
+	return inst.space[:inst.pool.memoryOffset+inst.pool.memorySize]
+}
+
+// MemoryAddr is the absolute address of the linear memory.
+func (inst *Instance) MemoryAddr() uintptr {
+	return memAddr(inst.space) + uintptr(inst.pool.memoryOffset)
+}
+
+// Reset the globals and linear memory to their initial state.  Private copies
+// of the initial image are discarded by mapping the memory file again, and
+// other memory pages are released.  Memory which has been made accessible
+// beyond the initial memory size is made inaccessible again.
+func (inst *Instance) Reset() (err error) {
+	p := inst.pool
+
+	if p.imageSize > 0 {
+		_, _, errno := syscall.Syscall6(syscall.SYS_MMAP, memAddr(inst.space), uintptr(p.imageSize), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_FIXED, uintptr(p.imageFd), 0)
+		if errno != 0 {
+			err = errno
+			return
+		}
+	}
+
+	if err = unix.Madvise(inst.space[p.imageSize:], unix.MADV_DONTNEED); err != nil {
+		return
+	}
+
+	allocated := p.memoryOffset + p.memorySize
+
+	if tail := inst.space[p.imageSize:allocated]; len(tail) > 0 {
+		if err = syscall.Mprotect(tail, syscall.PROT_READ|syscall.PROT_WRITE); err != nil {
+			return
+		}
+	}
+
+	return syscall.Mprotect(inst.space[allocated:], syscall.PROT_NONE)
+}
+
+// Close the instance instead of putting it back into the pool.
+func (inst *Instance) Close() (err error) {
+	if inst.space != nil {
+		err = syscall.Munmap(inst.space)
+		inst.space = nil
+	}
+	return
+}
+
+func memAddr(mem []byte) uintptr {
+	return (*reflect.SliceHeader)(unsafe.Pointer(&mem)).Data
+}
+
+func alignSize(size, alignment int) int {
+	return (size + (alignment - 1)) &^ (alignment - 1)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package pool
+
+import (
+	"os"
+	"testing"
+
+	"github.com/tsavola/wag"
+	"github.com/tsavola/wag/wa"
+)
+
+func TestPool(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	obj := &wag.Object{
+		InitialMemorySize: 2 * wa.PageSize,
+		Text:              []byte{0xcc, 0xcc, 0xcc, 0xcc},
+		MemoryOffset:      pageSize,
+		GlobalsMemory:     make([]byte, pageSize+100),
+	}
+	obj.GlobalsMemory[pageSize-8] = 1  // global
+	obj.GlobalsMemory[pageSize+99] = 2 // memory
+
+	p, err := New(obj, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if p.Text()[0] != 0xcc {
+		t.Error("text")
+	}
+
+	inst, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := inst.GlobalsMemory()
+	if len(data) != pageSize+2*wa.PageSize {
+		t.Fatal(len(data))
+	}
+	if data[pageSize-8] != 1 || data[pageSize+99] != 2 {
+		t.Error("initial contents")
+	}
+
+	data[pageSize-8] = 10
+	data[pageSize+99] = 20
+	data[len(data)-1] = 30
+
+	if err := p.Put(inst); err != nil {
+		t.Fatal(err)
+	}
+
+	inst2, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inst2.Close()
+
+	if inst2 != inst {
+		t.Error("instance was not reused")
+	}
+
+	data = inst2.GlobalsMemory()
+	if data[pageSize-8] != 1 || data[pageSize+99] != 2 || data[len(data)-1] != 0 {
+		t.Error("contents were not reset")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package section
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+
+	"github.com/tsavola/wag/internal/errorpanic"
+	"github.com/tsavola/wag/internal/loader"
+	"github.com/tsavola/wag/internal/module"
+	"github.com/tsavola/wag/internal/reader"
+)
+
+const maxFuncBodySize = 8 * 1024 * 1024 // TODO
+
+// Digest of a function body.
+type Digest [sha256.Size]byte
+
+// LoadCodeDigests reads a whole WebAssembly binary module and hashes the
+// function bodies found in the code section.  The digests are in code section
+// order, so the first digest corresponds to the function index which follows
+// the imported functions.  Nil is returned if there is no code section.
+func LoadCodeDigests(r reader.R) (digests []Digest, err error) {
+	defer func() {
+		err = errorpanic.Handle(recover())
+	}()
+
+	digests = loadCodeDigests(loader.L{R: r})
+	return
+}
+
+func loadCodeDigests(load loader.L) (digests []Digest) {
+	var header module.Header
+	if err := binary.Read(load.R, binary.LittleEndian, &header); err != nil {
+		panic(err)
+	}
+	if header.MagicNumber != module.MagicNumber {
+		panic(module.Error("not a WebAssembly module"))
+	}
+
+	for {
+		sectionId, err := load.R.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return
+			}
+			panic(err)
+		}
+
+		payloadLen := load.Varuint32()
+
+		if ID(sectionId) != Code {
+			if _, err := io.CopyN(ioutil.Discard, load.R, int64(payloadLen)); err != nil {
+				panic(err)
+			}
+			continue
+		}
+
+		for range load.Count(module.MaxFunctions, "function body") {
+			bodySize := load.Varuint32()
+			if bodySize > maxFuncBodySize {
+				panic(module.Errorf("function body is too large: %d bytes", bodySize))
+			}
+
+			digests = append(digests, sha256.Sum256(load.Bytes(bodySize)))
+		}
+		return
+	}
+}
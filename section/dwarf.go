@@ -0,0 +1,33 @@
+// Copyright (c) 2019 Timo Savola. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package section
+
+import (
+	"debug/dwarf"
+)
+
+// CustomDWARFNames lists the custom section names which may contain DWARF
+// debug information.
+var CustomDWARFNames = []string{
+	".debug_abbrev",
+	".debug_aranges",
+	".debug_frame",
+	".debug_info",
+	".debug_line",
+	".debug_pubnames",
+	".debug_ranges",
+	".debug_str",
+}
+
+// DWARF debug information found in the loaded sections.  Nil is returned if
+// there is no .debug_info section.
+func (cs *CustomSections) DWARF() (data *dwarf.Data, err error) {
+	s := cs.Sections
+	if s[".debug_info"] == nil {
+		return
+	}
+
+	return dwarf.New(s[".debug_abbrev"], s[".debug_aranges"], s[".debug_frame"], s[".debug_info"], s[".debug_line"], s[".debug_pubnames"], s[".debug_ranges"], s[".debug_str"])
+}
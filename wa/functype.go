@@ -27,6 +27,26 @@ func (f1 FuncType) Equal(f2 FuncType) bool {
 	return true
 }
 
+// EqualVariadic checks if a variadic function with the result type and the
+// fixed parameters of f1 can be called using the complete signature f2.
+func (f1 FuncType) EqualVariadic(f2 FuncType) bool {
+	if f1.Result != f2.Result {
+		return false
+	}
+
+	if len(f1.Params) > len(f2.Params) {
+		return false
+	}
+
+	for i := range f1.Params {
+		if f1.Params[i] != f2.Params[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func (f FuncType) String() (s string) {
 	s = "("
 	for i, t := range f.Params {